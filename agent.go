@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	errgolog "github.com/gellweiler/errgotrace/log"
+	"github.com/gellweiler/errgotrace/log/schema"
+)
+
+// Flags of agent
+var (
+	agentListen string
+	agentOutDir string
+	agentRotate int
+	agentSinks  string
+	agentBatch  time.Duration
+)
+
+// the agent writes a batch once it holds this many events, or after -batch
+const agentBatchSize = 512
+
+func registerAgentFlags(fs *flag.FlagSet) {
+	fs.StringVar(&agentListen, "listen", "unix:///tmp/errgotrace.sock", "listen on unix:///path or tcp://host:port, the ERRGOTRACE_AGENT of the processes")
+	fs.StringVar(&agentOutDir, "out", "", "write the events as JSON lines to rotated files errgotrace-<time>.jsonl in the `dir`ectory")
+	fs.IntVar(&agentRotate, "rotate", 64, "with -out, start a new file once the current one has this many `MB`")
+	fs.StringVar(&agentSinks, "sink", "", "forward the events to built-in sinks, separated by commas, e.g. otlp, configured by the ERRGOTRACE_* variables (default log without -out)")
+	fs.DurationVar(&agentBatch, "batch", time.Second, "write and forward the events received within this interval together")
+}
+
+// rotatedFile writes JSON lines to files of at most max bytes in a directory
+type rotatedFile struct {
+	dir  string
+	max  int64
+	f    *os.File
+	size int64
+}
+
+// Write a batch of events, a new file is started before a batch that would exceed the size.
+func (r *rotatedFile) write(batch []*schema.Event) error {
+	var data []byte
+	for _, e := range batch {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	if r.f != nil && r.size > 0 && r.size+int64(len(data)) > r.max {
+		r.close()
+	}
+	if r.f == nil {
+		name := filepath.Join(r.dir, "errgotrace-"+time.Now().UTC().Format("20060102T150405.000000000")+".jsonl")
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("%s: failed to open (%s)", name, err)
+		}
+		r.f, r.size = f, 0
+	}
+
+	n, err := r.f.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("%s: failed to write (%s)", r.f.Name(), err)
+	}
+	return nil
+}
+
+func (r *rotatedFile) close() {
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
+
+// Receive the events of one process until it disconnects.
+func receiveEvents(conn net.Conn, events chan<- *schema.Event) {
+	defer conn.Close()
+
+	d := schema.NewDecoder(conn)
+	for {
+		e, err := d.Decode()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Printf("%s: failed to read (%s)", conn.RemoteAddr(), err)
+			return
+		}
+		events <- e
+	}
+}
+
+func runAgent(fs *flag.FlagSet) int {
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	network, addr, err := errgolog.ParseAgentAddr(agentListen)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+
+	var out *rotatedFile
+	if agentOutDir != "" {
+		if err := os.MkdirAll(agentOutDir, 0755); err != nil {
+			log.Printf("%s: failed to create (%s)", agentOutDir, err)
+			return 1
+		}
+		out = &rotatedFile{dir: agentOutDir, max: int64(agentRotate) << 20}
+		defer out.close()
+	}
+
+	forward := agentSinks != "" || out == nil
+	if agentSinks != "" {
+		var sinks []errgolog.Sink
+		for _, name := range strings.Split(agentSinks, ",") {
+			s, err := errgolog.NamedSink(strings.TrimSpace(name))
+			if err != nil {
+				log.Print(err)
+				return 2
+			}
+			sinks = append(sinks, s)
+		}
+		errgolog.SetSinks(sinks...)
+	}
+
+	// a socket left behind by an agent that was killed would make Listen fail
+	if network == "unix" {
+		if c, err := net.Dial(network, addr); err == nil {
+			c.Close()
+			log.Printf("%s: another agent is listening", addr)
+			return 1
+		}
+		os.Remove(addr)
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		log.Printf("%s: failed to listen (%s)", agentListen, err)
+		return 1
+	}
+	defer l.Close()
+
+	events := make(chan *schema.Event, agentBatchSize)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go receiveEvents(conn, events)
+		}
+	}()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	var failure bool
+	var batch []*schema.Event
+	deliver := func() {
+		if len(batch) < 1 {
+			return
+		}
+		if out != nil {
+			if err := out.write(batch); err != nil {
+				log.Print(err)
+				failure = true
+			}
+		}
+		if forward {
+			for _, e := range batch {
+				errgolog.Replay(e)
+			}
+		}
+		batch = nil
+	}
+
+	tick := time.NewTicker(agentBatch)
+	defer tick.Stop()
+	for {
+		select {
+		case e := <-events:
+			if batch = append(batch, e); len(batch) >= agentBatchSize {
+				deliver()
+			}
+		case <-tick.C:
+			deliver()
+		case <-interrupts:
+			l.Close()
+			for n := len(events); n > 0; n-- {
+				batch = append(batch, <-events)
+			}
+			deliver()
+			errgolog.Flush()
+			if failure {
+				return 1
+			}
+			return 0
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// label of the errgotrace binary in repositories fetched with go_repository
+const defaultBazelTool = "@com_github_gellweiler_errgotrace//:errgotrace"
+
+// label and import path of the runtime the instrumented code imports
+const (
+	bazelRuntime      = "@com_github_gellweiler_errgotrace//log"
+	runtimeImportPath = "github.com/gellweiler/errgotrace/log"
+)
+
+var (
+	bazelTool       string
+	bazelFlags      string
+	bazelImportPath string
+)
+
+// BUILD rules instrumenting the sources of a package in a genrule, the original sources stay untouched
+const bazelRules = `# instrumented variant of :%[1]s, generated by errgotrace gazelle
+genrule(
+    name = "%[1]s_errgotrace_srcs",
+    srcs = [%[2]s],
+    outs = [%[3]s],
+    cmd = "$(execpath %[4]s) add%[5]s -outdir $(RULEDIR)/errgotrace $(SRCS)",
+    tools = ["%[4]s"],
+)
+
+go_library(
+    name = "%[1]s_traced",
+    srcs = [":%[1]s_errgotrace_srcs"],
+    importpath = "%[6]s",
+%[7]s)
+`
+
+// Write the result for a file into the -outdir directory.
+func writeOutput(file string, src []byte) error {
+	out := filepath.Join(outDir, filepath.Base(file))
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("%s: failed to create (%s)", outDir, err)
+	}
+	if err := ioutil.WriteFile(out, src, 0644); err != nil {
+		return fileErrorf(out, phaseWrite, "failed to write (%s)", err)
+	}
+	return nil
+}
+
+// Make sure no two files are written to the same file of the -outdir directory.
+func checkOutputNames(files []string) error {
+	seen := make(map[string]string)
+	for _, file := range files {
+		name := filepath.Base(file)
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s", other, file, filepath.Join(outDir, name))
+		}
+		seen[name] = file
+	}
+	return nil
+}
+
+func registerGazelleFlags(fs *flag.FlagSet) {
+	fs.StringVar(&bazelTool, "tool", defaultBazelTool, "Bazel label of the errgotrace binary")
+	fs.StringVar(&bazelFlags, "flags", "", "flags passed to errgotrace add in the genrule, e.g. '-timing -args'")
+	fs.StringVar(&bazelImportPath, "importpath", "", "import path of the package, needed if it is neither in a module nor in the GOPATH")
+}
+
+// Load the package in dir with the build constraints of the current platform, without its tests.
+func loadPackage(dir string) (*build.Package, error) {
+	pkg, err := build.Default.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to load the package (%s)", dir, err)
+	}
+	return pkg, nil
+}
+
+// List the go sources of the package that are part of its library.
+func packageSources(pkg *build.Package) []string {
+	srcs := append(append([]string(nil), pkg.GoFiles...), pkg.CgoFiles...)
+	sort.Strings(srcs)
+	return srcs
+}
+
+// Get the module root and path of the go.mod the absolute directory dir belongs to, empty if there is none.
+func moduleOf(dir string) (string, string) {
+	for {
+		if src, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			if m := moduleDirectiveRegex.FindSubmatch(src); m != nil {
+				return dir, string(m[1])
+			}
+			return "", ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// Write the deps attribute for the imports of the package: the runtime, and the packages of the same
+// module named like gazelle does. Other imports can't be resolved without the go_repository rules, they
+// are listed in a comment.
+func bazelDeps(pkg *build.Package, module string) string {
+	deps := []string{bazelRuntime}
+	var unresolved []string
+	for _, imp := range pkg.Imports {
+		first := strings.SplitN(imp, "/", 2)[0]
+		switch {
+		case imp == "C" || !strings.Contains(first, "."):
+			// the standard library
+		case imp == runtimeImportPath:
+			// already instrumented
+		case module != "" && imp == module:
+			deps = append(deps, "//:"+path.Base(imp))
+		case module != "" && strings.HasPrefix(imp, module+"/"):
+			deps = append(deps, "//"+strings.TrimPrefix(imp, module+"/")+":"+path.Base(imp))
+		default:
+			unresolved = append(unresolved, imp)
+		}
+	}
+
+	s := ""
+	if len(unresolved) > 0 {
+		s += "    # add the labels of the imports outside of the module: " + strings.Join(unresolved, ", ") + "\n"
+	}
+	return s + "    deps = [" + quoteList(deps) + "],\n"
+}
+
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = strconv.Quote(item)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Write the rules for the package in dir, named after the directory like gazelle does.
+func writeBazelRules(w io.Writer, dir string) error {
+	pkg, err := loadPackage(dir)
+	if err != nil {
+		return err
+	}
+	srcs := packageSources(pkg)
+	if len(srcs) < 1 {
+		return fmt.Errorf("%s: no go files", dir)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("%s: %s", dir, err)
+	}
+
+	outs := make([]string, len(srcs))
+	for i, src := range srcs {
+		outs[i] = "errgotrace/" + src
+	}
+
+	flags := ""
+	if bazelFlags != "" {
+		flags = " " + strings.Replace(bazelFlags, `"`, `\"`, -1)
+	}
+
+	_, module := moduleOf(abs)
+	importPath := bazelImportPath
+	if importPath == "" {
+		importPath = packageImportPath(abs)
+	}
+	if importPath == "" {
+		importPath = gopathImportPath(abs)
+	}
+	if importPath == "" {
+		return fmt.Errorf("%s: the import path is unknown outside of modules and the GOPATH, give it with -importpath", dir)
+	}
+
+	_, err = fmt.Fprintf(w, bazelRules, filepath.Base(abs), quoteList(srcs), quoteList(outs), bazelTool, flags, importPath, bazelDeps(pkg, module))
+	return err
+}
+
+func runGazelle(fs *flag.FlagSet) int {
+	dirs := fs.Args()
+	if len(dirs) < 1 {
+		dirs = []string{"."}
+	}
+	if bazelImportPath != "" && len(dirs) > 1 {
+		log.Print("-importpath is the import path of a single package")
+		return 2
+	}
+
+	var failure bool
+	for i, dir := range dirs {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := writeBazelRules(os.Stdout, dir); err != nil {
+			log.Print(err)
+			failure = true
+		}
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Bump whenever the generated code changes, so stale cache entries are not used anymore.
+const cacheVersion = "11"
+
+// Flags that do not influence the generated code and therefore are not part of the cache key.
+var cacheNeutralFlags = map[string]bool{
+	"w":           true,
+	"files":       true,
+	"testdata":    true,
+	"hidden":      true,
+	"ignored":     true,
+	"report":      true,
+	"progress":    true,
+	"patch":       true,
+	"cache":       true,
+	"verify":      true,
+	"typecheck":   true,
+	"q":           true,
+	"json-errors": true,
+	"outdir":      true,
+	"sourcemap":   true,
+	"policy":      true,
+	"force":       true,
+	"stat":        true,
+	"max-growth":  true,
+}
+
+// cache maps the hash of a source file and the options to the instrumented output
+type outputCache struct {
+	dir     string
+	options []byte
+}
+
+type cacheEntry struct {
+	Output []byte     `json:"output"`
+	Stats  *fileStats `json:"stats"`
+}
+
+// Open the cache in the users cache directory.
+func openCache() (*outputCache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("cache: no cache directory (%s)", err)
+	}
+
+	dir = filepath.Join(dir, "errgotrace")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("%s: failed to create cache directory (%s)", dir, err)
+	}
+
+	c := &outputCache{dir: dir}
+	activeFlags.VisitAll(func(f *flag.Flag) {
+		if !cacheNeutralFlags[f.Name] {
+			c.options = append(c.options, []byte(f.Name+"="+f.Value.String()+"\x00")...)
+		}
+	})
+
+	return c, nil
+}
+
+// The output also depends on the go.mod of the file, the function names on the module path and the code
+// on the go version.
+func (c *outputCache) path(filename string, src []byte) string {
+	h := sha256.New()
+	h.Write([]byte(cacheVersion + "\x00"))
+	h.Write([]byte(fileImportPath(filename) + "\x00" + moduleGoVersion(filename).String() + "\x00"))
+	h.Write(c.options)
+	h.Write([]byte(funcTemplateSource + "\x00"))
+	h.Write(rulesSource)
+	h.Write([]byte(filename + "\x00"))
+	h.Write(src)
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// Lookup the instrumented output of a file, reports false if the file is not cached.
+func (c *outputCache) get(filename string, src []byte) ([]byte, *fileStats, bool) {
+	data, err := ioutil.ReadFile(c.path(filename, src))
+	if err != nil {
+		return nil, nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Stats == nil {
+		return nil, nil, false
+	}
+
+	return entry.Output, entry.Stats, true
+}
+
+// Store the instrumented output of a file, failures only mean the next run is slower.
+func (c *outputCache) put(filename string, src, output []byte, stats *fileStats) {
+	data, err := json.Marshal(cacheEntry{Output: output, Stats: stats})
+	if err != nil {
+		return
+	}
+
+	// write to a temporary file first, so concurrent runs never see partial entries
+	tmp, err := ioutil.TempFile(c.dir, "entry")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), c.path(filename, src)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Annotate the contents of a go file, using the cache if enabled.
+func cachedAnnotate(filename string, orig []byte) ([]byte, *fileStats, error) {
+	if cache == nil {
+		return annotate(filename, orig)
+	}
+
+	if src, stats, ok := cache.get(filename, orig); ok {
+		return src, stats, nil
+	}
+
+	src, stats, err := annotate(filename, orig)
+	if err == nil {
+		cache.put(filename, orig, src, stats)
+	}
+
+	return src, stats, err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheKeyDependsOnGoMod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errgotrace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	src := []byte("package a\n")
+	c := &outputCache{dir: dir}
+
+	key := func(goMod string) string {
+		if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// a run reads every go.mod only once
+		goModMu.Lock()
+		goModCache = make(map[string]goVersion)
+		importPathCache = make(map[string]string)
+		goModMu.Unlock()
+		return c.path(file, src)
+	}
+
+	old := key("module example.com/a\n\ngo 1.17\n")
+	if key("module example.com/a\n\ngo 1.17\n") != old {
+		t.Error("same go.mod, different keys")
+	}
+	if key("module example.com/b\n\ngo 1.17\n") == old {
+		t.Error("the key ignores the module path")
+	}
+	if key("module example.com/a\n\ngo 1.21\n") == old {
+		t.Error("the key ignores the go version")
+	}
+}
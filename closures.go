@@ -0,0 +1,96 @@
+package main
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// Check if a result is a function literal type returning an error, e.g. the cleanup of func New() (func() error, error).
+func errorClosure(t ast.Expr) (*ast.FuncType, bool) {
+	for {
+		p, ok := t.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		t = p.X
+	}
+
+	ft, ok := t.(*ast.FuncType)
+	if !ok || ft.Results == nil {
+		return nil, false
+	}
+	for _, field := range ft.Results.List {
+		if errorKind(field.Type) != notError {
+			return ft, true
+		}
+	}
+	return nil, false
+}
+
+// Generate the code replacing the returned function in the result variable v with a function of the
+// same type, which calls it and inspects its results under the given name.
+func wrapClosure(name, v string, ft *ast.FuncType, orig []byte) string {
+	text := func(e ast.Expr) string {
+		return string(orig[e.Pos()-1 : e.End()-1])
+	}
+
+	var params, args []string
+	i := 0
+	for _, field := range ft.Params.List {
+		t := text(field.Type)
+		for j := 0; j == 0 || j < len(field.Names); j++ {
+			arg := "__a" + strconv.Itoa(i)
+			i++
+
+			params = append(params, arg+" "+t)
+			if strings.HasPrefix(t, "...") {
+				arg += "..."
+			}
+			args = append(args, arg)
+		}
+	}
+
+	var results, inspectVars, guards []string
+	guarded := true
+	i = 0
+	for _, field := range ft.Results.List {
+		for j := 0; j == 0 || j < len(field.Names); j++ {
+			r := "__c" + strconv.Itoa(i)
+			results = append(results, r)
+			i++
+
+			switch errorKind(field.Type) {
+			case isError:
+				inspectVars = append(inspectVars, r)
+				guards = append(guards, r+" != nil")
+			case mayBeError:
+				inspectVars = append(inspectVars, r)
+				guarded = false
+			}
+		}
+	}
+
+	inspect := "__errgotrace.InspectReturnValues(" + strconv.Quote(name) + ", " + strings.Join(inspectVars, ", ") + ")"
+	if guarded {
+		inspect = "if " + strings.Join(guards, " || ") + " {\n" + inspect + "\n}"
+	}
+
+	// the results of the literal are unnamed, named results of the type would be shadowed
+	returns := text(ft.Results.List[0].Type)
+	if len(results) > 1 || ft.Results.Opening.IsValid() {
+		var types []string
+		for _, field := range ft.Results.List {
+			for j := 0; j == 0 || j < len(field.Names); j++ {
+				types = append(types, text(field.Type))
+			}
+		}
+		returns = "(" + strings.Join(types, ", ") + ")"
+	}
+
+	return "if __f := " + v + "; __f != nil {\n" +
+		v + " = func(" + strings.Join(params, ", ") + ") " + returns + " {\n" +
+		strings.Join(results, ", ") + " := __f(" + strings.Join(args, ", ") + ")\n" +
+		inspect + "\n" +
+		"return " + strings.Join(results, ", ") + "\n}\n}"
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+)
+
+// command is a subcommand of errgotrace
+type command struct {
+	name    string
+	args    string
+	summary string
+	setup   func(fs *flag.FlagSet)
+	run     func(fs *flag.FlagSet) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:    "add",
+			args:    "[flags] [path|glob ...]",
+			summary: "add tracing code to go files",
+			setup: func(fs *flag.FlagSet) {
+				registerPathFlags(fs)
+				registerAnnotateFlags(fs)
+				registerOutputFlags(fs)
+				registerFuncFlags(fs)
+			},
+			run: runAdd,
+		},
+		{
+			name:    "remove",
+			args:    "[flags] [path|glob ...]",
+			summary: "remove tracing code from go files",
+			setup: func(fs *flag.FlagSet) {
+				registerPathFlags(fs)
+				registerOutputFlags(fs)
+				registerFuncFlags(fs)
+				fs.Var(&filterFlag, "filter", "only remove the tracing code of functions matching the `regex`, can be repeated and all of them have to match")
+				fs.Var(&filterAny, "filter-any", "only remove the tracing code of functions matching at least one of the `regex`es given with -filter-any")
+				fs.Var(&excludeFlag, "exclude", "keep the tracing code of functions matching the `regex`, can be repeated, takes precedence over the filters")
+			},
+			run: runRemove,
+		},
+		{
+			name:    "check",
+			args:    "[flags] [path|glob ...]",
+			summary: "list files that contain tracing code, fails if there are any",
+			setup: func(fs *flag.FlagSet) {
+				registerPathFlags(fs)
+				fs.BoolVar(&checkStaged, "staged", false, "check the staged versions of the go files to be committed, the paths restrict them like git pathspecs")
+			},
+			run: runCheck,
+		},
+		{
+			name:    "hook",
+			args:    "install|uninstall [flags]",
+			summary: "install a git pre-commit hook blocking commits of files that contain tracing code, or remove it",
+			setup: func(fs *flag.FlagSet) {
+				fs.BoolVar(&hookForce, "force", false, "with install, replace a pre-commit hook that was not installed by errgotrace")
+			},
+			run: runHook,
+		},
+		{
+			name:    "explain",
+			args:    "[flags] [path|glob ...]",
+			summary: "print go files with comments showing where tracing code would go and the names it would trace, nothing is modified",
+			setup: func(fs *flag.FlagSet) {
+				registerPathFlags(fs)
+				registerAnnotateFlags(fs)
+			},
+			run: runExplain,
+		},
+		{
+			name:    "run",
+			args:    "[flags] [path|glob ...] -- command [args ...]",
+			summary: "add tracing code, run a command and restore the files afterwards",
+			setup: func(fs *flag.FlagSet) {
+				registerPathFlags(fs)
+				registerAnnotateFlags(fs)
+				fs.BoolVar(&useCache, "cache", false, "cache instrumented files in the user cache directory, to skip unchanged files on the next run")
+			},
+			run: runRun,
+		},
+		{
+			name:    "provenance",
+			args:    "binary ...",
+			summary: "list binaries built from instrumented sources, fails if there are any",
+			setup:   func(fs *flag.FlagSet) {},
+			run:     runProvenance,
+		},
+		{
+			name:    "view",
+			args:    "[flags] [logfile ...]",
+			summary: "show the trace output contained in log files or stdin",
+			setup: func(fs *flag.FlagSet) {
+				fs.StringVar(&viewFuncFlag, "func", "", "only show traces of functions matching the regular expression")
+				fs.BoolVar(&viewMerge, "merge", false, "merge the logs of several processes into one timeline, every line prefixed with its process, the log file's name or the service of docker compose logs")
+				fs.StringVar(&viewCorrelate, "correlate", "", "with -merge, group the lines by the value of the given `key` in their fields, arguments or error fields, e.g. request_id")
+			},
+			run: runView,
+		},
+		{
+			name:    "symbolize",
+			args:    "[logfile ...]",
+			summary: "translate stack traces of instrumented code to the original functions and lines, using the -sourcemap files",
+			setup:   func(fs *flag.FlagSet) {},
+			run:     runSymbolize,
+		},
+		{
+			name:    "replay",
+			args:    "[flags] [file ...]",
+			summary: "emit the events recorded by the JSON sink of the runtime to sinks again",
+			setup:   registerReplayFlags,
+			run:     runReplay,
+		},
+		{
+			name:    "agent",
+			args:    "[flags]",
+			summary: "collect the events of the processes sending to ERRGOTRACE_AGENT, write them to rotated files or forward them to sinks",
+			setup:   registerAgentFlags,
+			run:     runAgent,
+		},
+		{
+			name:    "unseal",
+			args:    "[flags] [file ...]",
+			summary: "decrypt or verify the batches written by the encrypted and signed sinks of the runtime",
+			setup:   registerUnsealFlags,
+			run:     runUnseal,
+		},
+		{
+			name:    "report",
+			args:    "diff [flags] before.json after.json",
+			summary: "show which functions gained or lost instrumentation between two -report files",
+			setup: func(fs *flag.FlagSet) {
+				fs.BoolVar(&reportJSON, "json", false, "print the functions as JSON")
+			},
+			run: runReportCmd,
+		},
+		{
+			name:    "serve",
+			args:    "[flags]",
+			summary: "serve a JSON API adding and removing tracing code in editor buffers",
+			setup: func(fs *flag.FlagSet) {
+				registerServeFlags(fs)
+				registerAnnotateFlags(fs)
+			},
+			run: runServe,
+		},
+		{
+			name:    "mirror",
+			args:    "[flags]",
+			summary: "copy a module, add tracing code to the copy and print the command building it",
+			setup: func(fs *flag.FlagSet) {
+				registerMirrorFlags(fs)
+				registerAnnotateFlags(fs)
+				fs.BoolVar(&showProgress, "progress", false, "show progress on stderr and print a summary at the end")
+			},
+			run: runMirror,
+		},
+		{
+			name:    "gazelle",
+			args:    "[flags] [dir ...]",
+			summary: "print Bazel rules building instrumented variants of go_library targets",
+			setup:   registerGazelleFlags,
+			run:     runGazelle,
+		},
+		{
+			name:    "help",
+			args:    "[command]",
+			summary: "show the help of a command",
+			setup:   func(fs *flag.FlagSet) {},
+			run:     runHelp,
+		},
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("errgotrace "+c.name, flag.ExitOnError)
+	c.setup(fs)
+	fs.Usage = func() {
+		summary := strings.ToUpper(c.summary[:1]) + c.summary[1:]
+		fmt.Fprintf(fs.Output(), "%s.\n\nusage: errgotrace %s %s\n", summary, c.name, c.args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Parse the arguments of the command and run it, returns the exit code.
+func (c *command) execute(args []string) int {
+	fs := c.flagSet()
+	fs.Parse(args)
+	return c.run(fs)
+}
+
+// Print the general usage of errgotrace
+func usage() {
+	// the summaries line up two spaces after the longest name
+	width := 0
+	for _, cmd := range commands {
+		if len(cmd.name) > width {
+			width = len(cmd.name)
+		}
+	}
+	var list bytes.Buffer
+	for _, cmd := range commands {
+		fmt.Fprintf(&list, "  %-*s  %s\n", width, cmd.name, cmd.summary)
+	}
+
+	fmt.Fprintf(os.Stdout, cmdMessagePrefix, list.String())
+	flag.PrintDefaults()
+	os.Stdout.Write([]byte(cmdMessageSuffix))
+}
+
+func runAdd(fs *flag.FlagSet) int {
+	reverseProcess = false
+	return processFiles(fs, fs.Args())
+}
+
+func runRemove(fs *flag.FlagSet) int {
+	reverseProcess = true
+	return processFiles(fs, fs.Args())
+}
+
+// Check if the given source contains any tracing code, markers in string literals don't count.
+func containsTracing(src []byte) bool {
+	for offset := range markerComments(src) {
+		if bytes.HasPrefix(src[offset:], []byte(beginMarker)) {
+			return true
+		}
+	}
+	return false
+}
+
+func runCheck(fs *flag.FlagSet) int {
+	if checkStaged {
+		return runCheckStaged(fs)
+	}
+
+	files, err := collectFiles(fs.Args(), filesFlag)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	var failure bool
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Printf("%s: failed to open (%s)", file, err)
+			failure = true
+			continue
+		}
+
+		if containsTracing(src) {
+			fmt.Println(file)
+			failure = true
+		}
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
+
+func runRun(fs *flag.FlagSet) int {
+	// everything after -- is the command to run
+	args := fs.Args()
+	var cmdArgs []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, cmdArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	if len(cmdArgs) < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	// keep the original contents, to restore them exactly afterwards
+	files, err := collectFiles(args, filesFlag)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	originals := make(map[string][]byte)
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Printf("%s: failed to open (%s)", file, err)
+			return 1
+		}
+		originals[file] = src
+	}
+
+	restore := func() int {
+		status := 0
+		for file, src := range originals {
+			if err := ioutil.WriteFile(file, src, 0); err != nil {
+				log.Printf("%s: failed to restore (%s)", file, err)
+				status = 1
+			}
+		}
+		return status
+	}
+
+	// the command gets the interrupt as well, wait for it to finish before restoring
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	writeFiles = true
+	filesFlag = ""
+	if status := processFiles(fs, files); status != 0 {
+		restore()
+		return status
+	}
+
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+
+	if status := restore(); status != 0 {
+		return status
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	} else if err != nil {
+		log.Printf("%s: failed to run (%s)", cmdArgs[0], err)
+		return 1
+	}
+
+	return 0
+}
+
+var viewFuncFlag string
+
+// matches the function name of a trace line, after the indentation of its depth and the markers of loops,
+// alerts and origins, with the message of errors or the fields of ENTER, EXIT and SLOW calls. Names may
+// contain type arguments, e.g. store.*Cache[K, V].Get
+var traceLineRegex = regexp.MustCompile(`\[ERRGOTRACE\] *(?:(?:LOOP|ALERT|ORIGIN|PROPAGATED) )*` +
+	`(?:(?:ENTER|EXIT|SLOW) ((?:[^:\s\[]|\[[^\]]*\])+)(?: (\[.*))?|((?:[^:\s\[]|\[[^\]]*\])+): (.*))$`)
+
+// Get the function of a trace line.
+func traceLineFunc(line string) (string, bool) {
+	m := traceLineRegex.FindStringSubmatch(line)
+	switch {
+	case m == nil:
+		return "", false
+	case m[1] != "":
+		return m[1], true
+	}
+	return m[3], true
+}
+
+func viewTraces(r io.Reader, w io.Writer, funcFilter *regexp.Regexp) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		name, ok := traceLineFunc(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		if funcFilter != nil && !funcFilter.MatchString(name) {
+			continue
+		}
+
+		fmt.Fprintln(w, scanner.Text())
+	}
+	return scanner.Err()
+}
+
+func runView(fs *flag.FlagSet) int {
+	var funcFilter *regexp.Regexp
+	if viewFuncFlag != "" {
+		var err error
+		funcFilter, err = regexp.Compile(viewFuncFlag)
+		if err != nil {
+			log.Printf("error in func regex (%s)", err.Error())
+			return 1
+		}
+	}
+
+	if viewMerge || viewCorrelate != "" {
+		if err := mergeTraces(fs.Args(), os.Stdout, funcFilter); err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	if fs.NArg() < 1 {
+		if err := viewTraces(os.Stdin, os.Stdout, funcFilter); err != nil {
+			log.Printf("stdin: failed to read (%s)", err)
+			return 1
+		}
+		return 0
+	}
+
+	var failure bool
+	for _, file := range fs.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("%s: failed to open (%s)", file, err)
+			failure = true
+			continue
+		}
+
+		err = viewTraces(f, os.Stdout, funcFilter)
+		f.Close()
+		if err != nil {
+			log.Printf("%s: failed to read (%s)", file, err)
+			failure = true
+		}
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
+
+func runHelp(fs *flag.FlagSet) int {
+	if fs.NArg() < 1 {
+		usage()
+		return 0
+	}
+
+	cmd := lookupCommand(fs.Arg(0))
+	if cmd == nil {
+		log.Printf("unknown command %q", fs.Arg(0))
+		return 2
+	}
+
+	sub := cmd.flagSet()
+	sub.SetOutput(os.Stdout)
+	sub.Usage()
+	return 0
+}
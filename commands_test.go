@@ -0,0 +1,51 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Lines of the depth option, call tracing and methods of generic types, next to an error and other output
+var traceLines = []struct {
+	name, line, fn string
+}{
+	{"error", "2024/05/01 10:00:00 [ERRGOTRACE] store.Open: failed [caller: main.main]", "store.Open"},
+	{"depth", "2024/05/01 10:00:01 [ERRGOTRACE]     store.read: unexpected EOF", "store.read"},
+	{"depth loop", "2024/05/01 10:00:01 [ERRGOTRACE]   LOOP store.read: unexpected EOF [loop: 3 in 1s]", "store.read"},
+	{"enter", "2024/05/01 10:00:02 [ERRGOTRACE] ENTER store.*Client.Get", "store.*Client.Get"},
+	{"exit", "2024/05/01 10:00:02 [ERRGOTRACE]   EXIT store.*Client.Get [took: 3ms]", "store.*Client.Get"},
+	{"slow", "2024/05/01 10:00:02 [ERRGOTRACE] SLOW store.*Client.Get [took: 2s] [request: 7f3a]", "store.*Client.Get"},
+	{"generic", "2024/05/01 10:00:03 [ERRGOTRACE] store.*Cache[K, V].Get: not found", "store.*Cache[K, V].Get"},
+	{"generic nested", "2024/05/01 10:00:03 [ERRGOTRACE]   EXIT store.Tree[K, List[V]].Walk [took: 1ms]", "store.Tree[K, List[V]].Walk"},
+}
+
+func TestTraceLineFunc(t *testing.T) {
+	for _, tt := range traceLines {
+		t.Run(tt.name, func(t *testing.T) {
+			if fn, ok := traceLineFunc(tt.line); !ok || fn != tt.fn {
+				t.Errorf("got function %q (%v), expected %q", fn, ok, tt.fn)
+			}
+		})
+	}
+	for _, line := range []string{"2024/05/01 10:00:00 listening on :8080", "[ERRGOTRACE] no console, events are written to x.log"} {
+		if fn, ok := traceLineFunc(line); ok {
+			t.Errorf("%q: got function %q of a line that isn't a trace line", line, fn)
+		}
+	}
+}
+
+func TestViewTraces(t *testing.T) {
+	for _, tt := range traceLines {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "2024/05/01 10:00:00 listening on :8080\n" + tt.line + "\n"
+			var out strings.Builder
+			if err := viewTraces(strings.NewReader(input), &out, regexp.MustCompile("^"+regexp.QuoteMeta(tt.fn)+"$")); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.line+"\n" {
+				t.Errorf("got %q, expected the trace line", out.String())
+			}
+		})
+	}
+}
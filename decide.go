@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// decider asks an external command whether to instrument functions.
+// The command is started once and speaks newline-delimited JSON: for every candidate
+// it reads a request {"function": {...}, "options": {...}} from stdin and has to write
+// a response {"instrument": true|false, "options": {...}} to stdout. Options in the
+// response replace the proposed ones, if omitted the proposed options are kept.
+type decider struct {
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+}
+
+type decideRequest struct {
+	Function *candidate  `json:"function"`
+	Options  funcOptions `json:"options"`
+}
+
+type decideResponse struct {
+	Instrument bool         `json:"instrument"`
+	Options    *funcOptions `json:"options"`
+}
+
+func startDecider(command string) (*decider, error) {
+	args := strings.Fields(command)
+	if len(args) < 1 {
+		return nil, fmt.Errorf("decide-cmd: no command given")
+	}
+
+	d := &decider{command: args[0], cmd: exec.Command(args[0], args[1:]...)}
+	d.cmd.Stderr = os.Stderr
+
+	var err error
+	if d.stdin, err = d.cmd.StdinPipe(); err != nil {
+		return nil, fmt.Errorf("%s: failed to start (%s)", d.command, err)
+	}
+	stdout, err := d.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to start (%s)", d.command, err)
+	}
+	d.stdout = bufio.NewReader(stdout)
+
+	if err := d.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: failed to start (%s)", d.command, err)
+	}
+
+	return d, nil
+}
+
+// Ask the command about a function, the answer may change opts.
+func (d *decider) decide(c *candidate, opts *funcOptions) (bool, error) {
+	req, err := json.Marshal(decideRequest{Function: c, Options: *opts})
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := d.stdin.Write(append(req, '\n')); err != nil {
+		return false, fmt.Errorf("%s: failed to write (%s)", d.command, err)
+	}
+
+	line, err := d.stdout.ReadBytes('\n')
+	if err != nil {
+		return false, fmt.Errorf("%s: failed to read (%s)", d.command, err)
+	}
+
+	var resp decideResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return false, fmt.Errorf("%s: invalid response (%s)", d.command, err)
+	}
+
+	if resp.Options != nil {
+		*opts = *resp.Options
+	}
+	return resp.Instrument, nil
+}
+
+// Stop the command and wait for it to exit.
+func (d *decider) close() error {
+	d.stdin.Close()
+	if err := d.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %s", d.command, err)
+	}
+	return nil
+}
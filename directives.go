@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+const directivePrefix = "//errgotrace:"
+
+// directives given in the doc comment of a function, e.g.
+//
+//   //errgotrace:trace args,timing,stack
+//   //errgotrace:redact password,token
+//   //errgotrace:receiver Name,State
+//   //errgotrace:skip
+type directives struct {
+	trace bool
+	skip  bool
+	opts  funcOptions
+}
+
+// Split a comma separated directive argument list
+func directiveArgs(s string) []string {
+	var args []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// Parse the errgotrace directives of a function.
+func parseDirectives(f *ast.FuncDecl) (*directives, error) {
+	d := &directives{}
+	if f.Doc == nil {
+		return d, nil
+	}
+
+	for _, c := range f.Doc.List {
+		if !strings.HasPrefix(c.Text, directivePrefix) {
+			continue
+		}
+
+		text := strings.TrimPrefix(c.Text, directivePrefix)
+		name, args := text, ""
+		if i := strings.IndexAny(text, " \t"); i >= 0 {
+			name, args = text[:i], text[i+1:]
+		}
+
+		switch name {
+		case "skip":
+			d.skip = true
+		case "trace":
+			d.trace = true
+			for _, opt := range directiveArgs(args) {
+				if err := d.opts.set(opt, true); err != nil {
+					return nil, fmt.Errorf("%s: %s", c.Text, err)
+				}
+			}
+		case "redact":
+			d.opts.Redact = append(d.opts.Redact, directiveArgs(args)...)
+		case "receiver":
+			d.opts.Receiver = true
+			d.opts.Fields = append(d.opts.Fields, directiveArgs(args)...)
+		default:
+			return nil, fmt.Errorf("%s: unknown directive %q", c.Text, name)
+		}
+	}
+
+	if d.skip && d.trace {
+		return nil, fmt.Errorf("%s: both skip and trace given", f.Name.Name)
+	}
+
+	return d, nil
+}
+
+// Apply the options of the directives, they take precedence over all other options.
+func (d *directives) apply(opts *funcOptions) {
+	opts.Timing = opts.Timing || d.opts.Timing
+	opts.Args = opts.Args || d.opts.Args
+	opts.Stack = opts.Stack || d.opts.Stack
+	opts.Context = opts.Context || d.opts.Context
+	opts.HTTP = opts.HTTP || d.opts.HTTP
+	opts.Calls = opts.Calls || d.opts.Calls
+	opts.Depth = opts.Depth || d.opts.Depth
+	opts.Closures = opts.Closures || d.opts.Closures
+	if d.opts.Receiver {
+		opts.Receiver = true
+		opts.Fields = d.opts.Fields
+	}
+	opts.Redact = append(opts.Redact, d.opts.Redact...)
+}
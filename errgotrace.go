@@ -16,6 +16,7 @@ import (
 	"strings"
 	"log"
 	"bufio"
+	"sort"
 )
 
 var (
@@ -32,53 +33,150 @@ var _ = __errgotrace.Setup()
 /* END_ERRGOTRACE */
 `
 
+	// The template for the code injected at the beginning of every function, can be replaced with -template.
+	// Available variables:
+	//   .outputfname   name used in the trace output, e.g. pkg.*Type.Func
+	//   .fname         name of the instrumented function
+	//   .receiver      receiver of the function including parentheses, empty for functions
+	//   .typeparams    type parameters of generic functions including brackets, empty otherwise
+	//   .typeargs      the type parameter names for calling the backend function, e.g. [K, V]
+	//   .goversion     go version of the module, e.g. 1.21, empty if unknown
+	//   .params        named parameters with their types including parentheses
+	//   .returns       result list of the function
+	//   .resultvars    comma separated variables holding the results
+	//   .callreceiver  name of the receiver for calling the backend function, empty if none
+	//   .callparams    comma separated arguments for calling the backend function
+	//   .timing        set if the duration of the call should be measured in __start
+	//   .inspect       the call to the runtime inspecting the results
+	//   .prologue      the code of the snippets running before the function, see snippets.go
+	//   .epilogue      the code of the snippets running after the inspection
 	tmpl = `
 /* BEGIN_ERRGOTRACE */
-	{{.resultvars}} := {{if .callreceiver}}{{.callreceiver}}.{{end}}__{{.fname}}({{.callparams}})
-	__errgotrace.InspectReturnValues("{{.outputfname}}", {{.resultvars}})
-	return {{.resultvars}}
+	{{.prologue}}{{if .timing}}__start := __errgotrace.Now()
+	{{end}}{{.resultvars}} := {{if .callreceiver}}{{.callreceiver}}.{{end}}__{{.fname}}{{.typeargs}}({{.callparams}})
+	{{.inspect}}
+	{{.epilogue}}return {{.resultvars}}
 }
 
-func {{.receiver}}__{{.fname}}{{.params}}{{.returns}} {
+func {{.receiver}}__{{.fname}}{{.typeparams}}{{.params}}{{.returns}} {
 	/* END_ERRGOTRACE */
 `
 	cmdMessagePrefix =
 `Errgotrace modifies go files to include code for tracing go errors.
 
-usage: errgotrace [flags] [path ...]
+usage: errgotrace <command> [flags] [path|glob ...]
+       errgotrace [flags] [path|glob ...]
+
+Commands:
+%s
+Run 'errgotrace help <command>' for the flags of a command.
+Without a command errgotrace adds tracing code, or removes it if -r is given:
+
 `
 
 	cmdMessageSuffix = `
+Paths may be globs, they are expanded by errgotrace itself, ** matches any number of directories.
+
 Examples:
   Add tracing code to all go files in the current directory.
-  $ find . -name '*.go' -print0 | xargs -0 errgotrace -w
+  $ errgotrace add -w './**/*.go'
 
   Add tracing code to all go files in the current directory.
   Exclude vendor dir.
-  $ find . -path ./vendor -prune -o -name '*.go' -print0 | xargs -0 errgotrace -w
+  $ find . -path ./vendor -prune -o -name '*.go' -print | errgotrace add -w -files -
+
+  Only add tracing code to the methods of *Client in the storage and billing packages, except for mocks.
+  $ errgotrace add -w -filter-any '^storage\.' -filter-any '^billing\.' -filter '\.\*Client\.' -exclude Mock './**/*.go'
+
+  Add tracing code to all functions taking a context and returning only an error.
+  $ errgotrace add -w -params context.Context -returns error './**/*.go'
+
+  Remove all tracing code from all go files in the internal directory.
+  $ errgotrace remove -w 'internal/**/*.go'
 
-  Remove all tracing code from all go files in the current directory.
-  $ find . -path ./vendor -prune -o -name '*.go' -print0 | xargs -0 errgotrace -w -r
+  Run the tests with tracing code, the files are restored afterwards.
+  $ errgotrace run './**/*.go' -- go test ./...
+
+  Fail if any go file still contains tracing code.
+  $ errgotrace check './**/*.go'
 `
 
+	// Names of arguments that likely hold secrets
+	defaultRedact = `(?i)passw|secret|token|credential|api_?key|private_?key`
+
 	beginRegex = regexp.MustCompile("^\\s*/\\* BEGIN_ERRGOTRACE \\*/\\s*")
 
 	endRegex = regexp.MustCompile("^\\s*/\\* END_ERRGOTRACE \\*/\\s*")
+
+	// code inserted in the middle of a line, see inlineCode
+	inlineRegex = regexp.MustCompile(`\s*/\* BEGIN_ERRGOTRACE \*/.*?/\* END_ERRGOTRACE \*/\s*`)
+
+	// source replaced by inline code, see nameResults
+	originalRegex = regexp.MustCompile(`/\* ERRGOTRACE_ORIGINAL (.*?) \*/`)
+
+	// a one-line function expanded by its tracing code, see onelineCode
+	onelineRegex = regexp.MustCompile(`^/\* ERRGOTRACE_ONELINE (".*") \*/$`)
 )
 
 var (
 	fset         *token.FileSet
 	funcTemplate *template.Template
+	funcTemplateSource string
+	rulesSource  []byte
 	exportedOnly bool
 	writeFiles   bool
 	reverseProcess   bool
-	filterFlag   string
-	excludeFlag  string
+	filterFlag   regexFlags
+	filterAny    regexFlags
+	excludeFlag  regexFlags
+	returnsFlag  typeFlags
+	paramsFlag   typeFlags
+	minLines     int
+	minBranches  int
+	withMocks    bool
+	filesFlag    string
+	templateFlag string
+	reportFlag   string
+	showProgress bool
+	useCache     bool
+	verifyBuild  bool
+	typeCheck    bool
+	logArgs      bool
+	logReceiver  bool
+	rulesFlag    string
+	decideFlag   string
+	redactFlag   string
+	patchFlag    string
+	outDir       string
+	listFuncs    bool
+	listJSON     bool
+	sourceMaps   bool
 	formatLength int
 	timing       bool
-
-	filter  *regexp.Regexp
-	exclude *regexp.Regexp
+	passContext  bool
+	httpHandlers bool
+	grpcServers  bool
+	goroutines   bool
+	traceCalls   bool
+	trackDepth   bool
+	modeFlag     string
+	stableNames  bool
+	promotedMethods bool
+	wrapClosures bool
+
+	filter  *funcFilter
+	redact  *regexp.Regexp
+	cache   *outputCache
+	rules   *ruleSet
+	decideCmd *decider
+	patch   *patchSet
+	tx      *transaction
+
+	// set by serve, only the functions with these names are instrumented
+	onlyFuncs map[string]bool
+
+	// the flag set of the running command
+	activeFlags *flag.FlagSet
 )
 
 // convert function parameters to a list of names
@@ -95,18 +193,137 @@ func paramNames(params *ast.FieldList) []string {
 	return p
 }
 
+// Get the name of the first parameter of type context.Context, if any.
+// Only the usual import name context is recognized.
+func contextParam(params *ast.FieldList) string {
+	for _, f := range params.List {
+		sel, ok := f.Type.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Context" {
+			continue
+		}
+		if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "context" {
+			continue
+		}
+		for _, n := range f.Names {
+			if n.Name != "_" {
+				return n.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Get the name of the *http.Request parameter of a function that also takes an http.ResponseWriter,
+// i.e. HTTP handlers. Only the usual import name http is recognized.
+func requestParam(params *ast.FieldList) string {
+	isHTTP := func(t ast.Expr, name string) bool {
+		sel, ok := t.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != name {
+			return false
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		return ok && pkg.Name == "http"
+	}
+
+	writer, req := false, ""
+	for _, f := range params.List {
+		if isHTTP(f.Type, "ResponseWriter") {
+			writer = true
+		}
+		if star, ok := f.Type.(*ast.StarExpr); ok && isHTTP(star.X, "Request") {
+			for _, n := range f.Names {
+				if n.Name != "_" {
+					req = n.Name
+				}
+			}
+		}
+	}
+
+	if !writer {
+		return ""
+	}
+	return req
+}
+
+type resultKind int
+
+const (
+	notError resultKind = iota
+	isError
+	mayBeError
+)
+
+// Decide from the declared type of a result, if it may hold an error.
+// Predeclared types other than error and unnamed composite types other than structs,
+// which could embed an error, have no methods.
+func errorKind(t ast.Expr) resultKind {
+	switch t := t.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "error":
+			return isError
+		case "bool", "string", "byte", "rune", "uintptr",
+			"int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64",
+			"float32", "float64", "complex64", "complex128":
+			return notError
+		}
+	case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType:
+		return notError
+	case *ast.ParenExpr:
+		return errorKind(t.X)
+	}
+	return mayBeError
+}
+
 // Generate the debug code for a function. Will get injected just below the function def.
-func generateDebugCode(funcName string, f *ast.FuncDecl, orig []byte) ([]byte) {
+// In defer mode named holds the results to inspect, see nameResults, it is nil for wrapping the function.
+func generateDebugCode(funcName string, f *ast.FuncDecl, orig []byte, opts funcOptions, named []string) ([]byte, error) {
 	vals := make(map[string]string)
 	vals["outputfname"] = funcName
 
+	// deferred calls at the beginning of the function, they run in reverse order
+	var defers []string
+	if opts.Calls {
+		defers = append(defers, fmt.Sprintf("__errgotrace.Enter(%s).Exit()", strconv.Quote(funcName)))
+	} else if opts.Depth {
+		defers = append(defers, fmt.Sprintf("__errgotrace.Track(%s).Exit()", strconv.Quote(funcName)))
+	}
+
+	// HTTP handlers report panics together with the request
+	reqParam := ""
+	if opts.HTTP {
+		reqParam = requestParam(f.Type.Params)
+	}
+	if reqParam != "" {
+		defers = append(defers, fmt.Sprintf("__errgotrace.RecoverRequest(%s, %s)", strconv.Quote(funcName), reqParam))
+	}
+
 	// Don't alter functions that have no return values.
 	if f.Type.Results == nil || len(f.Type.Results.List) < 1 {
-		return []byte("")
+		prologue, epilogue, err := renderSnippets(opts.Snippets, funcName, f, "")
+		if err != nil {
+			return nil, err
+		}
+		return []byte(deferBlock(prologue, deferEpilogue(epilogue, defers))), nil
 	}
 
 	vals["fname"] = f.Name.String()
 
+	// The backend of a generic function has the same type parameters
+	vals["typeparams"], vals["typeargs"] = "", ""
+	if tp := f.Type.TypeParams; tp != nil {
+		vals["typeparams"] = string(orig[tp.Opening-1:tp.Closing])
+		var names []string
+		for _, field := range tp.List {
+			for _, n := range field.Names {
+				names = append(names, n.Name)
+			}
+		}
+		vals["typeargs"] = "[" + strings.Join(names, ", ") + "]"
+	}
+	vals["goversion"] = moduleGoVersion(fset.Position(f.Pos()).Filename).String()
+
 	// Get the list with return values
 	vals["returns"] = string(orig[f.Type.Results.Pos()-1:f.Type.Results.End()])
 
@@ -132,31 +349,46 @@ func generateDebugCode(funcName string, f *ast.FuncDecl, orig []byte) ([]byte) {
 	if f.Recv != nil && len(f.Recv.List) > 0 {
 		// For unnamed receivers do not use the receiver in the backend function
 		// but instead prepend the name of the receiver tpye to the function
-		if len(f.Recv.List[0].Names) < 1 || f.Recv.List[0].Names[0].Name == "_" {
-			t := string(orig[f.Recv.List[0].Type.Pos()-1:f.Recv.List[0].Type.End()-1])
-			t = strings.Replace(t, "*", "__", -1)
-			t = strings.Replace(t, "*", "_s", -1)
-			t = strings.Replace(t, "[", "_o", -1)
-			t = strings.Replace(t, "]", "_c", -1)
-			vals["fname"] = t + "_" + vals["fname"]
+		if unnamedReceiver(f) && !genericReceiver(f.Recv.List[0].Type) {
+			vals["fname"] = mangleReceiver(f.Recv.List[0].Type) + "_" + vals["fname"]
 		} else {
 			vals["receiver"] = string(orig[f.Recv.Pos()-1:f.Recv.End()-1])
 		}
 	}
 
-	// Generate a set of variables that can hold the result of the function call
+	// Generate a set of variables that can hold the result of the function call.
+	// Only results that may hold an error need to be inspected, if all of them are
+	// of type error the runtime is only called if one of them is not nil.
 	vals["resultvars"] = ""
 	sep = ""
 	i := 0
+	var inspectVars, guards, closures []string
+	guarded := true
 	for _, field := range f.Type.Results.List {
 		for j := 0; j == 0 || (field.Names != nil && j < len(field.Names)); j++ {
-			vals["resultvars"] += sep + "__result" + strconv.Itoa(i)
+			name := "__result" + strconv.Itoa(i)
+			vals["resultvars"] += sep + name
 			sep = ", "
 			i++
+
+			// returned functions are wrapped, so the errors of their calls are logged too
+			if ft, ok := errorClosure(field.Type); ok && opts.Closures && named == nil {
+				closures = append(closures, wrapClosure(funcName+".func"+strconv.Itoa(len(closures)+1), name, ft, orig))
+			}
+
+			switch errorKind(field.Type) {
+			case isError:
+				inspectVars = append(inspectVars, name)
+				guards = append(guards, name+" != nil")
+			case mayBeError:
+				inspectVars = append(inspectVars, name)
+				guarded = false
+			}
 		}
 	}
 
 	// Generate the receiver for the function call to use, if any
+	vals["callreceiver"] = ""
 	if f.Recv != nil && len(f.Recv.List) > 0 {
 		for _, r := range f.Recv.List {
 			// Ignore unanmed receivers.
@@ -164,6 +396,10 @@ func generateDebugCode(funcName string, f *ast.FuncDecl, orig []byte) ([]byte) {
 				vals["callreceiver"] = r.Names[0].Name
 			}
 		}
+		// the backend of a generic type needs its type parameters, it is called on the zero value
+		if unnamedReceiver(f) && genericReceiver(f.Recv.List[0].Type) {
+			vals["callreceiver"] = "(*new(" + string(orig[f.Recv.List[0].Type.Pos()-1:f.Recv.List[0].Type.End()-1]) + "))"
+		}
 	}
 
 	// Generate the paramaters for the function call
@@ -187,13 +423,147 @@ func generateDebugCode(funcName string, f *ast.FuncDecl, orig []byte) ([]byte) {
 		}
 	}
 
+	// The context is only passed for functions that have one
+	ctxParam := ""
+	if opts.Context {
+		ctxParam = contextParam(f.Type.Params)
+	}
+
+	// In defer mode the named results are inspected by address when the function returns,
+	// instead of calling a second function
+	deferred := named != nil
+	if deferred {
+		inspectVars = nil
+		for _, n := range named {
+			inspectVars = append(inspectVars, "&"+n)
+		}
+	}
+
+	resultvars := vals["resultvars"]
+	if deferred {
+		resultvars = strings.Join(named, ", ")
+	}
+	prologue, epilogue, err := renderSnippets(opts.Snippets, funcName, f, resultvars)
+	if err != nil {
+		return nil, err
+	}
+	vals["prologue"], vals["epilogue"] = prologue, epilogue
+
+	// Generate the call to the runtime, only use the extended form if there are any options
+	vals["timing"] = ""
+	if !opts.extended() && ctxParam == "" && reqParam == "" {
+		inspect := "InspectReturnValues"
+		if deferred {
+			inspect = "InspectNamed"
+		}
+		vals["inspect"] = fmt.Sprintf("__errgotrace.%s(%s, %s)", inspect, strconv.Quote(funcName), strings.Join(inspectVars, ", "))
+	} else {
+		call := "Func: " + strconv.Quote(funcName)
+		if deferred && opts.Timing {
+			// the arguments of the deferred call are evaluated right away
+			call += ", Start: __errgotrace.Now()"
+		} else if opts.Timing {
+			vals["timing"] = "true"
+			call += ", Start: __start"
+		}
+		if opts.Args {
+			// Redacted values are replaced right here, so they never reach the runtime
+			var names, args []string
+			for _, n := range paramNames(f.Type.Params) {
+				names = append(names, strconv.Quote(n))
+				if opts.redacted(n) {
+					args = append(args, "__errgotrace.Redacted")
+				} else {
+					args = append(args, n)
+				}
+			}
+			call += ", ArgNames: []string{" + strings.Join(names, ", ") + "}"
+			call += ", Args: []interface{}{" + strings.Join(args, ", ") + "}"
+		}
+		if opts.Stack {
+			call += ", Stack: true"
+		}
+		if ctxParam != "" {
+			call += ", Ctx: " + ctxParam
+		}
+		if reqParam != "" {
+			call += ", Request: " + reqParam
+		}
+		if opts.Receiver && vals["callreceiver"] != "" && !unnamedReceiver(f) {
+			call += ", Receiver: " + vals["callreceiver"]
+			if len(opts.Fields) > 0 {
+				var names []string
+				for _, n := range opts.Fields {
+					names = append(names, strconv.Quote(n))
+				}
+				call += ", ReceiverFields: []string{" + strings.Join(names, ", ") + "}"
+			}
+		}
+		inspect := "InspectCall"
+		if deferred {
+			inspect = "InspectNamedCall"
+		}
+		vals["inspect"] = fmt.Sprintf("__errgotrace.%s(&__errgotrace.Call{%s}, %s)", inspect, call, strings.Join(inspectVars, ", "))
+	}
+
+	if deferred {
+		defers = deferEpilogue(epilogue, defers)
+		if len(inspectVars) > 0 {
+			defers = append(defers, vals["inspect"])
+		}
+		return []byte(deferBlock(prologue, defers)), nil
+	}
+
 	var enterBuffer bytes.Buffer
-	err := funcTemplate.Execute(&enterBuffer, vals)
+	enterBuffer.WriteString(deferBlock("", defers))
+
+	if len(inspectVars) < 1 {
+		vals["inspect"] = ""
+		vals["timing"] = ""
+	} else if guarded {
+		// with timing successful calls are inspected too if they were slow
+		if vals["timing"] != "" {
+			guards = append(guards, "__errgotrace.Slow(__start)")
+		}
+		vals["inspect"] = "if " + strings.Join(guards, " || ") + " {\n" + vals["inspect"] + "\n}"
+	}
+	if len(closures) > 0 {
+		if vals["inspect"] != "" {
+			closures = append([]string{vals["inspect"]}, closures...)
+		}
+		vals["inspect"] = strings.Join(closures, "\n")
+	}
+
+	if stableShim(f, named) {
+		return generateShim(f, orig, vals, defers), nil
+	}
+
+	err = funcTemplate.Execute(&enterBuffer, vals)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return enterBuffer.Bytes()
+	return enterBuffer.Bytes(), nil
+}
+
+// Generate the block deferring the given calls after the prologue of the snippets, empty if there is neither.
+func deferBlock(prologue string, calls []string) string {
+	if prologue == "" && len(calls) < 1 {
+		return ""
+	}
+	block := "\n/* BEGIN_ERRGOTRACE */\n" + prologue
+	for _, c := range calls {
+		block += "\tdefer " + c + "\n"
+	}
+	return block + "\t/* END_ERRGOTRACE */\n"
+}
+
+// Without a wrapper the epilogue of the snippets is deferred first, so it runs after the other deferred calls.
+func deferEpilogue(epilogue string, calls []string) []string {
+	if epilogue == "" {
+		return calls
+	}
+	return append([]string{"func() {\n" + epilogue + "}()"}, calls...)
 }
 
 type edit struct {
@@ -203,20 +573,184 @@ type edit struct {
 
 type editList struct {
 	edits       []edit
+	filename    string
 	packageName string
 	orig 		[]byte
+	stats       *fileStats
+	err         error
+
+	// import name of grpc and the number of servers the interceptors were added to
+	grpcName    string
+	grpcServers int
+
+	// name of the function declaration being inspected, for naming goroutines
+	current     string
+
+	// set if the file holds mocks or fakes
+	mocks       bool
+
+	// the package qualified by its import path, for the names in the output
+	qualified   string
+
+	// the file and, for -promoted, the methods of its package by receiver type
+	file        *ast.File
+	methods     map[string][]*method
+}
+
+// Get the name a function is logged with, package.Func becomes import/path.Func.
+func (e *editList) outputName(name string) string {
+	return e.qualified + strings.TrimPrefix(name, e.packageName)
 }
 
 func (e *editList) Add(pos int, val []byte) {
 	e.edits = append(e.edits, edit{pos: pos, val: val})
 }
 
+// Remember the first error and stop the inspection.
+func (e *editList) fail(err error) bool {
+	if e.err == nil {
+		e.err = err
+	}
+	return false
+}
+
+// Describe a function for the decision whether to instrument it.
+func (e *editList) describe(f *ast.FuncDecl) *candidate {
+	c := &candidate{
+		Package:  e.packageName,
+		Path:     fileImportPath(e.filename),
+		Func:     f.Name.Name,
+		File:     e.filename,
+		Line:     fset.Position(f.Pos()).Line,
+		Lines:    fset.Position(f.End()).Line - fset.Position(f.Pos()).Line + 1,
+		Exported: ast.IsExported(f.Name.Name),
+	}
+
+	// function name = package + receiverType + function ident
+	c.Name = e.packageName
+	if f.Recv != nil && len(f.Recv.List) > 0 {
+		c.Receiver = string(e.orig[f.Recv.List[0].Type.Pos()-1:f.Recv.List[0].Type.End()-1])
+		c.Name += "." + c.Receiver
+	}
+	c.Name += "." + f.Name.Name
+
+	c.Signature = "func" + string(e.orig[f.Type.Params.Pos()-1:f.Type.End()-1])
+	c.Branches = countBranches(f.Body)
+	c.ParamTypes = fieldTypes(f.Type.Params)
+	c.ResultTypes = fieldTypes(f.Type.Results)
+	c.Handler = requestParam(f.Type.Params) != ""
+	c.Mock = e.mocks || mockReceiver(c.Receiver)
+	if f.Type.Results != nil {
+		c.Results = f.Type.Results.NumFields()
+		for _, r := range f.Type.Results.List {
+			if id, ok := r.Type.(*ast.Ident); ok && id.Name == "error" {
+				c.ReturnsError = true
+			}
+		}
+	}
+
+	return c
+}
+
+// Count the branches of a function body: conditions, loops, cases and the operands of && and ||.
+// Function literals in the body are counted as part of the function.
+func countBranches(body *ast.BlockStmt) int {
+	n := 0
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			n++
+		case *ast.CaseClause:
+			if node.List != nil {
+				n++
+			}
+		case *ast.CommClause:
+			if node.Comm != nil {
+				n++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
+
+// The options of the generated code given by the flags
+func flagOptions() funcOptions {
+	return funcOptions{Timing: timing, Args: logArgs, Receiver: logReceiver, Context: passContext, HTTP: httpHandlers, Calls: traceCalls, Depth: trackDepth, Closures: wrapClosures}
+}
+
+// Decide if a function gets instrumented, opts may be changed for the generated code.
+func selectFunction(c *candidate, opts *funcOptions) (bool, error) {
+	// Skip functions, if they don't match the given filters or match an exclude filter
+	if !filter.match(c) || (onlyFuncs != nil && !onlyFuncs[c.Name]) {
+		return false, nil
+	}
+
+	if exportedOnly && !c.Exported {
+		return false, nil
+	}
+	if publicAPI && !publicFunction(c) {
+		return false, nil
+	}
+
+	// Tracing test doubles only produces noise
+	if c.Mock && !withMocks {
+		return false, nil
+	}
+
+	// Skip trivial functions like getters
+	if c.Lines < minLines || c.Branches < minBranches {
+		return false, nil
+	}
+
+	// Skip functions that have no return values, HTTP handlers can still log their panics
+	// and calls are traced for all functions
+	if c.Results < 1 && !(opts.HTTP && c.Handler) && !opts.Calls && !opts.Depth {
+		return false, nil
+	}
+
+	if rules != nil && !rules.decide(c, opts) {
+		return false, nil
+	}
+
+	// The external command has the last word
+	if decideCmd != nil {
+		return decideCmd.decide(c, opts)
+	}
+
+	return true, nil
+}
+
 // Check if given ast node is a function, if so generate the debug code for it.
 func (e *editList) inspect(node ast.Node) bool {
 	if node == nil {
 		return false
 	}
 
+	if call, ok := node.(*ast.CallExpr); ok {
+		if e.grpcName != "" {
+			e.wireInterceptors(call)
+		}
+		if goroutines {
+			e.traceGoCall(call)
+		}
+		return true
+	}
+
+	if d, ok := node.(*ast.GenDecl); ok && promotedMethods {
+		e.tracePromoted(d)
+		return true
+	}
+
+	if g, ok := node.(*ast.GoStmt); ok && goroutines {
+		e.traceGoStmt(g)
+		return true
+	}
+
 	// Check if given node is a function
 	var f *ast.FuncDecl
 	var ok bool
@@ -229,93 +763,197 @@ func (e *editList) inspect(node ast.Node) bool {
 		return true
 	}
 
-	// function name = package + receiverType + function ident
-	funcName := e.packageName
-	if f.Recv != nil && len(f.Recv.List) > 0 {
-		funcName += "." + string(e.orig[f.Recv.List[0].Type.Pos()-1:f.Recv.List[0].Type.End()-1])
+	// The backend of generic functions needs type parameters, which older modules can't compile
+	if f.Type.TypeParams != nil && !moduleGoVersion(e.filename).atLeast(1, 18) {
+		e.stats.Skipped = append(e.stats.Skipped, e.describe(f).Name)
+		return true
 	}
-	funcName += "." + f.Name.Name
 
-	// Skip functions, if they don't match the given filter
-	if !filter.MatchString(funcName) {
+	// Calls of methods can't be rewritten to a shim without type information, wrapping them
+	// would rename them, so they are left alone
+	if stableNames && f.Recv != nil && modeFlag != "defer" {
+		e.stats.Skipped = append(e.stats.Skipped, e.describe(f).Name)
 		return true
 	}
 
-	// Skip functions, if they match the given filter
-	if exclude != nil && exclude.MatchString(funcName) {
-		return true
+	c := e.describe(f)
+	funcName := c.Name
+	e.current = e.outputName(funcName)
+
+	dirs, err := parseDirectives(f)
+	if err != nil {
+		return e.fail(fmt.Errorf("line %d: %s", c.Line, err))
 	}
 
-	if exportedOnly && !ast.IsExported(funcName) {
+	// Directives override the filters, but functions without results can never be traced,
+	// except for HTTP handlers and calls
+	opts := flagOptions()
+	selected := dirs.trace && (c.Results > 0 || opts.Calls || dirs.opts.Calls || opts.Depth || dirs.opts.Depth || c.Handler && (opts.HTTP || dirs.opts.HTTP))
+	if !dirs.trace && !dirs.skip {
+		selected, err = selectFunction(c, &opts)
+	}
+	if err != nil {
+		return e.fail(err)
+	}
+	if !selected {
+		e.stats.Skipped = append(e.stats.Skipped, funcName)
 		return true
 	}
 
-	injection := generateDebugCode(funcName, f, e.orig)
-	e.Add(int(f.Body.Lbrace), injection)
+	dirs.apply(&opts)
+
+	// functions whose results can't be named are wrapped in defer mode, too
+	var named []string
+	if modeFlag == "defer" && c.Results > 0 {
+		named, _ = e.nameResults(f)
+	}
+
+	injection, err := generateDebugCode(e.outputName(funcName), f, e.orig, opts, named)
+	if err != nil {
+		return e.fail(fmt.Errorf("template error (%s)", err))
+	}
+	if stableShim(f, named) {
+		e.Add(int(f.End())-1, injection)
+	} else {
+		e.Add(int(f.Body.Lbrace), injection)
+	}
+	e.stats.Instrumented = append(e.stats.Instrumented, funcName)
+	e.stats.candidates = append(e.stats.candidates, c)
 
 	return true
 }
 
 // process file
-func annotateFile(file string) error {
+func annotateFile(file string) (*fileStats, error) {
 	orig, err := ioutil.ReadFile(file)
 	if err != nil {
-		return fmt.Errorf("%s: failed to open (%s)", file, err)
+		return nil, fileErrorf(file, phaseRead, "failed to open (%s)", err)
+	}
+
+	// the cache doesn't keep the descriptions of the functions
+	if listFuncs {
+		_, stats, err := annotate(file, orig)
+		if err == nil {
+			err = listFunctions(stats.candidates)
+		}
+		return stats, err
 	}
 
-	src, err := annotate(file, orig)
+	annotateSrc := cachedAnnotate
+	if selectingFuncs() {
+		annotateSrc = annotateSelected
+	}
+	src, stats, err := annotateSrc(file, orig)
 	if err != nil {
-		return err
+		return stats, err
 	}
 
-	if !writeFiles {
+	if patch != nil {
+		patch.add(file, orig, src)
+	} else if outDir != "" {
+		if sourceMaps {
+			if err := writeOutput(file+sourceMapSuffix, sourceMapData(file, orig, src)); err != nil {
+				return stats, err
+			}
+		}
+		return stats, writeOutput(file, src)
+	} else if !writeFiles {
 		fmt.Println(string(src))
 	} else {
-		err = ioutil.WriteFile(file, src, 0)
-		if err != nil {
-			return fmt.Errorf("%s: failed to write (%s)", file, err)
+		tx.stage(file, orig, src)
+		if sourceMaps {
+			stageSourceMap(file, orig, src)
 		}
 	}
 
-	return nil
+	return stats, nil
 }
 
 // process the contents of a go file
-func annotate(filename string, orig []byte) ([]byte, error) {
-	// we need to make sure the source is formatted to insert the new code in the expected place
-	orig, err := format.Source(orig)
-	if err != nil {
-		return nil, fmt.Errorf("%s: formatting error (%s)", filename, err.Error())
-	}
+func annotate(filename string, orig []byte) ([]byte, *fileStats, error) {
+	stats := &fileStats{File: filename}
 
+	// we need to make sure the source is formatted to insert the new code in the expected place,
+	// sources that are formatted already, like most generated code, are only parsed once
+	input := orig
 	fset = token.NewFileSet()
 	f, err := parser.ParseFile(fset, filename, orig, parser.ParseComments)
 	if err != nil {
-		return nil, err
+		return nil, stats, fileErrorf(filename, phaseParse, "formatting error (%s)", strings.TrimPrefix(err.Error(), filename+":"))
+	}
+
+	var formatted bytes.Buffer
+	formatted.Grow(len(orig))
+	if err := format.Node(&formatted, fset, f); err != nil {
+		return nil, stats, fileErrorf(filename, phaseParse, "formatting error (%s)", err.Error())
+	}
+	if !bytes.Equal(formatted.Bytes(), orig) {
+		orig = formatted.Bytes()
+		fset = token.NewFileSet()
+		f, err = parser.ParseFile(fset, filename, orig, parser.ParseComments)
+		if err != nil {
+			return nil, stats, fileErrorf(filename, phaseParse, "%s", err)
+		}
 	}
 
 	for _, imp := range f.Imports {
 		if imp.Name != nil && imp.Name.Name == importName {
-			return nil, fmt.Errorf("%s: already processed", filename)
+			return nil, stats, fileErrorf(filename, phaseAnnotate, "already processed")
 		}
 	}
 
-	edits := editList{packageName: f.Name.Name, orig : orig}
+	edits := editList{filename: filename, packageName: f.Name.Name, orig : orig, stats: stats, mocks: mockFile(filename, f), file: f, qualified: qualifiedPackage(filename, f.Name.Name)}
+	if grpcServers {
+		edits.grpcName = grpcImportName(f)
+	}
 
-	// insert our import directly after the package line
-	edits.Add(int(f.Name.End()), []byte(importStmt))
+	// insert our import into the import block, see importPosition, or make one out of a single import
+	importPos, inBlock := importPosition(f, orig)
+	single, isSingle := singleImport{}, false
+	if !inBlock {
+		single, isSingle = findSingleImport(f, orig)
+	}
+	if !isSingle {
+		edits.Add(importPos, []byte(importCode(importStmt, inBlock)))
+	}
 
 	ast.Inspect(f, edits.inspect)
+	if edits.err != nil {
+		return nil, stats, fileErrorf(filename, phaseAnnotate, "%s", edits.err)
+	}
 
-	var buf bytes.Buffer
-	if err := format.Node(&buf, fset, f); err != nil {
-		return nil, fmt.Errorf("%s: format.Node (%s)", filename, err.Error())
+	// the interceptors need context, right after our own import
+	if edits.grpcServers > 0 && !isSingle {
+		edits.Add(importPos, []byte(importCode(grpcImportStmt, inBlock)))
+	}
+	if isSingle {
+		stmts := []string{importStmt}
+		if edits.grpcServers > 0 {
+			stmts = append(stmts, grpcImportStmt)
+		}
+		before, after := single.code(stmts...)
+		edits.Add(single.start, []byte(before))
+		edits.Add(single.end, []byte(after))
 	}
 
-	data := buf.Bytes()
+	// the removal puts back the one-line functions the tracing code expands
+	for _, start := range oneLiners(f, edits.edits) {
+		edits.Add(start, []byte(onelineCode(orig, start)))
+	}
+
+	// code around function literals is added before the code inside of them
+	sort.SliceStable(edits.edits, func(i, j int) bool { return edits.edits[i].pos < edits.edits[j].pos })
+
+	// the positions of the edits are offsets into the formatted source
+	data := orig
+	setupSrc := setupCode()
+	size := len(data) + len(setupSrc) + len(grpcInterceptorFuncs)
+	for _, e := range edits.edits {
+		size += len(e.val)
+	}
 
 	var pos int
-	var out []byte
+	out := make([]byte, 0, size)
 	for _, e := range edits.edits {
 		out = append(out, data[pos:e.pos]...)
 		out = append(out, []byte(e.val)...)
@@ -324,22 +962,28 @@ func annotate(filename string, orig []byte) ([]byte, error) {
 	out = append(out, data[pos:]...)
 
 	// it's easier to append the setup code at the end
-	out = append(out, []byte(setup)...)
+	out = append(out, []byte(setupSrc)...)
+	if edits.grpcServers > 0 {
+		out = append(out, []byte(fmt.Sprintf(grpcInterceptorFuncs, edits.grpcName))...)
+	}
 
 	src, err := format.Source(out)
 	if err != nil {
-		return nil, fmt.Errorf("%s: formatting error (%s)", filename, err.Error())
+		return nil, stats, fileErrorf(filename, phaseAnnotate, "formatting error (%s)", err.Error())
 	}
+	src = keepHeader(input, src)
 
-	return src, nil
+	stats.BytesAdded = len(src) - len(input)
+	return src, stats, nil
 }
 
 func init() {
-	funcTemplate = template.Must(template.New("debug").Parse(tmpl))
+	funcTemplateSource = tmpl
+	funcTemplate = template.Must(template.New("debug").Option("missingkey=error").Parse(tmpl))
 }
 
-// Remove tracking code from file
-func reverseFile(filename string) error {
+// Remove the tracing code from a go source
+func reverse(orig []byte) (string, error) {
 	type tState int
 	const (
 		NORMAL tState = iota
@@ -347,17 +991,27 @@ func reverseFile(filename string) error {
 		ERRGOTRACE
 	)
 
-	f, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("%s: failed to open (%s)", filename, err)
-	}
-
 	var state tState = NORMAL
 
-	out := ""
-	scanner := bufio.NewScanner(f)
+	// markers are only recognized as comments, see markerComments
+	markers := markerComments(orig)
+	offset := 0
+
+	// the line of a one-line function, and whether the lines of its expansion are skipped
+	var oneline string
+	var expanded bool
+
+	var out strings.Builder
+	out.Grow(len(orig))
+	scanner := bufio.NewScanner(bytes.NewReader(orig))
+	scanner.Buffer(nil, len(orig)+1)
+	scanner.Split(scanRawLines)
 	for scanner.Scan() {
-		line := scanner.Text()
+		start := offset
+		offset += len(scanner.Bytes())
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		line = maskLookalikes(line, func(i int) bool { return markers[start+i] })
+
 		if state == NORMAL_ENTER {
 			if line != "" {
 				state = NORMAL
@@ -365,10 +1019,25 @@ func reverseFile(filename string) error {
 		}
 
 		if state == NORMAL {
-			if beginRegex.MatchString(line) {
+			line = originalRegex.ReplaceAllString(line, "$1")
+			line = stripInline(line)
+			switch m := onelineRegex.FindStringSubmatch(line); {
+			case beginRegex.MatchString(line):
 				state = ERRGOTRACE
-			} else {
-				out += line + "\n"
+			case m != nil:
+				if l, err := strconv.Unquote(m[1]); err == nil {
+					oneline = unmaskLookalikes(l)
+					out.WriteString(oneline + "\n")
+				}
+			case oneline != "":
+				// formatting may have left the function on its line
+				expanded = unmaskLookalikes(line) != oneline
+				oneline = ""
+			case expanded:
+				expanded = !strings.HasPrefix(line, "}")
+			default:
+				out.WriteString(unmaskLookalikes(line))
+				out.WriteString("\n")
 			}
 		}
 
@@ -379,69 +1048,402 @@ func reverseFile(filename string) error {
 		}
 	}
 
-	out = strings.TrimRight(out, "\n")
+	// the file ends like the original, the blank lines before the removed setup are dropped
+	result := strings.TrimRight(out.String(), "\n")
+	if bytes.HasSuffix(orig, []byte("\n")) {
+		result += "\n"
+	}
+
+	return result, scanner.Err()
+}
+
+// Split lines like bufio.ScanLines, but keep the line endings, so the offsets of the lines are known.
+func scanRawLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Remove tracking code from file
+func reverseFile(filename string) (*fileStats, error) {
+	stats := &fileStats{File: filename}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("%s: failed to read (%s)", filename, err)
+	orig, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return stats, fileErrorf(filename, phaseRead, "failed to open (%s)", err)
 	}
 
-	if !writeFiles {
+	var out string
+	if partialRemoval() {
+		out, err = reverseSelected(filename, orig)
+		if err != nil {
+			return stats, fileErrorf(filename, phaseRemove, "%s", err)
+		}
+	} else {
+		out, err = reverse(orig)
+		if err != nil {
+			return stats, fileErrorf(filename, phaseRemove, "failed to read (%s)", err)
+		}
+	}
+
+	stats.BytesAdded = len(out) - len(orig)
+
+	if patch != nil {
+		patch.add(filename, orig, []byte(out))
+	} else if outDir != "" {
+		return stats, writeOutput(filename, []byte(out))
+	} else if !writeFiles {
 		fmt.Print(out)
 	} else {
-		err = ioutil.WriteFile(filename, []byte(out), 0)
+		tx.stage(filename, orig, []byte(out))
+		// the source map doesn't match anymore
+		stageSourceMap(filename, nil, nil)
+	}
+
+	return stats, nil
+}
+
+// register the flags for selecting the files to process
+func registerPathFlags(fs *flag.FlagSet) {
+	fs.StringVar(&filesFlag, "files", "", "read a newline-delimited list of paths from the given file, - for stdin")
+	fs.BoolVar(&walkTestdata, "testdata", false, "also descend into testdata directories when expanding **, which are skipped like by the go tool")
+	fs.BoolVar(&walkHidden, "hidden", false, "also descend into directories starting with _ or . when expanding **")
+	fs.BoolVar(&walkIgnored, "ignored", false, "also process files matched by globs that are excluded with //go:build ignore")
+}
+
+// register the flags for selecting the functions to annotate and the code to inject
+func registerAnnotateFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&exportedOnly, "exported", false, "only annotate exported functions")
+	fs.BoolVar(&publicAPI, "public-api", false, "only annotate the API of the module: exported functions and methods of exported types, without main, internal and vendored packages and tests")
+	fs.BoolVar(&withMocks, "mocks", false, "also annotate mocks and fakes, e.g. of gomock, mockery and counterfeiter, which are skipped by default")
+	fs.IntVar(&minLines, "min-lines", 0, "only annotate functions with at least n lines, including the signature and the closing brace")
+	fs.IntVar(&minBranches, "min-branches", 0, "only annotate functions with at least n branches: if, for, range, case and && or || operands")
+	fs.Var(&filterFlag, "filter", "only annotate functions matching the `regex`, can be repeated and all of them have to match")
+	fs.Var(&filterAny, "filter-any", "only annotate functions matching at least one of the `regex`es given with -filter-any")
+	fs.Var(&returnsFlag, "returns", "only annotate functions with the given `results`, e.g. error or '(*Tx, error)', can be repeated")
+	fs.Var(&paramsFlag, "params", "only annotate functions taking a parameter of the given `type`, e.g. context.Context, can be repeated and all of them have to be taken")
+	fs.Var(&excludeFlag, "exclude", "exclude functions matching the `regex`, can be repeated, takes precedence over the filters")
+	fs.StringVar(&templateFlag, "template", "", "use the text/template in the given file for the injected code")
+	fs.StringVar(&modeFlag, "mode", "wrapper", "wrapper moves the body into a second function, defer inspects named results in a deferred call")
+	fs.BoolVar(&stableNames, "stable-names", false, "with -w, keep the names and bodies of functions and add shims named __traced_<name>, calls in the package are rewritten to them, methods are only traced with -mode defer")
+	fs.BoolVar(&wrapClosures, "closures", false, "wrap returned functions with an error result, e.g. of func New() (func() error, error), so the errors of their calls are logged as pkg.New.func1")
+	fs.BoolVar(&promotedMethods, "promoted", false, "add methods to structs for the methods they promote from embedded types of the package, so their errors are logged with the struct")
+	fs.StringVar(&rulesFlag, "rules", "", "decide which functions to annotate with the rules in the given YAML file")
+	fs.StringVar(&decideFlag, "decide-cmd", "", "ask the given command via JSON on stdin/stdout whether to annotate a function")
+	fs.BoolVar(&timing, "timing", false, "log how long a function ran before returning an error")
+	fs.BoolVar(&logArgs, "args", false, "log the arguments of a function returning an error")
+	fs.BoolVar(&logReceiver, "receiver", false, "log the receiver of a method returning an error")
+	fs.BoolVar(&passContext, "context", false, "pass context.Context parameters to the runtime, so tracing can be scoped with log.WithTracing")
+	fs.BoolVar(&httpHandlers, "http", false, "log the method and path of HTTP handlers returning an error or panicking")
+	fs.BoolVar(&grpcServers, "grpc", false, "add interceptors tracing the errors of all RPCs to grpc.NewServer calls")
+	fs.BoolVar(&traceCalls, "calls", false, "log every call of the annotated functions with ENTER and EXIT events, also for functions without results")
+	fs.BoolVar(&trackDepth, "depth", false, "track the calls of the annotated functions, to indent errors and log their caller, also for functions without results")
+	fs.BoolVar(&goroutines, "goroutines", false, "report panics of go func() {...}() and errors and panics of x.Go(func() error {...}) literals")
+	fs.StringVar(&redactFlag, "redact", defaultRedact, "never log the values of arguments whose name matches the regular expression")
+	fs.Var(metaFlag, "meta", "attach the `key=value` to every event of the program, e.g. commit=$(git rev-parse HEAD), can be repeated, without a value the version is taken from the build info of the program")
+}
+
+// register the flags controlling where the results go
+func registerOutputFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&writeFiles, "w", false, "re-write files in place")
+	fs.StringVar(&reportFlag, "report", "", "write a JSON report with statistics of the run to the given file")
+	fs.BoolVar(&showProgress, "progress", false, "show progress on stderr and print a summary at the end")
+	fs.BoolVar(&useCache, "cache", false, "cache instrumented files in the user cache directory, to skip unchanged files on the next run")
+	fs.StringVar(&patchFlag, "patch", "", "write all changes as one unified patch to the given file instead of modifying files")
+	fs.StringVar(&outDir, "outdir", "", "write the results into the given directory under the base name of every file instead of modifying files, e.g. in Bazel genrules")
+	fs.BoolVar(&listFuncs, "list", false, "only print the functions that would be annotated with their position and signature, nothing is modified")
+	fs.BoolVar(&listJSON, "json", false, "with -list, print every function as a JSON object on its own line")
+	fs.BoolVar(&sourceMaps, "sourcemap", false, "with -w or -outdir, write a file.go"+sourceMapSuffix+" next to every file, mapping the instrumented lines and functions to the original ones")
+	fs.BoolVar(&quiet, "q", false, "only print errors, no progress and summaries")
+	fs.BoolVar(&jsonErrors, "json-errors", false, "print the failures of files as JSON objects with file, phase and message on stderr, one per line")
+	fs.BoolVar(&verifyBuild, "verify", false, "with -w, build the packages of the written files and restore the files that break the build")
+	fs.BoolVar(&typeCheck, "typecheck", false, "with -w, type-check the packages of the written files with go/types and restore the files that break them, faster than -verify without building")
+	fs.StringVar(&policyFlag, "policy", defaultPolicy(), "with -w, refuse to add tracing code to files checked out on git branches matching one of the comma separated `patterns`, e.g. main,release/*, defaults to $ERRGOTRACE_POLICY")
+	fs.BoolVar(&forceFlag, "force", false, "add tracing code despite -policy")
+	fs.BoolVar(&showStat, "stat", false, "with -w, print how many lines and bytes every file grew and the largest generated wrappers")
+	fs.IntVar(&maxGrowth, "max-growth", 0, "with -w, warn about files whose lines grew by more than the given `percent`")
+}
+
+// Load everything the flags for selecting functions and generating code refer to.
+func loadOptions() error {
+	var err error
+	filter, err = compileFilter(filterFlag, filterAny, excludeFlag)
+	if err != nil {
+		return err
+	}
+
+	if redactFlag != "" {
+		redact, err = regexp.Compile(redactFlag)
 		if err != nil {
-			return fmt.Errorf("%s: failed to write (%s)", filename, err)
+			return fmt.Errorf("error in redact regex (%s)", err.Error())
+		}
+	}
+
+	if modeFlag != "wrapper" && modeFlag != "defer" {
+		return fmt.Errorf("unknown mode %q, use wrapper or defer", modeFlag)
+	}
+
+	if templateFlag != "" {
+		data, err := ioutil.ReadFile(templateFlag)
+		if err != nil {
+			return fmt.Errorf("%s: failed to open (%s)", templateFlag, err)
+		}
+
+		funcTemplateSource = string(data)
+		funcTemplate, err = template.New("debug").Option("missingkey=error").Parse(funcTemplateSource)
+		if err != nil {
+			return fmt.Errorf("error in template (%s)", err.Error())
+		}
+	}
+
+	if rulesFlag != "" {
+		rules, rulesSource, err = loadRules(rulesFlag)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func main() {
-	flag.BoolVar(&exportedOnly, "exported", false, "only annotate exported functions")
-	flag.BoolVar(&writeFiles, "w", false, "re-write files in place")
-	flag.StringVar(&filterFlag, "filter", ".", "only annotate functions matching the regular expression")
-	flag.StringVar(&excludeFlag, "exclude", "", "exclude any matching functions, takes precedence over filter")
-	flag.BoolVar(&reverseProcess, "r", false, "reverse the process, remove tracing code")
-	flag.Parse()
+// Add or remove the tracing code of all files given on the command line.
+func processFiles(fs *flag.FlagSet, args []string) int {
+	activeFlags = fs
+	if quiet {
+		showProgress = false
+	}
 
-	if flag.NArg() < 1 {
-		os.Stdout.Write([]byte(cmdMessagePrefix))
-		flag.PrintDefaults()
-		os.Stdout.Write([]byte(cmdMessageSuffix))
-		os.Exit(1)
+	if err := loadOptions(); err != nil {
+		log.Print(err)
+		return 2
 	}
 
 	var err error
-	filter, err = regexp.Compile(filterFlag)
-	if err != nil {
-		log.Printf("error in filter regex (%s)", err.Error())
-		os.Exit(1)
+	if decideFlag != "" {
+		if useCache {
+			log.Print("-cache can not be used with -decide-cmd, the decisions of the command are not cached")
+			return 2
+		}
+
+		decideCmd, err = startDecider(decideFlag)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
 	}
 
-	if excludeFlag != "" {
-		exclude, err = regexp.Compile(excludeFlag)
+	if useCache && promotedMethods {
+		log.Print("-cache can not be used with -promoted, the methods are taken from the other files of the package")
+		return 2
+	}
+
+	if useCache {
+		cache, err = openCache()
 		if err != nil {
-			log.Printf("error in exclude regex (%s)", err.Error())
-			os.Exit(1)
+			log.Print(err)
+			return 1
 		}
 	}
 
+	if patchFlag != "" {
+		patch = &patchSet{}
+	}
+
+	if listFuncs && reverseProcess {
+		log.Print("-list only works when adding tracing code")
+		return 2
+	}
+
+	// files are only written if all of them could be processed
+	if writeFiles && patch == nil && outDir == "" && !listFuncs {
+		tx = newTransaction()
+	}
+
+	if sourceMaps && tx == nil && outDir == "" {
+		log.Print("-sourcemap needs -w or -outdir")
+		return 2
+	}
+
+	if stableNames && tx == nil && !listFuncs {
+		log.Print("-stable-names needs -w, the calls of all files of a package are rewritten")
+		return 2
+	}
+
+	if (showStat || maxGrowth > 0) && tx == nil {
+		log.Print("-stat and -max-growth need -w")
+		return 2
+	}
+
+	if verifyBuild && tx == nil {
+		log.Print("-verify needs -w, only files written in place can be built")
+		return 2
+	}
+
+	if typeCheck && tx == nil {
+		log.Print("-typecheck needs -w, only files written in place can be type-checked")
+		return 2
+	}
+
+	files, err := collectFiles(args, filesFlag)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	files = withoutRuntime(files)
+
+	if selectingFuncs() && (listFuncs || stableNames) {
+		log.Print("-func and -line can not be used with -list and -stable-names")
+		return 2
+	}
+	if lineFlag > 0 && len(files) != 1 {
+		log.Print("-line needs exactly one file")
+		return 2
+	}
+
+	// removing tracing code is always allowed
+	if tx != nil && !reverseProcess {
+		if err := checkPolicy(files); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	if outDir != "" {
+		if err := checkOutputNames(files); err != nil {
+			log.Print(err)
+			return 2
+		}
+	}
+
+	report := newRunReport()
+	status := &progress{total: len(files)}
+
 	var failure bool = false
-	for _, file := range flag.Args() {
+	for i, file := range files {
+		if showProgress {
+			status.update(i+1, file)
+		}
+
 		var err error
+		var stats *fileStats
 		if reverseProcess {
-			err = reverseFile(file)
+			stats, err = reverseFile(file)
 		} else {
-			err = annotateFile(file)
+			stats, err = annotateFile(file)
 		}
+		report.add(file, stats, err)
 		if err != nil {
+			if showProgress {
+				status.done()
+			}
+			phase := phaseAnnotate
+			if reverseProcess {
+				phase = phaseRemove
+			}
+			reportFailure(file, phase, err)
+			failure = true
+		}
+	}
+
+	if selectingFuncs() && funcMatches < 1 && !failure {
+		log.Print("no function matches -func and -line")
+		failure = true
+	}
+
+	if tx != nil {
+		if !failure && stableNames {
+			if err := rewriteShimCalls(); err != nil {
+				reportFailure("", phaseAnnotate, err)
+				failure = true
+			}
+		}
+		if !failure {
+			if err := tx.check(); err != nil {
+				reportFailure("", phaseCheck, err)
+				failure = true
+			} else if err := tx.commit(); err != nil {
+				reportFailure("", phaseWrite, err)
+				failure = true
+			}
+		}
+		if failure {
+			if !jsonErrors {
+				log.Print("no files were written, fix the errors above and run again")
+			}
+			for _, file := range tx.files {
+				report.rollback(file, "not written, the run failed")
+			}
+		} else {
+			if !quiet {
+				sizeImpact(os.Stdout, tx)
+			}
+			// building checks the types, too
+			if verifyBuild && !verifyPackages(tx.orig, report, buildPackage) {
+				failure = true
+			} else if typeCheck && !verifyBuild && !verifyPackages(tx.orig, report, newTypeChecker().check) {
+				failure = true
+			}
+		}
+	}
+
+	if showProgress {
+		status.done()
+		fmt.Fprintln(os.Stderr, report.summary())
+	}
+
+	if decideCmd != nil {
+		if err := decideCmd.close(); err != nil {
+			log.Print(err)
+			failure = true
+		}
+	}
+
+	if patch != nil {
+		if err := patch.write(patchFlag); err != nil {
+			log.Print(err)
+			failure = true
+		}
+	}
+
+	if reportFlag != "" {
+		if err := report.write(reportFlag); err != nil {
 			log.Print(err)
 			failure = true
 		}
 	}
 
 	if (failure) {
-		os.Exit(1)
+		return 1
 	}
+
+	return 0
+}
+
+func main() {
+	// Without a command behave like add, or like remove if -r is given
+	registerPathFlags(flag.CommandLine)
+	registerAnnotateFlags(flag.CommandLine)
+	registerOutputFlags(flag.CommandLine)
+	registerFuncFlags(flag.CommandLine)
+	flag.BoolVar(&reverseProcess, "r", false, "reverse the process, remove tracing code")
+	flag.Usage = usage
+
+	if len(os.Args) > 1 {
+		if cmd := lookupCommand(os.Args[1]); cmd != nil {
+			os.Exit(cmd.execute(os.Args[2:]))
+		}
+	}
+
+	flag.Parse()
+
+	if flag.NArg() < 1 && filesFlag == "" {
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(processFiles(flag.CommandLine, flag.Args()))
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// The size of the generated file of BenchmarkAnnotateLarge
+const largeFileSize = 20 << 20
+
+// Generate a source file of about size bytes, like the code of protobuf or sqlc, formatted or not.
+func generateLargeFile(size int, formatted bool) []byte {
+	var b bytes.Buffer
+	b.Grow(size + 1024)
+	b.WriteString("// Code generated for the benchmark. DO NOT EDIT.\n\npackage gen\n\nimport (\n\t\"errors\"\n\t\"strconv\"\n)\n\n")
+	b.WriteString("var errInvalid = errors.New(\"invalid\")\n\n")
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "type Message%d struct {\n\tID    int64\n\tName  string\n\tItems []string\n}\n\n", i)
+		if formatted {
+			fmt.Fprintf(&b, "func (m *Message%d) Parse(s string) (err error) {\n\tm.ID, err = strconv.ParseInt(s, 10, 64)\n\treturn err\n}\n\n", i)
+			fmt.Fprintf(&b, "func validate%d(m *Message%d) error {\n\tif m.Name == \"\" {\n\t\treturn errInvalid\n\t}\n\treturn nil\n}\n\n", i, i)
+		} else {
+			fmt.Fprintf(&b, "func (m *Message%d) Parse(s string) (err error) { m.ID, err = strconv.ParseInt(s, 10, 64); return err }\n\n", i)
+			fmt.Fprintf(&b, "func validate%d(m *Message%d) error {\n  if m.Name == \"\" { return errInvalid }\n  return nil\n}\n", i, i)
+		}
+	}
+	return b.Bytes()
+}
+
+// Annotating a generated file of 20MB, run it with
+//
+//	go test -run '^$' -bench AnnotateLarge -benchmem .
+//
+// B/op is the memory allocated for one file, which bounds the peak memory of the run.
+func BenchmarkAnnotateLarge(b *testing.B) {
+	for _, formatted := range []bool{true, false} {
+		name := "formatted"
+		if !formatted {
+			name = "unformatted"
+		}
+		b.Run(name, func(b *testing.B) {
+			annotateOptions(b)
+			src := generateLargeFile(largeFileSize, formatted)
+			b.SetBytes(int64(len(src)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := annotate("gen.go", src); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"sort"
+)
+
+// prefix of the comments of explain, they are ordinary comments and not markers, so nothing removes them
+const explainPrefix = "// errgotrace: "
+
+// Show where the tracing code would go in a file, without generating any. The file is formatted like it
+// would be for annotate and gets a comment before every function, with the name it would be traced with
+// or why it wouldn't be traced, and one where the runtime would be imported. Files that already contain
+// tracing code are explained as if it was removed.
+func explain(file string, src []byte) ([]byte, error) {
+	if containsTracing(src) {
+		orig, err := reverse(src)
+		if err != nil {
+			return nil, fileErrorf(file, phaseRemove, "failed to read (%s)", err)
+		}
+		src = []byte(orig)
+	}
+
+	_, stats, err := annotate(file, src)
+	if err != nil {
+		return nil, err
+	}
+	traced := make(map[string]bool)
+	for _, name := range stats.Instrumented {
+		traced[name] = true
+	}
+
+	view, err := format.Source(src)
+	if err != nil {
+		return nil, fileErrorf(file, phaseParse, "formatting error (%s)", err)
+	}
+	view = keepHeader(src, view)
+	fset = token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, view, parser.ParseComments)
+	if err != nil {
+		return nil, fileErrorf(file, phaseParse, "%s", err)
+	}
+
+	e := &editList{filename: file, packageName: f.Name.Name, orig: view, file: f, qualified: qualifiedPackage(file, f.Name.Name)}
+	if len(stats.Instrumented) > 0 {
+		pos, _ := importPosition(f, view)
+		e.Add(pos, []byte(explainPrefix+"imports the runtime as "+importName+"\n"))
+	}
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Body == nil {
+			continue
+		}
+
+		c := e.describe(d)
+		comment := "not traced, excluded by a filter, rule or directive"
+		if traced[c.Name] {
+			comment = "traced as " + e.outputName(c.Name)
+		} else if c.Results < 1 {
+			comment = "not traced, no results"
+		}
+		e.Add(fset.Position(d.Pos()).Offset, []byte(explainPrefix+comment+"\n"))
+	}
+	sort.SliceStable(e.edits, func(i, j int) bool { return e.edits[i].pos < e.edits[j].pos })
+
+	var pos int
+	var out []byte
+	for _, ed := range e.edits {
+		out = append(append(out, view[pos:ed.pos]...), ed.val...)
+		pos = ed.pos
+	}
+	out = append(out, view[pos:]...)
+
+	// the comment in an import block needs indentation
+	formatted, err := format.Source(out)
+	if err != nil {
+		return nil, fileErrorf(file, phaseAnnotate, "formatting error (%s)", err)
+	}
+	return keepHeader(out, formatted), nil
+}
+
+func runExplain(fs *flag.FlagSet) int {
+	activeFlags = fs
+	if err := loadOptions(); err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	files, err := collectFiles(fs.Args(), filesFlag)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	files = withoutRuntime(files)
+
+	var failure bool
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Printf("%s: failed to open (%s)", file, err)
+			failure = true
+			continue
+		}
+
+		view, err := explain(file, src)
+		if err != nil {
+			log.Print(err)
+			failure = true
+			continue
+		}
+		fmt.Println(string(view))
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	// -q only prints errors, -json-errors prints them as JSON objects, one per line
+	quiet      bool
+	jsonErrors bool
+)
+
+// Phases a file fails in, the phase of fileError
+const (
+	phaseRead     = "read"
+	phaseParse    = "parse"
+	phaseAnnotate = "annotate"
+	phaseRemove   = "remove"
+	phaseCheck    = "check"
+	phaseWrite    = "write"
+	phaseVerify   = "verify"
+)
+
+// fileError is the failure of a single file, its text is the file and the message like the other errors
+type fileError struct {
+	File    string `json:"file"`
+	Phase   string `json:"phase"`
+	Message string `json:"message"`
+}
+
+func (e *fileError) Error() string {
+	return e.File + ": " + e.Message
+}
+
+func fileErrorf(file, phase, format string, args ...interface{}) error {
+	return &fileError{File: file, Phase: phase, Message: fmt.Sprintf(format, args...)}
+}
+
+// Report the failure of a file on stderr. Errors that don't know their phase get the given one,
+// the file name is taken from the beginning of their text.
+func reportFailure(file, phase string, err error) {
+	fe, ok := err.(*fileError)
+	if !ok {
+		fe = &fileError{File: file, Phase: phase, Message: strings.TrimPrefix(err.Error(), file+": ")}
+	}
+
+	if !jsonErrors {
+		log.Print(fe)
+		return
+	}
+	data, _ := json.Marshal(fe)
+	fmt.Fprintln(os.Stderr, string(data))
+}
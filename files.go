@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/build/constraint"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// like the go tool, ** doesn't descend into testdata and directories starting with _ or . unless enabled
+	walkTestdata bool
+	walkHidden   bool
+
+	// globs skip files excluded with //go:build ignore unless enabled, named files are always processed
+	walkIgnored bool
+)
+
+// Check if a path segment contains any glob meta characters.
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// Match a list of path segments against a list of pattern segments.
+// A "**" segment matches zero or more path segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// Expand a glob pattern, patterns without meta characters are returned as they are.
+// Unlike filepath.Glob, "**" is supported and matches any number of directories.
+func expandGlob(pattern string) ([]string, error) {
+	segs := strings.Split(filepath.ToSlash(pattern), "/")
+
+	// Validate the pattern and find the first segment containing a meta character
+	first := -1
+	for i, s := range segs {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern (%s)", pattern, err)
+		}
+		if first < 0 && hasMeta(s) {
+			first = i
+		}
+	}
+
+	if first < 0 {
+		return []string{pattern}, nil
+	}
+
+	var matches []string
+	if !strings.Contains(pattern, "**") {
+		matches, _ = filepath.Glob(pattern)
+	} else {
+		// Walk everything below the part of the pattern that is free of meta characters
+		root := strings.Join(segs[:first], "/")
+		if root == "" && strings.HasPrefix(pattern, "/") {
+			root = "/"
+		} else if root == "" {
+			root = "."
+		}
+
+		err := filepath.Walk(filepath.FromSlash(root), func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				// directories named in the pattern are always entered, e.g. for **/testdata/*.go
+				if p != filepath.FromSlash(root) && skipDir(info.Name()) && !namedSegment(segs[first:], info.Name()) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			rel, err := filepath.Rel(filepath.FromSlash(root), p)
+			if err != nil {
+				return err
+			}
+
+			if matchSegments(segs[first:], strings.Split(filepath.ToSlash(rel), "/")) {
+				matches = append(matches, p)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: failed to expand (%s)", pattern, err)
+		}
+	}
+
+	if len(matches) < 1 {
+		return nil, fmt.Errorf("%s: no matching files", pattern)
+	}
+
+	if !walkIgnored {
+		kept := matches[:0]
+		for _, m := range matches {
+			if !buildIgnored(m) {
+				kept = append(kept, m)
+			}
+		}
+		matches = kept
+	}
+
+	return matches, nil
+}
+
+// Check if the walk skips a directory, by its name.
+func skipDir(name string) bool {
+	if name == "testdata" {
+		return !walkTestdata
+	}
+	if strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+		return !walkHidden
+	}
+	return false
+}
+
+func namedSegment(segs []string, name string) bool {
+	for _, s := range segs {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a go file is excluded from builds with //go:build ignore or // +build ignore,
+// the convention for programs run with go run, e.g. by go generate.
+func buildIgnored(file string) bool {
+	if !strings.HasSuffix(file, ".go") {
+		return false
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// constraints are only valid before the package clause
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+		if !constraint.IsGoBuild(line) && !constraint.IsPlusBuild(line) {
+			continue
+		}
+		if expr, err := constraint.Parse(line); err == nil {
+			if tag, ok := expr.(*constraint.TagExpr); ok && tag.Tag == "ignore" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Read a newline-delimited list of paths, empty lines are ignored.
+func readFileList(r io.Reader) ([]string, error) {
+	var files []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+
+	return files, scanner.Err()
+}
+
+// Collect the files to process from the command line arguments and the -files list.
+// Globs are expanded and duplicates removed, the order of the arguments is kept.
+func collectFiles(args []string, listFile string) ([]string, error) {
+	if listFile != "" {
+		var r io.Reader = os.Stdin
+		if listFile != "-" {
+			f, err := os.Open(listFile)
+			if err != nil {
+				return nil, fmt.Errorf("%s: failed to open (%s)", listFile, err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		list, err := readFileList(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read (%s)", listFile, err)
+		}
+		args = append(args, list...)
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		matches, err := expandGlob(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			if !seen[filepath.Clean(m)] {
+				seen[filepath.Clean(m)] = true
+				files = append(files, m)
+			}
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+// regexFlags collects the values of a flag that can be given several times
+type regexFlags []string
+
+func (r *regexFlags) String() string {
+	return strings.Join(*r, ", ")
+}
+
+func (r *regexFlags) Set(v string) error {
+	*r = append(*r, v)
+	return nil
+}
+
+// typeFlags collects type lists such as (*Tx, error), they are normalized when set
+type typeFlags []string
+
+func (t *typeFlags) String() string {
+	return strings.Join(*t, "; ")
+}
+
+func (t *typeFlags) Set(v string) error {
+	types, err := parseTypes(v)
+	if err != nil {
+		return err
+	}
+	*t = append(*t, strings.Join(types, ", "))
+	return nil
+}
+
+// Parse a result list such as error or (*Tx, error) into the normalized types, one per result.
+func parseTypes(s string) ([]string, error) {
+	expr, err := parser.ParseExpr("func() " + s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid type list %q", s)
+	}
+	ft, ok := expr.(*ast.FuncType)
+	if !ok {
+		return nil, fmt.Errorf("invalid type list %q", s)
+	}
+	return fieldTypes(ft.Results), nil
+}
+
+// Get the types of a parameter or result list, one per name, e.g. [context.Context string error]
+func fieldTypes(fields *ast.FieldList) []string {
+	list := []string{}
+	if fields == nil {
+		return list
+	}
+	for _, f := range fields.List {
+		t := types.ExprString(f.Type)
+		for i := 0; i == 0 || i < len(f.Names); i++ {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// funcFilter selects functions by name: a function has to match all of the -filter expressions,
+// at least one of the -filter-any expressions and none of the -exclude expressions.
+// By shape it has to return one of the -returns lists, if any, and take all of the -params types.
+type funcFilter struct {
+	all  []*regexp.Regexp
+	any  []*regexp.Regexp
+	none []*regexp.Regexp
+
+	returns []string
+	params  []string
+}
+
+// Compile the expressions of the filter flags.
+func compileFilter(all, any, none []string) (*funcFilter, error) {
+	f := &funcFilter{returns: returnsFlag, params: paramsFlag}
+	groups := []struct {
+		flag  string
+		exprs []string
+		res   *[]*regexp.Regexp
+	}{
+		{"filter", all, &f.all},
+		{"filter-any", any, &f.any},
+		{"exclude", none, &f.none},
+	}
+
+	for _, g := range groups {
+		for _, e := range g.exprs {
+			r, err := regexp.Compile(e)
+			if err != nil {
+				return nil, fmt.Errorf("error in %s regex (%s)", g.flag, err)
+			}
+			*g.res = append(*g.res, r)
+		}
+	}
+	return f, nil
+}
+
+// Check if any of the expressions are given, the shape doesn't count.
+func (f *funcFilter) naming() bool {
+	return len(f.all) > 0 || len(f.any) > 0 || len(f.none) > 0
+}
+
+func (f *funcFilter) match(c *candidate) bool {
+	return f.matchName(c.Name) && f.matchShape(c)
+}
+
+func (f *funcFilter) matchShape(c *candidate) bool {
+	if len(f.returns) > 0 && !contains(f.returns, strings.Join(c.ResultTypes, ", ")) {
+		return false
+	}
+	for _, p := range f.params {
+		if !contains(c.ParamTypes, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *funcFilter) matchName(name string) bool {
+	for _, r := range f.none {
+		if r.MatchString(name) {
+			return false
+		}
+	}
+
+	for _, r := range f.all {
+		if !r.MatchString(name) {
+			return false
+		}
+	}
+
+	if len(f.any) < 1 {
+		return true
+	}
+	for _, r := range f.any {
+		if r.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the go directive of a go.mod file
+var goDirectiveRegex = regexp.MustCompile(`(?m)^go\s+(\d+)\.(\d+)`)
+
+// the module directive of a go.mod file
+var moduleDirectiveRegex = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+
+// goVersion is the language version of a module, the zero value is an unknown version
+type goVersion struct {
+	major, minor int
+}
+
+func (v goVersion) String() string {
+	if v.major == 0 {
+		return ""
+	}
+	return strconv.Itoa(v.major) + "." + strconv.Itoa(v.minor)
+}
+
+// Check if code for the given version can be generated, anything goes for unknown versions.
+func (v goVersion) atLeast(major, minor int) bool {
+	return v.major == 0 || v.major > major || v.major == major && v.minor >= minor
+}
+
+var (
+	goModMu    sync.Mutex
+	goModCache = make(map[string]goVersion)
+
+	// import paths by package directory
+	importPathCache = make(map[string]string)
+)
+
+// Get the go version of the module a file belongs to, from the go directive of the nearest go.mod.
+func moduleGoVersion(file string) goVersion {
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return goVersion{}
+	}
+
+	goModMu.Lock()
+	defer goModMu.Unlock()
+	return dirGoVersion(dir)
+}
+
+func dirGoVersion(dir string) goVersion {
+	if v, ok := goModCache[dir]; ok {
+		return v
+	}
+
+	var v goVersion
+	if src, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		if m := goDirectiveRegex.FindSubmatch(src); m != nil {
+			v.major, _ = strconv.Atoi(string(m[1]))
+			v.minor, _ = strconv.Atoi(string(m[2]))
+		}
+	} else if parent := filepath.Dir(dir); parent != dir {
+		v = dirGoVersion(parent)
+	}
+
+	goModCache[dir] = v
+	return v
+}
+
+// Get the import path of the package in the absolute directory dir from the nearest go.mod, empty if there is none.
+func packageImportPath(dir string) string {
+	for rel := ""; ; {
+		if src, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			m := moduleDirectiveRegex.FindSubmatch(src)
+			if m == nil {
+				return ""
+			}
+			return path.Join(string(m[1]), rel)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		rel = path.Join(filepath.Base(dir), rel)
+		dir = parent
+	}
+}
+
+// Get the name the functions of a file are logged with, the import path of its package if it is known
+// and the package name otherwise. Like in stack traces the main package is always main, external test
+// packages get the suffix _test.
+func qualifiedPackage(file, pkg string) string {
+	if pkg == "main" {
+		return pkg
+	}
+	p := fileImportPath(file)
+	if p == "" {
+		return pkg
+	}
+	if strings.HasSuffix(pkg, "_test") {
+		p += "_test"
+	}
+	return p
+}
+
+// Get the import path of the directory of a file from the nearest go.mod or the GOPATH, empty if it is unknown.
+func fileImportPath(file string) string {
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return ""
+	}
+
+	goModMu.Lock()
+	defer goModMu.Unlock()
+	p, ok := importPathCache[dir]
+	if !ok {
+		p = packageImportPath(dir)
+		if p == "" {
+			p = gopathImportPath(dir)
+		}
+		importPathCache[dir] = p
+	}
+	return p
+}
+
+// Get the import path of the package in the absolute directory dir below the src directory of a GOPATH entry.
+func gopathImportPath(dir string) string {
+	for _, root := range filepath.SplitList(build.Default.GOPATH) {
+		rel, err := filepath.Rel(filepath.Join(root, "src"), dir)
+		if err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return ""
+}
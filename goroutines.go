@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// Report panics of goroutines started with go func() {...}() and keep the goroutines they were started from.
+// Literals with parameters only get a deferred call as their first statement.
+func (e *editList) traceGoStmt(g *ast.GoStmt) {
+	lit, ok := g.Call.Fun.(*ast.FuncLit)
+	if !ok {
+		return
+	}
+
+	name := e.goroutineName("go", g.Pos())
+	e.stats.Instrumented = append(e.stats.Instrumented, name)
+
+	// literals without parameters are started by Spawn, which keeps the goroutine they were started from
+	if lit.Type.Params.NumFields() == 0 && len(g.Call.Args) == 0 {
+		e.Add(int(lit.Pos())-1, []byte(inlineCode("__errgotrace.Goroutine("+strconv.Quote(name)+").Spawn(")))
+		e.Add(int(lit.End())-1, []byte(inlineCode(")")))
+		return
+	}
+	e.Add(int(lit.Body.Lbrace), []byte(deferBlock("", []string{"__errgotrace.RecoverGoroutine(" + strconv.Quote(name) + ")"})))
+}
+
+// Report errors and panics of functions passed to errgroup.Group.Go and similar methods,
+// i.e. x.Go(func() error {...}), by wrapping the literal.
+func (e *editList) traceGoCall(call *ast.CallExpr) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Go" || len(call.Args) != 1 {
+		return
+	}
+
+	lit, ok := call.Args[0].(*ast.FuncLit)
+	if !ok || lit.Type.Params.NumFields() != 0 || lit.Type.Results == nil || len(lit.Type.Results.List) != 1 {
+		return
+	}
+	if errorKind(lit.Type.Results.List[0].Type) != isError || len(lit.Type.Results.List[0].Names) > 1 {
+		return
+	}
+
+	name := e.goroutineName("Go", call.Pos())
+	// no commas next to the markers, gofmt moves them across comments
+	e.Add(int(lit.Pos())-1, []byte(inlineCode("__errgotrace.Goroutine("+strconv.Quote(name)+").Wrap(")))
+	e.Add(int(lit.End())-1, []byte(inlineCode(")")))
+	e.stats.Instrumented = append(e.stats.Instrumented, name)
+}
+
+// Name goroutines after the enclosing function and the line they are started in, e.g. pkg.Func.go@12
+func (e *editList) goroutineName(kind string, pos token.Pos) string {
+	name := e.current
+	if name == "" {
+		name = e.qualified
+	}
+	return fmt.Sprintf("%s.%s@%d", name, kind, fset.Position(pos).Line)
+}
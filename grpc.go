@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"unicode"
+)
+
+const grpcPath = "google.golang.org/grpc"
+
+// the options handed to grpc.NewServer, %[1]s is the import name of grpc
+const grpcInterceptors = `%[1]s.ChainUnaryInterceptor(__errgotraceUnary), %[1]s.ChainStreamInterceptor(__errgotraceStream)`
+
+// the interceptors, appended to the end of the file
+const grpcInterceptorFuncs = `
+/* BEGIN_ERRGOTRACE */
+func __errgotraceUnary(ctx __context.Context, req interface{}, info *%[1]s.UnaryServerInfo, handler %[1]s.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	__errgotrace.InspectRPC(ctx, info.FullMethod, err)
+	return resp, err
+}
+
+func __errgotraceStream(srv interface{}, ss %[1]s.ServerStream, info *%[1]s.StreamServerInfo, handler %[1]s.StreamHandler) error {
+	err := handler(srv, ss)
+	__errgotrace.InspectRPC(ss.Context(), info.FullMethod, err)
+	return err
+}
+/* END_ERRGOTRACE */
+`
+
+// the interceptors need context, under a name that can't clash
+const grpcImportStmt = `
+/* BEGIN_ERRGOTRACE */
+import __context "context"
+/* END_ERRGOTRACE */
+`
+
+// Get the name grpc is imported with, empty if the file doesn't import it.
+func grpcImportName(f *ast.File) string {
+	for _, imp := range f.Imports {
+		if strings.Trim(imp.Path.Value, "`\"") != grpcPath {
+			continue
+		}
+		if imp.Name == nil {
+			return "grpc"
+		}
+		if imp.Name.Name != "_" && imp.Name.Name != "." {
+			return imp.Name.Name
+		}
+	}
+	return ""
+}
+
+// Add interceptors tracing the errors of all RPCs to a grpc.NewServer call. The code is inserted
+// inline between markers, as the options must be part of the call.
+func (e *editList) wireInterceptors(call *ast.CallExpr) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "NewServer" {
+		return
+	}
+	if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != e.grpcName {
+		return
+	}
+
+	interceptors := fmt.Sprintf(grpcInterceptors, e.grpcName)
+	switch {
+	case len(call.Args) < 1:
+		e.Add(int(call.Lparen), []byte(inlineCode(interceptors)))
+	case call.Ellipsis.IsValid():
+		// NewServer(opts...) becomes NewServer(append(opts, interceptors...)...)
+		last := call.Args[len(call.Args)-1]
+		e.Add(int(last.Pos())-1, []byte(inlineCode("append(")))
+		e.Add(int(last.End())-1, []byte(inlineCode(", "+interceptors+")")))
+	default:
+		// arguments on multiple lines end with a comma, the options get lines of their own
+		end := int(call.Args[len(call.Args)-1].End()) - 1
+		if end < len(e.orig) && e.orig[end] == ',' {
+			e.Add(end+1, []byte("\n/* BEGIN_ERRGOTRACE */\n"+interceptors+",\n/* END_ERRGOTRACE */"))
+		} else {
+			e.Add(end, []byte(inlineCode(", "+interceptors)))
+		}
+	}
+	e.grpcServers++
+}
+
+// Wrap code inserted in the middle of a line in markers, they are removed with the surrounding spaces.
+func inlineCode(code string) string {
+	return beginMarker + code + endMarker
+}
+
+// Remove the inline code of a line, a single space is kept if it was between words.
+func stripInline(line string) string {
+	var out strings.Builder
+	pos := 0
+	for _, m := range inlineRegex.FindAllStringIndex(line, -1) {
+		out.WriteString(line[pos:m[0]])
+		code := line[m[0]:m[1]]
+		spaced := strings.TrimLeftFunc(code, unicode.IsSpace) != code && strings.TrimRightFunc(code, unicode.IsSpace) != code
+		if spaced && m[0] > 0 && m[1] < len(line) && !strings.ContainsAny(line[m[0]-1:m[0]], "([{") && !strings.ContainsAny(line[m[1]:m[1]+1], ")]},.([") {
+			out.WriteString(" ")
+		}
+		pos = m[1]
+	}
+	out.WriteString(line[pos:])
+	return out.String()
+}
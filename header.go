@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+)
+
+// Find the end of the header of a go source, the comments before the package clause: license blocks, build
+// constraints and the package documentation. Returns -1 if the source doesn't start with a package clause.
+func headerEnd(src []byte) int {
+	var s scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.COMMENT:
+			continue
+		case token.PACKAGE:
+			return file.Offset(pos)
+		}
+		return -1
+	}
+}
+
+// Put the header of the original source back in front of the instrumented one. Formatting the source rewrites
+// comments of the header, it adds //go:build lines for // +build ones and strips trailing spaces, while
+// license headers and build constraints have to stay as they were, byte for byte.
+func keepHeader(orig, src []byte) []byte {
+	origEnd, srcEnd := headerEnd(orig), headerEnd(src)
+	if origEnd < 0 || srcEnd < 0 || bytes.Equal(orig[:origEnd], src[:srcEnd]) {
+		return src
+	}
+	return append(append(make([]byte, 0, origEnd+len(src)-srcEnd), orig[:origEnd]...), src[srcEnd:]...)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The header of every fixture, license blocks, build constraints, generator comments and trailing spaces
+// included, survives adding and removing the tracing code byte for byte.
+func TestKeepHeader(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "header", "*.go"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no header fixtures (%v)", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			annotateOptions(t)
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			end := headerEnd(src)
+			if end < 0 {
+				t.Fatal("the fixture doesn't start with a package clause")
+			}
+			header := string(src[:end])
+
+			out, _, err := annotate(file, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !containsTracing(out) {
+				t.Fatalf("no tracing code was added\n%s", out)
+			}
+			if got := headerOf(out); got != header {
+				t.Errorf("instrumenting changed the header to\n%q\nexpected\n%q", got, header)
+			}
+
+			reversed, err := reverse(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := headerOf([]byte(reversed)); got != header {
+				t.Errorf("removing the tracing code changed the header to\n%q\nexpected\n%q", got, header)
+			}
+		})
+	}
+}
+
+func headerOf(src []byte) string {
+	end := headerEnd(src)
+	if end < 0 {
+		return string(src)
+	}
+	return string(src[:end])
+}
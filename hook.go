@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// -staged of check
+	checkStaged bool
+
+	// -force of hook install
+	hookForce bool
+)
+
+// the line identifying the pre-commit hooks written by errgotrace, others are never replaced or removed
+const hookMarker = "# errgotrace pre-commit hook"
+
+// The hook fails the commit if the staged versions of the go files contain tracing code. It runs the
+// errgotrace that installed it, or the one in the PATH if that is gone.
+const hookScript = `#!/bin/sh
+` + hookMarker + `, remove it with errgotrace hook uninstall
+errgotrace=%s
+[ -x "$errgotrace" ] || errgotrace=errgotrace
+if ! "$errgotrace" check -staged; then
+	echo "errgotrace: the files above contain tracing code, remove it with errgotrace remove -w and stage them again, or commit with --no-verify" >&2
+	exit 1
+fi
+`
+
+// Quote a string for sh
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Get the path of the pre-commit hook of the repository in the current directory, core.hooksPath is respected.
+func preCommitHook() (string, error) {
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the git hooks (%s)", gitError(err))
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), "pre-commit"), nil
+}
+
+// The message git printed on stderr, if there is one
+func gitError(err error) string {
+	if e, ok := err.(*exec.ExitError); ok && len(bytes.TrimSpace(e.Stderr)) > 0 {
+		return string(bytes.TrimSpace(e.Stderr))
+	}
+	return err.Error()
+}
+
+// Check if a hook was written by errgotrace
+func ownHook(src []byte) bool {
+	return bytes.Contains(src, []byte("\n"+hookMarker))
+}
+
+func runHook(fs *flag.FlagSet) int {
+	sub := fs.Arg(0)
+	if sub != "install" && sub != "uninstall" {
+		fs.Usage()
+		return 2
+	}
+
+	// the flags of install follow the subcommand
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	hook, err := preCommitHook()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	existing, err := ioutil.ReadFile(hook)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("%s: failed to open (%s)", hook, err)
+		return 1
+	}
+	found := err == nil
+
+	if sub == "uninstall" {
+		if !found {
+			return 0
+		}
+		if !ownHook(existing) {
+			log.Printf("%s: not installed by errgotrace, leaving it alone", hook)
+			return 1
+		}
+		if err := os.Remove(hook); err != nil {
+			log.Printf("%s: failed to remove (%s)", hook, err)
+			return 1
+		}
+		return 0
+	}
+
+	if found && !ownHook(existing) && !hookForce {
+		log.Printf("%s: the repository already has a pre-commit hook, use -force to replace it", hook)
+		return 1
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		self = "errgotrace"
+	}
+	if err := os.MkdirAll(filepath.Dir(hook), 0755); err != nil {
+		log.Printf("%s: failed to create (%s)", filepath.Dir(hook), err)
+		return 1
+	}
+	if err := ioutil.WriteFile(hook, []byte(fmt.Sprintf(hookScript, shellQuote(self))), 0755); err != nil {
+		log.Printf("%s: failed to write (%s)", hook, err)
+		return 1
+	}
+	// WriteFile keeps the mode of a hook that is replaced
+	if err := os.Chmod(hook, 0755); err != nil {
+		log.Printf("%s: failed to write (%s)", hook, err)
+		return 1
+	}
+	return 0
+}
+
+// List the go files that are added, copied, modified or renamed in the index, relative to the top of the
+// repository. Paths restrict the list like the pathspecs of git.
+func stagedFiles(paths []string) ([]string, error) {
+	args := []string{"diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR", "--"}
+	if len(paths) < 1 {
+		paths = []string{"*.go"}
+	}
+	out, err := exec.Command("git", append(args, paths...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the staged files (%s)", gitError(err))
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(out), "\x00") {
+		if strings.HasSuffix(file, ".go") {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// Like check, but of the staged versions of the files, which are the ones that get committed.
+func runCheckStaged(fs *flag.FlagSet) int {
+	files, err := stagedFiles(fs.Args())
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	var failure bool
+	for _, file := range files {
+		// the path of the blob is relative to the top of the repository
+		src, err := exec.Command("git", "cat-file", "blob", ":"+file).Output()
+		if err != nil {
+			log.Printf("%s: failed to read the staged version (%s)", file, gitError(err))
+			failure = true
+			continue
+		}
+
+		if containsTracing(src) {
+			fmt.Println(file)
+			failure = true
+		}
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
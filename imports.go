@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Find where the imports of the instrumentation go: a group of their own in the first import block, which
+// isn't the one of import "C", or else declarations after the last import.
+func importPosition(f *ast.File, src []byte) (pos int, inBlock bool) {
+	var last ast.Node = f.Name
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			break
+		}
+		last = d
+
+		if inBlock || !d.Lparen.IsValid() || len(d.Specs) < 1 || importsC(d) {
+			continue
+		}
+		// after the line of the parenthesis, if the first import is on one of its own
+		if next := lineEnd(src, fset.Position(d.Lparen).Offset); next <= fset.Position(d.Specs[0].Pos()).Offset {
+			pos, inBlock = next, true
+		}
+	}
+
+	if inBlock {
+		return pos, true
+	}
+	return lineEnd(src, fset.Position(last.End()).Offset), false
+}
+
+// Check if an import declaration imports C for cgo.
+func importsC(d *ast.GenDecl) bool {
+	for _, spec := range d.Specs {
+		if path, err := strconv.Unquote(spec.(*ast.ImportSpec).Path.Value); err == nil && path == "C" {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the offset of the line after the one containing the offset.
+func lineEnd(src []byte, offset int) int {
+	if i := bytes.IndexByte(src[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(src)
+}
+
+// Turn an import declaration between markers, like importStmt, into the code for its position. In an import
+// block it loses the import keyword and is followed by the blank line ending its group.
+func importCode(stmt string, inBlock bool) string {
+	if !inBlock {
+		return stmt
+	}
+	return strings.TrimPrefix(strings.Replace(stmt, "\nimport ", "\n", 1), "\n") + "\n"
+}
+
+// A single import declaration without parentheses, like import "errors", on a line of its own
+type singleImport struct {
+	start, end int // offsets of the line, without its newline
+	spec       string
+}
+
+// Find the import to turn into a block with the imports of the instrumentation, for files without a block.
+// There's none if the first import declaration has parentheses, imports C or shares its line.
+func findSingleImport(f *ast.File, src []byte) (singleImport, bool) {
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT || d.Lparen.IsValid() || len(d.Specs) != 1 || importsC(d) {
+			break
+		}
+		pos, end := fset.Position(d.Pos()).Offset, fset.Position(d.End()).Offset
+		start := bytes.LastIndexByte(src[:pos], '\n') + 1
+		line := src[start : lineEnd(src, pos)-1]
+		if string(line) != string(src[pos:end]) || bytes.Contains(line, []byte("*/")) {
+			break
+		}
+		spec := d.Specs[0]
+		return singleImport{start, start + len(line), string(src[fset.Position(spec.Pos()).Offset:fset.Position(spec.End()).Offset])}, true
+	}
+	return singleImport{}, false
+}
+
+// The code replacing the import, the block of tracing code takes the imports given as declarations between
+// markers, like importStmt. The original line goes into a marker after the block, so the removal restores it.
+// The imports are grouped like goimports does, the standard library first and sorted by path.
+func (s singleImport) code(stmts ...string) (before, after string) {
+	specs := []string{s.spec}
+	for _, stmt := range stmts {
+		for _, line := range strings.Split(stmt, "\n") {
+			if strings.HasPrefix(line, "import ") {
+				specs = append(specs, strings.TrimPrefix(line, "import "))
+			}
+		}
+	}
+	sort.SliceStable(specs, func(i, j int) bool {
+		a, b := specPath(specs[i]), specPath(specs[j])
+		if stdlibPath(a) != stdlibPath(b) {
+			return stdlibPath(a)
+		}
+		return a < b
+	})
+
+	var b strings.Builder
+	b.WriteString(beginMarker + "\nimport (\n")
+	for i, spec := range specs {
+		if i > 0 && stdlibPath(specPath(specs[i-1])) != stdlibPath(specPath(spec)) {
+			b.WriteString("\n")
+		}
+		b.WriteString("\t" + spec + "\n")
+	}
+	b.WriteString(")\n" + endMarker + "\n" + originalMarker)
+	return b.String(), " */"
+}
+
+// The path of an import spec like e "errors".
+func specPath(spec string) string {
+	path, _ := strconv.Unquote(spec[strings.LastIndex(spec, " ")+1:])
+	return path
+}
+
+// Packages of the standard library have no dot in the first element of their path, like goimports tells them apart.
+func stdlibPath(path string) bool {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	return !strings.Contains(path, ".")
+}
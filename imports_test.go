@@ -0,0 +1,92 @@
+package main
+
+import (
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// A single import becomes a block with the runtime, other files keep their import declarations, and the
+// removal restores the imports as they were.
+func TestImportBlock(t *testing.T) {
+	body := "\nfunc F() error {\n\treturn errors.New(\"failed\")\n}\n"
+	tests := []struct {
+		name    string
+		imports string
+		decls   int
+	}{
+		{"single", "import \"errors\"\n", 1},
+		{"named", "import e \"errors\"\n\nvar errors = struct{ New func(string) error }{e.New}\n", 1},
+		{"documented", "// errors of the package\nimport \"errors\"\n", 1},
+		{"block", "import (\n\t\"errors\"\n\t\"fmt\"\n)\n\nvar _ = fmt.Sprint\n", 1},
+		{"two singles", "import \"errors\"\nimport \"fmt\"\n\nvar _ = fmt.Sprint\n", 2},
+		{"comment", "import \"errors\" // New\n", 2},
+		{"cgo", "import \"C\"\nimport \"errors\"\n", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotateOptions(t)
+			src := "package p\n\n" + tt.imports + body
+			out, _, err := annotate("p.go", []byte(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := parser.ParseFile(token.NewFileSet(), "p.go", out, parser.ImportsOnly)
+			if err != nil {
+				t.Fatalf("%s\n%s", err, out)
+			}
+			decls, runtime := 0, false
+			for _, decl := range f.Decls {
+				decls++
+				for _, spec := range decl.(*ast.GenDecl).Specs {
+					if spec.(*ast.ImportSpec).Name.String() == importName {
+						runtime = true
+					}
+				}
+			}
+			if decls != tt.decls || !runtime {
+				t.Errorf("got %d import declarations, expected %d with the runtime\n%s", decls, tt.decls, out)
+			}
+
+			reversed, err := reverse(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(reversed, "package p\n\n"+tt.imports+"\n") {
+				t.Errorf("removal changed the imports to\n%s", reversed)
+			}
+		})
+	}
+}
+
+// The block made out of a single import is grouped like goimports does it, so neither it nor gofmt changes it.
+func TestImportBlockGroups(t *testing.T) {
+	runtime := "\t__errgotrace \"github.com/gellweiler/errgotrace/log\"\n"
+	tests := []struct {
+		spec  string
+		stmts []string
+		want  string
+	}{
+		{`"errors"`, []string{importStmt}, "\t\"errors\"\n\n" + runtime},
+		{`e "errors"`, []string{importStmt, grpcImportStmt}, "\t__context \"context\"\n\te \"errors\"\n\n" + runtime},
+		{`"github.com/pkg/errors"`, []string{importStmt}, runtime + "\t\"github.com/pkg/errors\"\n"},
+		{`"golang.org/x/sync/errgroup"`, []string{importStmt, grpcImportStmt}, "\t__context \"context\"\n\n" + runtime + "\t\"golang.org/x/sync/errgroup\"\n"},
+		{`"example.com/a"`, []string{importStmt}, "\t\"example.com/a\"\n" + runtime},
+	}
+	for _, tt := range tests {
+		before, _ := singleImport{spec: tt.spec}.code(tt.stmts...)
+		want := beginMarker + "\nimport (\n" + tt.want + ")\n" + endMarker + "\n" + originalMarker
+		if before != want {
+			t.Errorf("%s: got\n%s\nexpected\n%s", tt.spec, before, want)
+		}
+
+		src := "package p\n\nimport (\n" + tt.want + ")\n"
+		if out, err := format.Source([]byte(src)); err != nil || string(out) != src {
+			t.Errorf("%s: gofmt changed the block (%v)\n%s", tt.spec, err, out)
+		}
+	}
+}
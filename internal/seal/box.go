@@ -0,0 +1,102 @@
+//go:build go1.20
+// +build go1.20
+
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// info of the key derivation, changes with the format of the batches
+const info = "errgotrace sealed v1"
+
+// Encrypter returns the function encrypting batches to the X25519 public key, like a NaCl sealed box:
+// an ephemeral key pair per batch, a key derived from the shared secret with HKDF-SHA256 and AES-256-GCM.
+func Encrypter(publicKey []byte) (func(batch []byte) (string, error), error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return func(batch []byte) (string, error) {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		aead, err := batchCipher(ephemeral, recipient, ephemeral.PublicKey())
+		if err != nil {
+			return "", err
+		}
+		// the key is only used for this batch, a fixed nonce is safe
+		sealed := aead.Seal(ephemeral.PublicKey().Bytes(), make([]byte, aead.NonceSize()), batch, nil)
+		return SealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+	}, nil
+}
+
+// Decrypter returns the function decrypting an encrypted batch, the line without its prefix, with the
+// X25519 private key.
+func Decrypter(privateKey []byte) (func(data string) ([]byte, error), error) {
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return func(data string) ([]byte, error) {
+		sealed, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < 32 {
+			return nil, fmt.Errorf("truncated batch")
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(sealed[:32])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := batchCipher(key, ephemeral, ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		batch, err := aead.Open(nil, make([]byte, aead.NonceSize()), sealed[32:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("can't decrypt the batch, wrong key or modified data")
+		}
+		return batch, nil
+	}, nil
+}
+
+// GenerateKey creates an X25519 key pair.
+func GenerateKey() (privateKey, publicKey []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
+
+// Derive the cipher of a batch from the shared secret of the key and the peer, the ephemeral public
+// key of the batch is the salt.
+func batchCipher(key *ecdh.PrivateKey, peer, ephemeral *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := key.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	// HKDF-SHA256 with a single block of output
+	extract := hmac.New(sha256.New, ephemeral.Bytes())
+	extract.Write(shared)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(info))
+	expand.Write([]byte{1})
+
+	block, err := aes.NewCipher(expand.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,24 @@
+//go:build !go1.20
+// +build !go1.20
+
+package seal
+
+import "fmt"
+
+// encryption needs crypto/ecdh
+var errEncryption = fmt.Errorf("encryption needs go 1.20")
+
+// Encrypter is not supported before go 1.20.
+func Encrypter(publicKey []byte) (func(batch []byte) (string, error), error) {
+	return nil, errEncryption
+}
+
+// Decrypter is not supported before go 1.20.
+func Decrypter(privateKey []byte) (func(data string) ([]byte, error), error) {
+	return nil, errEncryption
+}
+
+// GenerateKey is not supported before go 1.20.
+func GenerateKey() (privateKey, publicKey []byte, err error) {
+	return nil, nil, errEncryption
+}
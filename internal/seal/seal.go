@@ -0,0 +1,78 @@
+// Package seal encrypts and signs batches of trace output for the sealed sinks of the runtime and reads
+// them back for errgotrace unseal. Every batch is a single line, a prefix followed by base64.
+package seal
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Prefixes of the lines of encrypted and signed batches
+const (
+	SealedPrefix = "ERRGOTRACE sealed "
+	SignedPrefix = "ERRGOTRACE signed "
+)
+
+// Signer returns the function signing batches with the Ed25519 key.
+func Signer(key ed25519.PrivateKey) (func(batch []byte) (string, error), error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("the private key has %d bytes instead of %d", len(key), ed25519.PrivateKeySize)
+	}
+	return func(batch []byte) (string, error) {
+		sig := ed25519.Sign(key, batch)
+		return SignedPrefix + base64.StdEncoding.EncodeToString(batch) + " " + base64.StdEncoding.EncodeToString(sig), nil
+	}, nil
+}
+
+// Verifier returns the function checking the signature of a signed batch, the line without its prefix.
+func Verifier(key ed25519.PublicKey) (func(data string) ([]byte, error), error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("the public key has %d bytes instead of %d", len(key), ed25519.PublicKeySize)
+	}
+	return func(data string) ([]byte, error) {
+		parts := strings.Fields(data)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed signed batch")
+		}
+		batch, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		sig, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if !ed25519.Verify(key, batch, sig) {
+			return nil, fmt.Errorf("invalid signature")
+		}
+		return batch, nil
+	}, nil
+}
+
+// Read the lines of batches with the prefix from r and write their contents to w. Lines of other
+// batches are an error, a batch that can't be opened stops the reading before it is written.
+func Read(r io.Reader, w io.Writer, prefix string, open func(data string) ([]byte, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, prefix) {
+			return fmt.Errorf("line %d: not a batch of the expected kind", n)
+		}
+		batch, err := open(line[len(prefix):])
+		if err != nil {
+			return fmt.Errorf("line %d: %s", n, err)
+		}
+		if _, err := w.Write(batch); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
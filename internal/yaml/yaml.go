@@ -0,0 +1,255 @@
+// Package yaml is a small parser for the subset of YAML used by the configuration files of errgotrace:
+// block mappings and sequences, flow sequences of scalars, plain and quoted scalars
+// and comments. Mappings are returned as map[string]interface{}, sequences as
+// []interface{} and scalars as strings.
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// Parse a document, an empty document results in nil.
+func Parse(src []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(line) - len(text), text: text})
+	}
+
+	if len(p.lines) < 1 {
+		return nil, nil
+	}
+
+	v, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+
+	return v, nil
+}
+
+// Remove a comment from a line, # only starts a comment outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Split "key: value" into key and value, ok is false if the text is no mapping entry.
+func splitYAMLKey(text string) (string, string, bool) {
+	if text == "" || text[0] == '\'' || text[0] == '"' || text[0] == '[' {
+		return "", "", false
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if isYAMLSeqItem(p.lines[p.pos].text) {
+		return p.parseSeq(indent)
+	}
+	return p.parseMap(indent)
+}
+
+// Parse the value following a "key:" or "-" without inline value
+func (p *yamlParser) parseNested(indent int, allowSeq bool) (interface{}, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+
+	next := p.lines[p.pos]
+	if next.indent > indent || (allowSeq && next.indent == indent && isYAMLSeqItem(next.text)) {
+		return p.parseBlock(next.indent)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) parseSeq(indent int) (interface{}, error) {
+	var seq []interface{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent || !isYAMLSeqItem(line.text) {
+			return nil, fmt.Errorf("line %d: expected a sequence item", line.num)
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if rest == "" {
+			p.pos++
+			v, err := p.parseNested(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+
+		// "- key: value" starts a mapping indented by the position of the key
+		if _, _, ok := splitYAMLKey(rest); ok || isYAMLSeqItem(rest) {
+			offset := line.indent + len(line.text) - len(rest)
+			p.lines[p.pos] = yamlLine{num: line.num, indent: offset, text: rest}
+			v, err := p.parseBlock(offset)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+
+		v, err := parseYAMLScalar(rest, line.num)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+		p.pos++
+	}
+
+	return seq, nil
+}
+
+func (p *yamlParser) parseMap(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && isYAMLSeqItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+
+		var v interface{}
+		var err error
+		if value == "" {
+			v, err = p.parseNested(indent, true)
+		} else {
+			v, err = parseYAMLScalar(value, line.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+
+	return m, nil
+}
+
+func parseYAMLScalar(text string, num int) (interface{}, error) {
+	switch text[0] {
+	case '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: unterminated sequence", num)
+		}
+		var seq []interface{}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return seq, nil
+		}
+		for _, item := range splitYAMLFlow(inner) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				return nil, fmt.Errorf("line %d: empty sequence item", num)
+			}
+			v, err := parseYAMLScalar(item, num)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	case '"':
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string", num)
+		}
+		return s, nil
+	case '\'':
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("line %d: invalid quoted string", num)
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+
+	return text, nil
+}
+
+// Split the items of a flow sequence at commas outside of quotes.
+func splitYAMLFlow(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
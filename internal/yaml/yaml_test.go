@@ -0,0 +1,99 @@
+package yaml
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Documents like the configuration files of errgotrace
+var seedDocuments = []string{
+	"functions: '^main\\.'\nexclude: 'Close$'\n",
+	"# comment\nignore: ['^EOF$', \"context canceled\"]\nsample: 0.1 # a fraction\n",
+	"ignore:\n  - '^EOF$'\n  - 'context canceled'\n",
+	"budgets:\n  - function: '^storage\\.'\n    per_minute: 100\n  - function: x\n",
+	"sinks: [log, journal]\nsample_by: fingerprint\n",
+	"- a\n- - b\n  - c\n-\n- []\n",
+	"a:\nb: [[x, y], z]\n---\nc: 'it''s'\n",
+	"key: \"tab\\there # not a comment\"\n",
+	"a: [x,,y]\n",
+	"\tkey: value\n",
+	"a: b\n  c: d\n",
+}
+
+func FuzzParse(f *testing.F) {
+	for _, doc := range seedDocuments {
+		f.Add([]byte(doc))
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		v, err := Parse(src)
+		if err != nil || v == nil {
+			return
+		}
+		doc, ok := encode(v, "")
+		if !ok {
+			t.Skip("the keys have no plain representation")
+		}
+		again, err := Parse([]byte(doc))
+		if err != nil {
+			t.Fatalf("%q parsed as %#v, encoded as %q: %s", src, v, doc, err)
+		}
+		if !reflect.DeepEqual(v, again) {
+			t.Fatalf("%q parsed as %#v, encoded as %q parsed as %#v", src, v, doc, again)
+		}
+	})
+}
+
+// Encode a parsed document in block style with quoted scalars, false if a key can't be written as it is.
+func encode(v interface{}, indent string) (string, bool) {
+	var b strings.Builder
+	switch v := v.(type) {
+	case map[string]interface{}:
+		var keys []string
+		for k := range v {
+			if !plainKey(k) {
+				return "", false
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s, ok := encodeItem(indent, k+":", v[k])
+			if !ok {
+				return "", false
+			}
+			b.WriteString(s)
+		}
+	case []interface{}:
+		for _, item := range v {
+			s, ok := encodeItem(indent, "-", item)
+			if !ok {
+				return "", false
+			}
+			b.WriteString(s)
+		}
+	}
+	return b.String(), true
+}
+
+func encodeItem(indent, prefix string, v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return indent + prefix + "\n", true
+	case string:
+		return indent + prefix + " " + strconv.Quote(v) + "\n", true
+	case []interface{}:
+		if len(v) < 1 {
+			return indent + prefix + " []\n", true
+		}
+	}
+	s, ok := encode(v, indent+"  ")
+	return indent + prefix + "\n" + s, ok
+}
+
+// Keys the parser returns the same when they are written as they are
+func plainKey(k string) bool {
+	return !strings.ContainsAny(k, "'\"#\r") && !strings.HasPrefix(k, "-") && !strings.HasPrefix(k, "[")
+}
@@ -0,0 +1,104 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// time to wait for the agent when connecting and sending
+	agentTimeout = time.Second
+
+	// time between attempts to reach an agent that failed, events are dropped in between
+	agentRetry = time.Second
+)
+
+// AgentSink sends the events to an errgotrace agent, see errgotrace agent, in the JSON form of the schema
+// package and with the name and pid of the process. Events are written to the connection as they happen,
+// short-lived processes like tests that never call Flush don't lose their last events. If the agent can't be
+// reached the events are dropped, it is tried again after a second.
+type AgentSink struct {
+	network string
+	addr    string
+	process string
+
+	conn   net.Conn
+	retry  time.Time
+	failed bool
+}
+
+// NewAgentSink creates a sink sending to the agent listening on the address, unix:///path/to/socket or
+// tcp://host:port. The connection is established with the first event and again after failures.
+func NewAgentSink(addr string) (*AgentSink, error) {
+	network, address, err := ParseAgentAddr(addr)
+	if err != nil {
+		return nil, fmt.Errorf("agent: %s", err)
+	}
+
+	return &AgentSink{
+		network: network,
+		addr:    address,
+		process: filepath.Base(os.Args[0]) + "[" + strconv.Itoa(os.Getpid()) + "]",
+	}, nil
+}
+
+// ParseAgentAddr splits an agent address into the network and the address for net.Dial and net.Listen,
+// host:port without a scheme is TCP.
+func ParseAgentAddr(addr string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		return "unix", strings.TrimPrefix(addr, "unix://"), nil
+	case strings.HasPrefix(addr, "tcp://"):
+		return "tcp", strings.TrimPrefix(addr, "tcp://"), nil
+	case strings.Contains(addr, "://"):
+		return "", "", fmt.Errorf("unsupported address %q, only unix:// and tcp://", addr)
+	}
+	return "tcp", addr, nil
+}
+
+// Sinks are never called concurrently, only the first of consecutive failures is reported.
+func (s *AgentSink) Emit(e *Event) {
+	if s.conn == nil && time.Now().Before(s.retry) {
+		return
+	}
+
+	err := s.write(e)
+	if err != nil {
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		s.retry = time.Now().Add(agentRetry)
+		if !s.failed {
+			log.Printf("[ERRGOTRACE] agent: %s", err)
+		}
+	}
+	s.failed = err != nil
+}
+
+func (s *AgentSink) write(e *Event) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, agentTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	ev := e.Schema()
+	ev.Process = s.process
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(agentTimeout))
+	_, err = s.conn.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,79 @@
+package log
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// set by SetBenchmarkMode, events are counted instead of delivered to the sinks
+var benchmarkMode int32
+
+// number of events per function kept from the sinks in benchmark mode
+var benchmarkCounts sync.Map // string -> *int64
+
+// SetBenchmarkMode keeps the events from the sinks and only counts them per function, see BenchmarkCounts.
+// The errors are still inspected, classified and filtered, so benchmarks of instrumented code measure the
+// overhead of tracing without the output. It's turned on when the program runs benchmarks, like with
+// go test -bench, or ERRGOTRACE_BENCH=1, and off with ERRGOTRACE_BENCH=0.
+func SetBenchmarkMode(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&benchmarkMode, v)
+}
+
+// BenchmarkCounts returns the number of events per function that benchmark mode kept from the sinks.
+func BenchmarkCounts() map[string]int {
+	m := make(map[string]int)
+	benchmarkCounts.Range(func(k, v interface{}) bool {
+		m[k.(string)] = int(atomic.LoadInt64(v.(*int64)))
+		return true
+	})
+	return m
+}
+
+// Count the event instead of delivering it if benchmark mode is on.
+func benchmarked(e *Event) bool {
+	if atomic.LoadInt32(&benchmarkMode) == 0 {
+		return false
+	}
+
+	c, ok := benchmarkCounts.Load(e.Func)
+	if !ok {
+		c, _ = benchmarkCounts.LoadOrStore(e.Func, new(int64))
+	}
+	atomic.AddInt64(c.(*int64), 1)
+	return true
+}
+
+// Check if the program runs benchmarks, the test binary gets them as -test.bench.
+func runsBenchmarks(args []string) bool {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == "test.bench" {
+			return i+1 < len(args) && args[i+1] != ""
+		}
+		if strings.HasPrefix(name, "test.bench=") {
+			return name != "test.bench="
+		}
+	}
+	return false
+}
+
+// Write the number of events kept from the sinks to the standard logger.
+func logBenchmarked() {
+	var total int
+	counts := BenchmarkCounts()
+	for _, n := range counts {
+		total += n
+	}
+	if total > 0 {
+		log.Printf("[ERRGOTRACE] benchmark mode: %d events of %d functions were not emitted\n", total, len(counts))
+	}
+}
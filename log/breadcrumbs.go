@@ -0,0 +1,69 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// number of errors kept per goroutine for the panics, 0 keeps none
+var panicErrors int64
+
+// goroutines whose errors are kept, the ones that reported errors first are dropped beyond it
+const maxBreadcrumbGoroutines = 1024
+
+var (
+	breadcrumbMu    sync.Mutex
+	breadcrumbs     = make(map[uint64][]string)
+	breadcrumbOrder []uint64
+)
+
+// SetPanicErrors keeps the last n errors of every goroutine and adds them to the report of a panic in the
+// same goroutine, as they are often the trail leading to its cause. Finding the goroutine of an error costs
+// about a microsecond, so it is off by default. 0 turns it off again.
+func SetPanicErrors(n int) {
+	atomic.StoreInt64(&panicErrors, int64(n))
+	if n <= 0 {
+		breadcrumbMu.Lock()
+		breadcrumbs = make(map[uint64][]string)
+		breadcrumbOrder = nil
+		breadcrumbMu.Unlock()
+	}
+}
+
+// Remember an error of the current goroutine for a later panic.
+func recordBreadcrumb(e *Event) {
+	n := int(atomic.LoadInt64(&panicErrors))
+	if n <= 0 {
+		return
+	}
+
+	gid := goroutineID()
+	crumb := e.Func + ": " + e.Message()
+	breadcrumbMu.Lock()
+	defer breadcrumbMu.Unlock()
+	crumbs, ok := breadcrumbs[gid]
+	if !ok {
+		breadcrumbOrder = append(breadcrumbOrder, gid)
+		if len(breadcrumbOrder) > maxBreadcrumbGoroutines {
+			delete(breadcrumbs, breadcrumbOrder[0])
+			breadcrumbOrder = breadcrumbOrder[1:]
+		}
+	}
+	crumbs = append(crumbs, crumb)
+	if len(crumbs) > n {
+		crumbs = crumbs[len(crumbs)-n:]
+	}
+	breadcrumbs[gid] = crumbs
+}
+
+// Get the errors the current goroutine reported before, oldest first.
+func goroutineBreadcrumbs() []string {
+	if atomic.LoadInt64(&panicErrors) <= 0 {
+		return nil
+	}
+
+	gid := goroutineID()
+	breadcrumbMu.Lock()
+	defer breadcrumbMu.Unlock()
+	return append([]string(nil), breadcrumbs[gid]...)
+}
@@ -0,0 +1,103 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Budget is the number of errors per minute the matching functions may return together.
+// If the budget is exceeded an alert event is emitted, at most once per minute.
+type Budget struct {
+	Functions *regexp.Regexp
+	PerMinute int
+
+	// Hook is optionally called with the alert, e.g. to fail a soak test
+	Hook func(alert *Event)
+}
+
+// budgetState tracks the errors of a budget in the current minute
+type budgetState struct {
+	Budget
+
+	mu      sync.Mutex
+	start   time.Time
+	count   int
+	alerted bool
+}
+
+var (
+	budgetMu   sync.Mutex
+	apiBudgets []*budgetState
+	numBudgets int32
+)
+
+// AddBudget registers an error budget.
+func AddBudget(b Budget) {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	apiBudgets = append(apiBudgets, &budgetState{Budget: b})
+	atomic.AddInt32(&numBudgets, 1)
+}
+
+// Count the error in all matching budgets and emit alerts for exceeded ones.
+func checkBudgets(e *Event) {
+	if atomic.LoadInt32(&numBudgets) == 0 && liveBudgets() == nil {
+		return
+	}
+
+	budgetMu.Lock()
+	all := append(append([]*budgetState(nil), apiBudgets...), liveBudgets()...)
+	budgetMu.Unlock()
+
+	for _, b := range all {
+		if alert := b.add(e); alert != nil {
+			stamp(alert)
+			emitEvent(alert)
+			if b.Hook != nil {
+				b.Hook(alert)
+			}
+		}
+	}
+}
+
+// Count an error, returns the alert if this error exceeded the budget.
+func (b *budgetState) add(e *Event) *Event {
+	if b.Functions != nil && !matchName(b.Functions, e.Func) {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e.Time.Sub(b.start) >= time.Minute {
+		b.start, b.count, b.alerted = e.Time, 0, false
+	}
+	b.count++
+	if b.count <= b.PerMinute || b.alerted {
+		return nil
+	}
+	b.alerted = true
+
+	pattern := "all functions"
+	if b.Functions != nil {
+		pattern = b.Functions.String()
+	}
+	return &Event{
+		Time:  e.Time,
+		Func:  e.Func,
+		Error: fmt.Errorf("error budget of %d errors per minute exceeded by %s", b.PerMinute, pattern),
+		Alert: true,
+	}
+}
+
+// the budgets of the configuration file
+func liveBudgets() []*budgetState {
+	c, _ := liveConfig.Load().(*fileConfig)
+	if c == nil {
+		return nil
+	}
+	return c.budgets
+}
@@ -0,0 +1,97 @@
+package log
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// a shard flushes itself once it holds this many events
+const maxShardEvents = 1024
+
+// shard is one of several independent event buffers, so goroutines
+// emitting events concurrently rarely wait for each other.
+type shard struct {
+	mu     sync.Mutex
+	events []*Event
+	_      [40]byte // keep shards on different cache lines
+}
+
+var (
+	buffered  int32
+	shards    []shard
+	nextShard uint32
+	bufferMu  sync.Mutex
+	flushMu   sync.Mutex
+)
+
+// EnableBuffering collects events in per-CPU shards that are delivered to the sinks every interval,
+// instead of delivering every event immediately under a single lock. Within a delivered batch the
+// events are ordered by their sequence numbers, but an event can be delivered up to one interval late. Call Flush
+// before the program exits, to not lose the last events.
+func EnableBuffering(interval time.Duration) {
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+
+	if atomic.LoadInt32(&buffered) == 1 {
+		return
+	}
+
+	shards = make([]shard, runtime.GOMAXPROCS(0))
+	atomic.StoreInt32(&buffered, 1)
+
+	go func() {
+		for range time.Tick(interval) {
+			flushBuffer()
+		}
+	}()
+}
+
+// Flush delivers all buffered events to the sinks, and waits for sinks that buffer on their own,
+// i.e. implement a Flush method, to deliver them. Errors suppressed by SetMaxPerFunction are
+// summarized on the standard logger, the loops of SetLoopDetection by their LOOP events. So is the
+// time functions with timing ran before they failed, see ErrorLatencies.
+func Flush() {
+	flushLoops()
+	flushBuffer()
+	flushSinks()
+	logSuppressed()
+	logBenchmarked()
+	logLatencies()
+}
+
+func flushBuffer() {
+	if atomic.LoadInt32(&buffered) == 0 {
+		return
+	}
+
+	// collecting and delivering has to be atomic, to not deliver batches out of order
+	flushMu.Lock()
+	defer flushMu.Unlock()
+
+	var events []*Event
+	for i := range shards {
+		s := &shards[i]
+		s.mu.Lock()
+		events = append(events, s.events...)
+		s.events = nil
+		s.mu.Unlock()
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+	dispatch(events...)
+}
+
+func bufferEvent(e *Event) {
+	s := &shards[atomic.AddUint32(&nextShard, 1)%uint32(len(shards))]
+	s.mu.Lock()
+	s.events = append(s.events, e)
+	full := len(s.events) >= maxShardEvents
+	s.mu.Unlock()
+
+	if full {
+		flushBuffer()
+	}
+}
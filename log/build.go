@@ -0,0 +1,95 @@
+package log
+
+import (
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	buildMu sync.Mutex
+	build   atomic.Value // []Field, sorted by key
+
+	versionOnce sync.Once
+)
+
+// Build attaches metadata of the build, like the commit and the version, to all events. Instrumented code
+// calls it with the pairs of key and value given to errgotrace with -meta, every file of the program does.
+// Keys given again replace their value. It returns true so it can initialize a package variable.
+func Build(kv ...string) bool {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+
+	m := make(map[string]string)
+	old, _ := build.Load().([]Field)
+	for _, f := range old {
+		m[f.Key] = f.Value
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		m[kv[i]] = kv[i+1]
+	}
+
+	fields := make([]Field, 0, len(m))
+	for k, v := range m {
+		fields = append(fields, Field{Key: k, Value: v})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+	build.Store(fields)
+	return true
+}
+
+// the build metadata for new events, must not be modified
+func buildFields() []Field {
+	fields, _ := build.Load().([]Field)
+	return fields
+}
+
+// BuildVersion attaches the version of the program from its build info to all events. Instrumented code calls
+// it if errgotrace got metadata with -meta, but no version. It returns true so it can initialize a package variable.
+func BuildVersion() bool {
+	versionOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		if v := infoVersion(info); v != "" {
+			Build("version", v)
+		}
+	})
+	return true
+}
+
+// The version of the main module, or the revision it was built from with the time of the commit,
+// e.g. 3f2a1c0d9e8b-dirty@2024-05-02T10:00:00Z. Empty if the build info has neither.
+func infoVersion(info *debug.BuildInfo) string {
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+
+	var revision, time string
+	modified := false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			time = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return ""
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	if time != "" {
+		revision += "@" + time
+	}
+	return revision
+}
@@ -0,0 +1,30 @@
+package log
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestInfoVersion(t *testing.T) {
+	vcs := []debug.BuildSetting{
+		{Key: "vcs", Value: "git"},
+		{Key: "vcs.revision", Value: "3f2a1c0d9e8b7a6f5e4d3c2b1a0f9e8d7c6b5a49"},
+		{Key: "vcs.time", Value: "2024-05-02T10:00:00Z"},
+	}
+	for _, test := range []struct {
+		version  string
+		settings []debug.BuildSetting
+		want     string
+	}{
+		{"v1.4.2", vcs, "v1.4.2"},
+		{"(devel)", vcs, "3f2a1c0d9e8b@2024-05-02T10:00:00Z"},
+		{"", append(vcs, debug.BuildSetting{Key: "vcs.modified", Value: "true"}), "3f2a1c0d9e8b-dirty@2024-05-02T10:00:00Z"},
+		{"(devel)", vcs[:2], "3f2a1c0d9e8b"},
+		{"(devel)", nil, ""},
+	} {
+		info := &debug.BuildInfo{Main: debug.Module{Path: "example.com/app", Version: test.version}, Settings: test.settings}
+		if got := infoVersion(info); got != test.want {
+			t.Errorf("%s %v: got %q, expected %q", test.version, test.settings, got, test.want)
+		}
+	}
+}
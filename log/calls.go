@@ -0,0 +1,156 @@
+package log
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CallTrace marks the events of call tracing, which are not errors
+type CallTrace int
+
+const (
+	NoCall CallTrace = iota
+	CallEnter
+	CallExit
+
+	// CallSlow marks calls that exceeded the threshold of SetSlowThreshold, see Slow
+	CallSlow
+)
+
+func (c CallTrace) String() string {
+	switch c {
+	case CallEnter:
+		return "ENTER"
+	case CallExit:
+		return "EXIT"
+	case CallSlow:
+		return "SLOW"
+	}
+	return ""
+}
+
+// the instrumented calls each goroutine is in, innermost last
+var (
+	stackMu sync.Mutex
+	stacks  = make(map[uint64][]string)
+	spans   int32
+)
+
+// Span is a call started with Enter or Track
+type Span struct {
+	f     string
+	start time.Time
+	gid   uint64
+	depth int
+	trace bool
+}
+
+// Track records the call of the function without an event, so errors can be attributed to their caller:
+//
+//   defer __errgotrace.Track("pkg.Func").Exit()
+func Track(f string) *Span {
+	if !Enabled() || contextScoped() {
+		return nil
+	}
+
+	s := &Span{f: f, start: time.Now(), gid: goroutineID()}
+	stackMu.Lock()
+	s.depth = len(stacks[s.gid])
+	stacks[s.gid] = append(stacks[s.gid], f)
+	stackMu.Unlock()
+	atomic.AddInt32(&spans, 1)
+	return s
+}
+
+// Enter is Track with an ENTER event, the returned span has to be exited when the function returns:
+//
+//   defer __errgotrace.Enter("pkg.Func").Exit()
+func Enter(f string) *Span {
+	s := Track(f)
+	if s == nil {
+		return nil
+	}
+
+	s.trace = true
+	emitCall(&Event{Time: s.start, Func: f, Trace: CallEnter, Depth: s.depth, Caller: s.caller(), Path: s.path()})
+	return s
+}
+
+// Exit ends the call, spans of Enter emit an EXIT event with its duration. Calls whose Exit was skipped
+// by a panic are ended as well.
+func (s *Span) Exit() {
+	if s == nil {
+		return
+	}
+
+	now := time.Now()
+	caller, path := s.caller(), s.path()
+	stackMu.Lock()
+	if s.depth == 0 {
+		delete(stacks, s.gid)
+	} else if stack := stacks[s.gid]; len(stack) > s.depth {
+		stacks[s.gid] = stack[:s.depth]
+	}
+	stackMu.Unlock()
+	atomic.AddInt32(&spans, -1)
+
+	if s.trace {
+		emitCall(&Event{Time: now, Func: s.f, Trace: CallExit, Depth: s.depth, Caller: caller, Path: path, Duration: now.Sub(s.start)})
+	}
+}
+
+// the instrumented function the span was started in
+func (s *Span) caller() string {
+	stackMu.Lock()
+	defer stackMu.Unlock()
+	if stack := stacks[s.gid]; s.depth > 0 && len(stack) >= s.depth {
+		return stack[s.depth-1]
+	}
+	return ""
+}
+
+// the instrumented calls the span was started in, outermost first
+func (s *Span) path() []string {
+	stackMu.Lock()
+	defer stackMu.Unlock()
+	if stack := stacks[s.gid]; len(stack) >= s.depth {
+		return append([]string(nil), stack[:s.depth]...)
+	}
+	return nil
+}
+
+// Get the instrumented calls an error returned by f in the current goroutine happened in, outermost first.
+// Untracked functions are placed below the innermost call of the goroutine.
+func callPath(f string) []string {
+	if atomic.LoadInt32(&spans) == 0 {
+		return nil
+	}
+
+	gid := goroutineID()
+	stackMu.Lock()
+	defer stackMu.Unlock()
+	stack := stacks[gid]
+	n := len(stack)
+	if n > 0 && stack[n-1] == f {
+		n--
+	}
+	if n == 0 {
+		return nil
+	}
+	return append([]string(nil), stack[:n]...)
+}
+
+// Get the id of the current goroutine from its stack trace, the runtime doesn't expose it otherwise.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
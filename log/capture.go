@@ -0,0 +1,69 @@
+package log
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// limits of SetCapture, 0 for none
+var (
+	captureFor    int64
+	captureEvents int64
+)
+
+// state of the running capture, the end in unix nanoseconds and the events emitted since it was armed
+var (
+	captureUntil int64
+	captureCount int64
+)
+
+// SetCapture limits tracing to a window of d after it was enabled and to the first n events, after that
+// it is disabled as if Disable was called. The capture starts right away if tracing is enabled and again
+// with every Enable, so a bug can be reproduced on a shared system without logging forever. 0 removes a limit.
+func SetCapture(d time.Duration, n int) {
+	atomic.StoreInt64(&captureFor, int64(d))
+	atomic.StoreInt64(&captureEvents, int64(n))
+	if Enabled() {
+		armCapture()
+	}
+}
+
+// Start the window and the event count of the capture
+func armCapture() {
+	var until int64
+	if d := atomic.LoadInt64(&captureFor); d > 0 {
+		until = time.Now().Add(time.Duration(d)).UnixNano()
+	}
+	atomic.StoreInt64(&captureUntil, until)
+	atomic.StoreInt64(&captureCount, 0)
+}
+
+// Check if the window of the capture is over, the first caller seeing it disables tracing.
+func captureExpired() bool {
+	until := atomic.LoadInt64(&captureUntil)
+	if until == 0 || time.Now().UnixNano() < until {
+		return false
+	}
+	if atomic.CompareAndSwapInt64(&captureUntil, until, 0) {
+		Disable()
+		log.Printf("[ERRGOTRACE] capture of %s ended, tracing disabled", time.Duration(atomic.LoadInt64(&captureFor)))
+	}
+	return true
+}
+
+// Count an event for the capture, keep is false once the limit is reached. Tracing is disabled by
+// endCapture after the last event was delivered.
+func captured() (keep, last bool) {
+	max := atomic.LoadInt64(&captureEvents)
+	if max <= 0 {
+		return true, false
+	}
+	n := atomic.AddInt64(&captureCount, 1)
+	return n <= max, n == max
+}
+
+func endCapture() {
+	Disable()
+	log.Printf("[ERRGOTRACE] capture of %d events ended, tracing disabled", atomic.LoadInt64(&captureEvents))
+}
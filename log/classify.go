@@ -0,0 +1,49 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Classifier returns a tag for errors it recognizes, e.g. "retryable" or "timeout"
+type Classifier func(err error) (tag string, ok bool)
+
+var (
+	classifyMu  sync.Mutex
+	classifiers atomic.Value // []Classifier, replaced on every change
+)
+
+// Classify registers a classifier, the tags of all classifiers recognizing an error are attached to its event.
+func Classify(c Classifier) {
+	classifyMu.Lock()
+	defer classifyMu.Unlock()
+
+	old, _ := classifiers.Load().([]Classifier)
+	classifiers.Store(append(append([]Classifier(nil), old...), c))
+}
+
+// Get the tags of an error, in the order the classifiers were registered.
+func classify(err error) []string {
+	var tags []string
+	for _, c := range classifiersList() {
+		if tag, ok := safeClassify(c, err); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func classifiersList() []Classifier {
+	list, _ := classifiers.Load().([]Classifier)
+	return list
+}
+
+// a panicking classifier must not crash the program
+func safeClassify(c Classifier, err error) (tag string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			tag, ok = "", false
+		}
+	}()
+	return c(err)
+}
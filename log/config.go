@@ -0,0 +1,332 @@
+package log
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runtime configuration, read from the environment when the program starts.
+// More settings can be changed while the program runs with a configuration file, see Setup.
+var (
+	// ERRGOTRACE_PRESET=k8s applies the defaults for containers before the other variables, see PresetKubernetes
+
+	// ERRGOTRACE_PRIVACY=hash logs salted hashes instead of the values of arguments
+	hashValues bool
+
+	// ERRGOTRACE_SCRUB_QUERY=1 removes the query strings of the URLs of failed HTTP requests, see SetScrubQueries
+
+	// ERRGOTRACE_SALT is the salt for the hashes, random for every process if not set
+	hashSalt []byte
+
+	// ERRGOTRACE_SEQ=1 logs the sequence numbers of the events in the text output, see SetTextSequence
+
+	// ERRGOTRACE_NAMES=short logs functions without the directories of their import path, see SetShortNames
+
+	// ERRGOTRACE_SCOPE=context only traces calls with a context from WithTracing, see SetContextScope
+
+	// ERRGOTRACE_MAX_PER_FUNC=n only reports the first n occurrences of every distinct error of a function, see SetMaxPerFunction
+
+	// ERRGOTRACE_ORIGINS=mark marks events as ORIGIN or PROPAGATED, only drops the propagated ones, see TrackOrigins
+
+	// ERRGOTRACE_SLOW=200ms emits a SLOW event for calls with timing that ran longer, see SetSlowThreshold
+
+	// ERRGOTRACE_CAPTURE=30s and ERRGOTRACE_CAPTURE_EVENTS=n disable tracing after the duration or n events, see SetCapture
+
+	// ERRGOTRACE_ERRTYPE='*pq.Error|context.deadlineExceededError' and ERRGOTRACE_ERRMSG=regexp only trace matching
+	// errors, see SetErrorFilter
+
+	// ERRGOTRACE_LOOP=n and ERRGOTRACE_LOOP_WINDOW=10s summarize errors recurring more than n times within the
+	// window in LOOP events, see SetLoopDetection
+
+	// ERRGOTRACE_PANIC_ERRORS=n adds the last n errors of the goroutine to the report of a panic, see SetPanicErrors
+
+	// ERRGOTRACE_BENCH=1 only counts the events instead of emitting them, 0 turns off the detection of go test -bench,
+	// see SetBenchmarkMode
+
+	// ERRGOTRACE_BUFFER=100ms buffers events and delivers them every interval, see EnableBuffering
+
+	// ERRGOTRACE_EXPVAR=1 publishes error counters and the last ERRGOTRACE_EXPVAR_LAST errors via expvar
+
+	// ERRGOTRACE_STATSD=host:port counts errors on a statsd server, tagged with ERRGOTRACE_STATSD_TAGS=env:prod,...
+	// and the fields of With listed in ERRGOTRACE_STATSD_FIELDS=service,...
+
+	// ERRGOTRACE_OTLP=1 exports events as OTLP logs, configured with the OTEL_EXPORTER_OTLP_* variables
+
+	// ERRGOTRACE_SYSLOG=1 writes events to the local syslog daemon, a value other than 1 is used as the tag
+
+	// ERRGOTRACE_JOURNAL=1 sends events to journald, with structured ERRGO_* fields
+
+	// ERRGOTRACE_JSON=1 writes the events as JSON to stderr, a value other than 1 is the file to append them to
+
+	// ERRGOTRACE_AGENT=unix:///path or tcp://host:port sends events to an errgotrace agent, see NewAgentSink
+
+	// ERRGOTRACE_EXEC_SINK='command args' writes the events as JSON lines to the stdin of a command, see
+	// NewExecProcessor
+
+	// ERRGOTRACE_EXEC_FILTER='command args' passes the events to a command that may change or drop them, see
+	// ProcessorReply
+
+	// ERRGOTRACE_PLUGINS=a.so,b.so loads go plugins exporting a Sink or Filter, see AddFilter
+
+	// ERRGOTRACE_FOLDED=file writes the error counts per call path as folded stacks for flame graphs
+
+	// ERRGOTRACE_PROFILE=1 serves the errors as a pprof profile under /debug/errgotrace/profile, see ProfileHandler,
+	// and mutes functions under /debug/errgotrace/mute, see MuteHandler
+)
+
+const (
+	// window of the loop detection if ERRGOTRACE_LOOP_WINDOW isn't set
+	defaultLoopWindow = 10 * time.Second
+
+	// number of errors kept for expvar by default
+	defaultExpvarLast = 20
+
+	// statsd server used if the configuration file enables statsd without ERRGOTRACE_STATSD
+	defaultStatsdAddr = "localhost:8125"
+
+	// agent used if the configuration file enables agent without ERRGOTRACE_AGENT
+	defaultAgentAddr = "unix:///tmp/errgotrace.sock"
+
+	// folded stacks file used if the configuration file enables folded without ERRGOTRACE_FOLDED
+	defaultFoldedFile = "errgotrace.folded"
+)
+
+func init() {
+	loadEnv()
+}
+
+func loadEnv() {
+	switch os.Getenv("ERRGOTRACE_PRESET") {
+	case "k8s", "kubernetes":
+		PresetKubernetes()
+	case "":
+	default:
+		log.Printf("[ERRGOTRACE] unknown preset %q", os.Getenv("ERRGOTRACE_PRESET"))
+	}
+
+	hashValues = os.Getenv("ERRGOTRACE_PRIVACY") == "hash"
+
+	hashSalt = []byte(os.Getenv("ERRGOTRACE_SALT"))
+	if len(hashSalt) < 1 {
+		hashSalt = make([]byte, 16)
+		rand.Read(hashSalt)
+	}
+
+	if os.Getenv("ERRGOTRACE_SCRUB_QUERY") == "1" {
+		SetScrubQueries(true)
+	}
+
+	if os.Getenv("ERRGOTRACE_SEQ") == "1" {
+		SetTextSequence(true)
+	}
+	if os.Getenv("ERRGOTRACE_NAMES") == "short" {
+		SetShortNames(true)
+	}
+
+	if os.Getenv("ERRGOTRACE_SCOPE") == "context" {
+		SetContextScope(true)
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("ERRGOTRACE_MAX_PER_FUNC")); err == nil && n > 0 {
+		SetMaxPerFunction(n)
+	}
+
+	switch os.Getenv("ERRGOTRACE_ORIGINS") {
+	case "mark":
+		TrackOrigins(false)
+	case "only":
+		TrackOrigins(true)
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("ERRGOTRACE_SLOW")); err == nil && d > 0 {
+		SetSlowThreshold(d)
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("ERRGOTRACE_LOOP")); err == nil && n > 0 {
+		window, err := time.ParseDuration(os.Getenv("ERRGOTRACE_LOOP_WINDOW"))
+		if err != nil || window <= 0 {
+			window = defaultLoopWindow
+		}
+		SetLoopDetection(n, window)
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("ERRGOTRACE_PANIC_ERRORS")); err == nil && n > 0 {
+		SetPanicErrors(n)
+	}
+
+	loadErrorFilter(os.Getenv("ERRGOTRACE_ERRTYPE"), os.Getenv("ERRGOTRACE_ERRMSG"))
+
+	capture, _ := time.ParseDuration(os.Getenv("ERRGOTRACE_CAPTURE"))
+	events, _ := strconv.Atoi(os.Getenv("ERRGOTRACE_CAPTURE_EVENTS"))
+	if capture > 0 || events > 0 {
+		SetCapture(capture, events)
+	}
+
+	switch os.Getenv("ERRGOTRACE_BENCH") {
+	case "1":
+		SetBenchmarkMode(true)
+	case "0":
+	default:
+		SetBenchmarkMode(runsBenchmarks(os.Args[1:]))
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("ERRGOTRACE_BUFFER")); err == nil && d > 0 {
+		EnableBuffering(d)
+	}
+
+	for _, name := range []string{"expvar", "statsd", "syslog", "journal", "otlp", "folded", "json", "agent", "exec"} {
+		if !sinkEnabled(name) {
+			continue
+		}
+		if s, err := namedSink(name); err != nil {
+			log.Printf("[ERRGOTRACE] %s", err)
+		} else {
+			AddSink(s)
+		}
+	}
+
+	if sinkEnabled("profile") {
+		if s, err := namedSink("profile"); err == nil {
+			AddSink(s)
+			http.Handle(profilePath, s.(http.Handler))
+			http.Handle(mutePath, MuteHandler())
+		}
+	}
+
+	loadProcessors()
+}
+
+// Check if the sink is enabled by its environment variable
+func sinkEnabled(name string) bool {
+	switch name {
+	case "expvar":
+		return os.Getenv("ERRGOTRACE_EXPVAR") == "1"
+	case "statsd":
+		return os.Getenv("ERRGOTRACE_STATSD") != ""
+	case "syslog":
+		return os.Getenv("ERRGOTRACE_SYSLOG") != ""
+	case "journal":
+		return os.Getenv("ERRGOTRACE_JOURNAL") == "1"
+	case "otlp":
+		return os.Getenv("ERRGOTRACE_OTLP") == "1"
+	case "folded":
+		return os.Getenv("ERRGOTRACE_FOLDED") != ""
+	case "json":
+		return os.Getenv("ERRGOTRACE_JSON") != ""
+	case "agent":
+		return os.Getenv("ERRGOTRACE_AGENT") != ""
+	case "exec":
+		return os.Getenv("ERRGOTRACE_EXEC_SINK") != ""
+	case "profile":
+		return os.Getenv("ERRGOTRACE_PROFILE") == "1"
+	}
+	return false
+}
+
+// The built-in sinks are only created once, so the configuration file can switch between them.
+var (
+	namedMu    sync.Mutex
+	namedSinks = map[string]Sink{"log": logSink{}}
+)
+
+// NamedSink returns a built-in sink by the name used in the configuration file, e.g. statsd, configured with the
+// environment. The sinks are only created once.
+func NamedSink(name string) (Sink, error) {
+	return namedSink(name)
+}
+
+// Get a built-in sink by name, configured with the environment.
+func namedSink(name string) (Sink, error) {
+	namedMu.Lock()
+	defer namedMu.Unlock()
+
+	if s, ok := namedSinks[name]; ok {
+		return s, nil
+	}
+
+	var s Sink
+	var err error
+	switch name {
+	case "expvar":
+		last, perr := strconv.Atoi(os.Getenv("ERRGOTRACE_EXPVAR_LAST"))
+		if perr != nil || last < 0 {
+			last = defaultExpvarLast
+		}
+		s = newExpvarSink(last)
+	case "statsd":
+		addr := os.Getenv("ERRGOTRACE_STATSD")
+		if addr == "" {
+			addr = defaultStatsdAddr
+		}
+		var tags []string
+		if t := os.Getenv("ERRGOTRACE_STATSD_TAGS"); t != "" {
+			tags = strings.Split(t, ",")
+		}
+		if f := os.Getenv("ERRGOTRACE_STATSD_FIELDS"); f != "" {
+			SetStatsdFields(strings.Split(f, ",")...)
+		}
+		s, err = NewStatsdSink(addr, tags...)
+	case "syslog":
+		tag := os.Getenv("ERRGOTRACE_SYSLOG")
+		if tag == "1" {
+			tag = ""
+		}
+		s, err = NewSyslogSink(tag)
+	case "journal":
+		s, err = NewJournalSink()
+	case "otlp":
+		var o *OTLPSink
+		if o, err = otlpSinkFromEnv(); err == nil {
+			s = o
+		}
+	case "folded":
+		file := os.Getenv("ERRGOTRACE_FOLDED")
+		if file == "" {
+			file = defaultFoldedFile
+		}
+		s = NewFoldedSink(file)
+	case "profile":
+		s = newProfileSink()
+	case "console":
+		s, err = NewConsoleSink()
+	case "json":
+		s = NewJSONSink(os.Stderr)
+		if file := os.Getenv("ERRGOTRACE_JSON"); file != "" && file != "1" {
+			var f *os.File
+			if f, err = os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+				s = NewJSONSink(f)
+			} else {
+				err = fmt.Errorf("json: %s", err)
+			}
+		}
+	case "agent":
+		addr := os.Getenv("ERRGOTRACE_AGENT")
+		if addr == "" {
+			addr = defaultAgentAddr
+		}
+		var a *AgentSink
+		if a, err = NewAgentSink(addr); err == nil {
+			s = a
+		}
+	case "exec":
+		var p *ExecProcessor
+		if p, err = NewExecProcessor(os.Getenv("ERRGOTRACE_EXEC_SINK"), false); err == nil {
+			s = p
+		}
+	default:
+		err = fmt.Errorf("unknown sink %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	namedSinks[name] = s
+	return s, nil
+}
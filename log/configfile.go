@@ -0,0 +1,331 @@
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gellweiler/errgotrace/internal/yaml"
+)
+
+// defaultConfigFile is read by Setup if ERRGOTRACE_CONFIG is not set
+const defaultConfigFile = "errgotrace-runtime.yaml"
+
+// the configuration file is checked for changes this often
+const configPollInterval = 2 * time.Second
+
+// fileConfig is the part of the configuration that can change while the program runs
+type fileConfig struct {
+	functions *regexp.Regexp
+	exclude   *regexp.Regexp
+	ignore    []*regexp.Regexp
+	sample    float64
+	sampleSet bool
+	sampleBy  string
+	sinks     []Sink
+	budgets   []*budgetState
+}
+
+var (
+	setupOnce  sync.Once
+	liveConfig atomic.Value // *fileConfig
+
+	// the sinks before the configuration file replaced them, restored once it doesn't anymore, guarded by sinkMu
+	sinksBeforeConfig []Sink
+	configSetSinks    bool
+)
+
+// Setup reads the configuration file given by ERRGOTRACE_CONFIG, errgotrace-runtime.yaml in the working
+// directory by default, and watches it for changes. It's called by the instrumented code, e.g.
+//
+//   # only trace functions matching the regular expression
+//   functions: '^main\.'
+//   exclude: 'Close$'
+//   # errors whose messages match are not traced
+//   ignore: ['^EOF$', 'context canceled']
+//   # trace only a fraction of the errors
+//   sample: 0.1
+//   # always trace the first error of every fingerprint, only sample the repeats
+//   sample_by: fingerprint
+//   # replaces the sinks until the key is removed, built-in sinks are configured with the environment
+//   sinks: [log, journal, statsd]
+//   # emit an alert if the functions return more errors per minute
+//   budgets:
+//     - function: '^storage\.'
+//       per_minute: 100
+//
+// The ignore file given by ERRGOTRACE_IGNORE, errgotrace.ignore by default, is watched as well, see loadIgnoreFile.
+func Setup() bool {
+	setupOnce.Do(func() {
+		publishProvenance()
+		watch(configFileName(os.Getenv("ERRGOTRACE_CONFIG"), defaultConfigFile), applyConfigFile, removeConfigFile)
+		watch(configFileName(os.Getenv("ERRGOTRACE_IGNORE"), defaultIgnoreFile), applyIgnoreFile, func() {
+			liveIgnore.Store([]*regexp.Regexp(nil))
+		})
+	})
+	return true
+}
+
+// Get the file given by the environment, or the default file if it exists
+func configFileName(file, def string) string {
+	if file != "" {
+		return file
+	}
+	if _, err := os.Stat(def); err != nil {
+		return ""
+	}
+	return def
+}
+
+// Load the file and reload it whenever it changes, the first load happens before any instrumented code runs.
+func watch(file string, load func(file string) error, remove func()) {
+	if file == "" {
+		return
+	}
+
+	w := &configWatcher{file: file, size: -1, load: load, remove: remove}
+	w.check()
+	go func() {
+		for range time.Tick(configPollInterval) {
+			w.check()
+		}
+	}()
+}
+
+// configWatcher reloads a configuration file when it changes
+type configWatcher struct {
+	file  string
+	mtime time.Time
+	size  int64
+
+	load   func(file string) error
+	remove func()
+}
+
+// Reload the file if it changed, invalid files keep the last configuration.
+func (w *configWatcher) check() {
+	info, err := os.Stat(w.file)
+	if err != nil {
+		if w.size != -1 {
+			log.Printf("[ERRGOTRACE] %s: removed, its settings don't apply anymore", w.file)
+			w.remove()
+			w.mtime, w.size = time.Time{}, -1
+		}
+		return
+	}
+	if info.ModTime().Equal(w.mtime) && info.Size() == w.size {
+		return
+	}
+	w.mtime, w.size = info.ModTime(), info.Size()
+
+	if err := w.load(w.file); err != nil {
+		log.Printf("[ERRGOTRACE] %s", err)
+	}
+}
+
+func applyConfigFile(file string) error {
+	c, err := loadConfigFile(file)
+	if err != nil {
+		return err
+	}
+	liveConfig.Store(c)
+	applyConfigSinks(c.sinks)
+	return nil
+}
+
+func removeConfigFile() {
+	liveConfig.Store((*fileConfig)(nil))
+	applyConfigSinks(nil)
+}
+
+// Replace the sinks by those of the configuration file, without sinks in the file the previous ones are restored.
+func applyConfigSinks(s []Sink) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	if s == nil {
+		if configSetSinks {
+			sinks, sinksBeforeConfig, configSetSinks = sinksBeforeConfig, nil, false
+		}
+		return
+	}
+	if !configSetSinks {
+		sinksBeforeConfig, configSetSinks = sinks, true
+	}
+	sinks = append([]Sink(nil), s...)
+}
+
+func loadConfigFile(file string) (*fileConfig, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to open (%s)", file, err)
+	}
+
+	doc, err := yaml.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	c := &fileConfig{sample: 1}
+	if doc == nil {
+		return c, nil
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a mapping", file)
+	}
+
+	for key, v := range m {
+		var err error
+		switch key {
+		case "functions":
+			c.functions, err = configRegex(v)
+		case "exclude":
+			c.exclude, err = configRegex(v)
+		case "ignore":
+			c.ignore, err = configRegexList(v)
+		case "sample":
+			s, _ := v.(string)
+			c.sample, err = strconv.ParseFloat(s, 64)
+			c.sampleSet = true
+			if err != nil || c.sample < 0 || c.sample > 1 {
+				err = fmt.Errorf("expected a number between 0 and 1, got %v", v)
+			}
+		case "sample_by":
+			c.sampleBy, _ = v.(string)
+			if c.sampleBy != "call" && c.sampleBy != "fingerprint" {
+				err = fmt.Errorf("expected call or fingerprint, got %v", v)
+			}
+		case "sinks":
+			c.sinks, err = configSinks(v)
+		case "budgets":
+			c.budgets, err = configBudgets(v)
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", file, key, err)
+		}
+	}
+
+	return c, nil
+}
+
+func configRegex(v interface{}) (*regexp.Regexp, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a regular expression")
+	}
+	return regexp.Compile(s)
+}
+
+// A single regular expression or a sequence of them
+func configRegexList(v interface{}) ([]*regexp.Regexp, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+
+	var res []*regexp.Regexp
+	for _, item := range list {
+		r, err := configRegex(item)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func configSinks(v interface{}) ([]Sink, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a sequence of sink names")
+	}
+
+	sinks := []Sink{}
+	for _, item := range list {
+		name, _ := item.(string)
+		s, err := namedSink(name)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func configBudgets(v interface{}) ([]*budgetState, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a sequence")
+	}
+
+	var budgets []*budgetState
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("budget %d: expected a mapping", i+1)
+		}
+
+		b := &budgetState{}
+		for key, v := range m {
+			var err error
+			switch key {
+			case "function":
+				b.Functions, err = configRegex(v)
+			case "per_minute":
+				s, _ := v.(string)
+				b.PerMinute, err = strconv.Atoi(s)
+				if err != nil || b.PerMinute < 0 {
+					err = fmt.Errorf("expected a positive number, got %v", v)
+				}
+			default:
+				err = fmt.Errorf("unknown key")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("budget %d: %s: %s", i+1, key, err)
+			}
+		}
+		if _, ok := m["per_minute"]; !ok {
+			return nil, fmt.Errorf("budget %d: per_minute is missing", i+1)
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, nil
+}
+
+// Check if an error of the function should be traced according to the configuration file.
+func traced(f string, err error) bool {
+	if ignoredFunction(f) || !selectedError(err) {
+		return false
+	}
+
+	c, _ := liveConfig.Load().(*fileConfig)
+	if c == nil {
+		return sampled(nil, f, err)
+	}
+
+	switch {
+	case c.functions != nil && !matchName(c.functions, f):
+		return false
+	case c.exclude != nil && matchName(c.exclude, f):
+		return false
+	}
+
+	if len(c.ignore) > 0 {
+		msg := err.Error()
+		for _, r := range c.ignore {
+			if r.MatchString(msg) {
+				return false
+			}
+		}
+	}
+
+	return sampled(c, f, err)
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigSinksRestored(t *testing.T) {
+	resetRuntime(t)
+	dir, err := ioutil.TempDir("", "errgotrace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "errgotrace-runtime.yaml")
+
+	var got []string
+	SetSinks(SinkFunc(func(e *Event) { got = append(got, "mine") }))
+	w := &configWatcher{file: config, size: -1, load: applyConfigFile, remove: removeConfigFile}
+	write := func(content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(config, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// the size tells the versions apart, the modification time may not change
+		w.check()
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+		want   int // events the own sink gets
+	}{
+		{"without config", func() {}, 1},
+		{"sinks of the config", func() { write("sinks: []\n") }, 0},
+		{"reload keeping the sinks", func() { write("sinks: []\nsample: 1\n") }, 0},
+		{"sinks key removed", func() { write("sample: 1\n") }, 1},
+		{"sinks key added again", func() { write("sinks: []\nsample: 1.0\n") }, 0},
+		{"config removed", func() { os.Remove(config); w.check() }, 1},
+	}
+	for _, tt := range tests {
+		tt.change()
+		got = nil
+		InspectReturnValues("config.F", errBench)
+		Flush()
+		if len(got) != tt.want {
+			t.Errorf("%s: own sink got %d events, expected %d", tt.name, len(got), tt.want)
+		}
+	}
+}
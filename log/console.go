@@ -0,0 +1,33 @@
+//go:build js && wasm
+// +build js,wasm
+
+package log
+
+import "syscall/js"
+
+// consoleSink writes events to the console of the browser or of node, errors with console.error
+type consoleSink struct {
+	console js.Value
+}
+
+// NewConsoleSink returns a sink writing to the JavaScript console, the default sink under GOOS=js.
+func NewConsoleSink() (Sink, error) {
+	return consoleSink{js.Global().Get("console")}, nil
+}
+
+func (s consoleSink) Emit(e *Event) {
+	method := "error"
+	switch {
+	case e.Alert:
+		method = "warn"
+	case e.Trace != NoCall:
+		method = "info"
+	}
+	s.console.Call(method, "[ERRGOTRACE] "+e.Text())
+}
+
+// Events go to the console, the standard logger would only print them as plain text
+func platformSink() Sink {
+	s, _ := NewConsoleSink()
+	return s
+}
@@ -0,0 +1,22 @@
+//go:build !js || !wasm
+// +build !js !wasm
+
+package log
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// NewConsoleSink is only supported under GOOS=js.
+func NewConsoleSink() (Sink, error) {
+	return nil, fmt.Errorf("console: not supported on %s", runtime.GOOS)
+}
+
+// Processes without a console, like Windows services, write to a file instead of the standard logger
+func platformSink() Sink {
+	if s := fallbackSink(); s != nil {
+		return s
+	}
+	return logSink{}
+}
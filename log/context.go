@@ -0,0 +1,40 @@
+package log
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type tracingKey struct{}
+
+// set by SetContextScope or ERRGOTRACE_SCOPE=context
+var scoped int32
+
+// WithTracing marks a context, so errors of calls receiving it are traced when SetContextScope is on.
+// Requires the instrumentation with -context, to pass the context to the runtime.
+func WithTracing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tracingKey{}, true)
+}
+
+// Tracing reports whether the context was marked with WithTracing.
+func Tracing(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	on, _ := ctx.Value(tracingKey{}).(bool)
+	return on
+}
+
+// SetContextScope restricts tracing to calls with a context from WithTracing, e.g. to trace a single
+// request in a busy service. Errors of functions without a context parameter are not traced at all then.
+func SetContextScope(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&scoped, v)
+}
+
+func contextScoped() bool {
+	return atomic.LoadInt32(&scoped) == 1
+}
@@ -0,0 +1,129 @@
+package log
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Fields of known error types of other modules, read by reflection as errgotrace can't import them
+var knownErrorFields = map[string][]string{
+	"*pq.Error":         {"Severity", "Code", "Detail", "Hint", "Schema", "Table", "Column", "Constraint"},
+	"*pgconn.PgError":   {"Severity", "Code", "Detail", "Hint", "SchemaName", "TableName", "ColumnName", "ConstraintName"},
+	"*mysql.MySQLError": {"Number", "SQLState"},
+}
+
+// Extract the structured fields of an error and the errors it wraps: errors with a Fields() map[string]interface{}
+// method, slog.LogValuers and the errors of the standard library and database drivers that hold more than their
+// message. The fields of outer errors take precedence, errnos are logged by their name.
+func errorFields(err error) []Field {
+	var fields []Field
+	var seen map[string]bool
+	add := func(key string, v interface{}) {
+		if key == "" || seen[key] {
+			return
+		}
+		if seen == nil {
+			seen = make(map[string]bool)
+		}
+		seen[key] = true
+		fields = append(fields, Field{Key: key, Value: formatValue(v)})
+	}
+
+	walkErrorFields(err, 0, add)
+	return fields
+}
+
+// Collect the fields of the error and the errors it wraps, the depth protects against broken Unwrap methods.
+func walkErrorFields(err error, depth int, add func(key string, v interface{})) {
+	if err == nil || depth > maxPrettyDepth*4 {
+		return
+	}
+	collectErrorFields(err, add)
+
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		walkErrorFields(u.Unwrap(), depth+1, add)
+	case interface{ Unwrap() []error }:
+		for _, w := range u.Unwrap() {
+			walkErrorFields(w, depth+1, add)
+		}
+	}
+}
+
+// Collect the fields of a single error, without the errors it wraps.
+func collectErrorFields(err error, add func(key string, v interface{})) {
+	if f, ok := err.(interface{ Fields() map[string]interface{} }); ok {
+		m := f.Fields()
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			add(k, m[k])
+		}
+		return
+	}
+	if logValueFields(err, add) || errnoFields(err, add) {
+		return
+	}
+
+	switch e := err.(type) {
+	case *os.PathError:
+		add("op", e.Op)
+		add("path", e.Path)
+	case *os.LinkError:
+		add("op", e.Op)
+		add("old", e.Old)
+		add("new", e.New)
+	case *os.SyscallError:
+		add("syscall", e.Syscall)
+	case *net.OpError:
+		add("op", e.Op)
+		add("net", e.Net)
+		if e.Source != nil {
+			add("source", e.Source.String())
+		}
+		if e.Addr != nil {
+			add("addr", e.Addr.String())
+		}
+		netErrorFields(e, add)
+	case *net.DNSError:
+		add("name", e.Name)
+		if e.Server != "" {
+			add("server", e.Server)
+		}
+		netErrorFields(e, add)
+	case *net.AddrError:
+		add("addr", e.Addr)
+	case *url.Error:
+		httpErrorFields(e, add)
+		netErrorFields(e, add)
+	default:
+		if httpErrorFields(err, add) {
+			return
+		}
+		names := knownErrorFields[reflect.TypeOf(err).String()]
+		if names == nil {
+			return
+		}
+		v := reflect.ValueOf(err).Elem()
+		for _, name := range names {
+			f := v.FieldByName(name)
+			if !f.IsValid() || !f.CanInterface() || f.IsZero() {
+				continue
+			}
+			add(strings.ToLower(name), f.Interface())
+		}
+	}
+}
+
+// Add the flags of a network error, logged for every network error so failures can be told apart by them.
+func netErrorFields(e net.Error, add func(key string, v interface{})) {
+	add("timeout", e.Timeout())
+	add("temporary", e.Temporary())
+}
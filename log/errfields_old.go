@@ -0,0 +1,9 @@
+//go:build !go1.21
+// +build !go1.21
+
+package log
+
+// slog needs go 1.21
+func logValueFields(err error, add func(key string, v interface{})) bool {
+	return false
+}
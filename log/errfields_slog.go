@@ -0,0 +1,24 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+import "log/slog"
+
+// Add the attributes of an error implementing slog.LogValuer, false if it doesn't.
+func logValueFields(err error, add func(key string, v interface{})) bool {
+	lv, ok := err.(slog.LogValuer)
+	if !ok {
+		return false
+	}
+
+	v := lv.LogValue().Resolve()
+	if v.Kind() != slog.KindGroup {
+		add("value", v.Any())
+		return true
+	}
+	for _, a := range v.Group() {
+		add(a.Key, a.Value.Resolve().Any())
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package log
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// errorFilter selects the errors to trace by their dynamic type and message
+type errorFilter struct {
+	types   map[string]bool
+	message *regexp.Regexp
+}
+
+var errFilter atomic.Value // *errorFilter
+
+// SetErrorFilter only traces errors of one of the given dynamic types, written like %T prints them, e.g. *pq.Error
+// or context.deadlineExceededError, and whose messages match the regular expression. Errors wrapping an error of
+// the types match as well. No types and a nil expression remove the filters, to hunt down a single failure mode
+// in the whole program.
+func SetErrorFilter(types []string, message *regexp.Regexp) {
+	f := &errorFilter{message: message}
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			if f.types == nil {
+				f.types = make(map[string]bool)
+			}
+			f.types[t] = true
+		}
+	}
+	errFilter.Store(f)
+}
+
+// Read ERRGOTRACE_ERRTYPE, types separated by |, and the regular expression ERRGOTRACE_ERRMSG
+func loadErrorFilter(types, message string) {
+	if types == "" && message == "" {
+		return
+	}
+
+	var r *regexp.Regexp
+	if message != "" {
+		var err error
+		if r, err = regexp.Compile(message); err != nil {
+			log.Printf("[ERRGOTRACE] ERRGOTRACE_ERRMSG: %s", err)
+			return
+		}
+	}
+	SetErrorFilter(strings.Split(types, "|"), r)
+}
+
+// Check if the error passes the filters of SetErrorFilter.
+func selectedError(err error) bool {
+	f, _ := errFilter.Load().(*errorFilter)
+	if f == nil {
+		return true
+	}
+	if f.types != nil && !hasType(err, f.types, 0) {
+		return false
+	}
+	return f.message == nil || f.message.MatchString(err.Error())
+}
+
+// Check the error and the errors it wraps, the depth protects against broken Unwrap methods.
+func hasType(err error, types map[string]bool, depth int) bool {
+	if err == nil || depth > maxPrettyDepth*4 {
+		return false
+	}
+	if types[errorTypeName(err)] {
+		return true
+	}
+
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return hasType(u.Unwrap(), types, depth+1)
+	case interface{ Unwrap() []error }:
+		for _, w := range u.Unwrap() {
+			if hasType(w, types, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
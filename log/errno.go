@@ -0,0 +1,43 @@
+//go:build !plan9
+// +build !plan9
+
+package log
+
+import "syscall"
+
+// Names of the errnos I/O fails with most, the others are logged by their number
+var errnoNames = map[syscall.Errno]string{
+	syscall.EPERM:        "EPERM",
+	syscall.ENOENT:       "ENOENT",
+	syscall.EINTR:        "EINTR",
+	syscall.EBADF:        "EBADF",
+	syscall.EAGAIN:       "EAGAIN",
+	syscall.EACCES:       "EACCES",
+	syscall.EEXIST:       "EEXIST",
+	syscall.ENOTDIR:      "ENOTDIR",
+	syscall.EISDIR:       "EISDIR",
+	syscall.EINVAL:       "EINVAL",
+	syscall.EMFILE:       "EMFILE",
+	syscall.ENOSPC:       "ENOSPC",
+	syscall.EROFS:        "EROFS",
+	syscall.EPIPE:        "EPIPE",
+	syscall.ENOTEMPTY:    "ENOTEMPTY",
+	syscall.EADDRINUSE:   "EADDRINUSE",
+	syscall.ECONNREFUSED: "ECONNREFUSED",
+	syscall.ECONNRESET:   "ECONNRESET",
+	syscall.ETIMEDOUT:    "ETIMEDOUT",
+}
+
+// Add the errno of a failed system call, false if the error isn't one.
+func errnoFields(err error, add func(key string, v interface{})) bool {
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return false
+	}
+	if name, ok := errnoNames[errno]; ok {
+		add("errno", name)
+	} else {
+		add("errno", uint64(errno))
+	}
+	return true
+}
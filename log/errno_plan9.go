@@ -0,0 +1,6 @@
+package log
+
+// plan9 reports system call failures as strings, they have no errno
+func errnoFields(err error, add func(key string, v interface{})) bool {
+	return false
+}
@@ -0,0 +1,177 @@
+package log
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// set by SetTextSequence
+var textSequence int32
+
+// SetTextSequence appends the sequence number and the monotonic time of the events to their text, as
+// [seq: 42 at 1.5s]. The JSON events always have them.
+func SetTextSequence(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&textSequence, v)
+}
+
+// Field is a named, already formatted value of an event
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Event is a single error returned by an instrumented function, or a call if Trace is set.
+// Events are shared between all sinks and must not be modified.
+type Event struct {
+	Time  time.Time
+	Func  string
+	Error error
+
+	// ErrorFields are the structured fields of the error and the errors it wraps, see errorFields
+	ErrorFields []Field
+
+	// Trace is set for the ENTER and EXIT events of call tracing, they have no Error.
+	// Depth is the number of tracked calls the goroutine was in when the function was entered,
+	// Caller the innermost of them and Path all of them, outermost first. They are only known for
+	// calls and for errors with Track.
+	Trace  CallTrace
+	Depth  int
+	Caller string
+	Path   []string
+
+	// Goroutines are the instrumented goroutines the event happened in, the one started first first, e.g.
+	// the goroutine of a request handler followed by a worker it started. Only known for goroutines
+	// instrumented with -goroutines.
+	Goroutines []string
+
+	// Seq numbers the events of the process in the order they were emitted, Mono is the time since
+	// the start of the process on the monotonic clock. Both order events even if their times collide.
+	Seq  uint64
+	Mono time.Duration
+
+	// Fields attached with With, shared between events
+	Fields []Field
+
+	// Build is the metadata of the build given to errgotrace with -meta, see Build
+	Build []Field
+
+	// Tags of the classifiers registered with Classify
+	Tags []string
+
+	// Request is the method and path for HTTP handlers, Panic is set if the handler panicked
+	Request string
+	Panic   bool
+
+	// Before are the last errors of the goroutine of a panic, oldest first, see SetPanicErrors
+	Before []string
+
+	// Only set if the corresponding options were enabled for the function
+	Args     []Field
+	Receiver string
+	Duration time.Duration
+	Stack    string
+
+	// Alert is set for events reporting an exceeded error budget, Error describes the budget
+	Alert bool
+
+	// Loop is set for the LOOP events summarizing the repeats of the error, see SetLoopDetection
+	Loop *Loop
+
+	// Propagation is only set with TrackOrigins
+	Propagation Propagation
+}
+
+// Message returns the error message of the event, empty for calls
+func (e *Event) Message() string {
+	if e.Error == nil {
+		return ""
+	}
+	return e.Error.Error()
+}
+
+// Text formats the event the way it is written to the log, without the prefix.
+// Calls and errors are indented by their depth.
+func (e *Event) Text() string {
+	s := displayName(e.Func) + ": " + e.Message()
+	if e.Trace != NoCall {
+		s = e.Trace.String() + " " + displayName(e.Func)
+	}
+	if e.Propagation != Untracked {
+		s = e.Propagation.String() + " " + s
+	}
+	if e.Alert {
+		s = "ALERT " + s
+	}
+	if e.Loop != nil {
+		s = "LOOP " + s
+	}
+	s = strings.Repeat("  ", e.Depth) + s
+	if e.Loop != nil {
+		s += " [loop: " + e.Loop.String() + "]"
+	}
+	if len(e.ErrorFields) > 0 {
+		s += " [error fields: " + joinFields(e.ErrorFields) + "]"
+	}
+	if e.Caller != "" && e.Trace == NoCall {
+		s += " [caller: " + displayName(e.Caller) + "]"
+	}
+	if len(e.Goroutines) > 0 {
+		s += " [goroutine: " + strings.Join(e.Goroutines, " > ") + "]"
+	}
+	if len(e.Args) > 0 {
+		s += " [args: " + joinFields(e.Args) + "]"
+	}
+
+	if e.Request != "" {
+		s += " [request: " + e.Request + "]"
+	}
+
+	if len(e.Fields) > 0 {
+		s += " [fields: " + joinFields(e.Fields) + "]"
+	}
+
+	if len(e.Build) > 0 {
+		s += " [build: " + joinFields(e.Build) + "]"
+	}
+
+	if len(e.Tags) > 0 {
+		s += " [tags: " + strings.Join(e.Tags, ", ") + "]"
+	}
+
+	if e.Receiver != "" {
+		s += " [receiver: " + e.Receiver + "]"
+	}
+
+	if e.Duration > 0 {
+		s += " [took: " + e.Duration.String() + "]"
+	}
+
+	if e.Seq > 0 && atomic.LoadInt32(&textSequence) != 0 {
+		s += " [seq: " + strconv.FormatUint(e.Seq, 10) + " at " + e.Mono.String() + "]"
+	}
+
+	if len(e.Before) > 0 {
+		s += "\nerrors before the panic:\n  " + strings.Join(e.Before, "\n  ")
+	}
+
+	if e.Stack != "" {
+		s += "\n" + e.Stack
+	}
+
+	return s
+}
+
+// Format fields as k=v, separated by commas
+func joinFields(fields []Field) string {
+	var s []string
+	for _, f := range fields {
+		s = append(s, f.Key+"="+f.Value)
+	}
+	return strings.Join(s, ", ")
+}
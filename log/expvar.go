@@ -0,0 +1,60 @@
+package log
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// expvarSink publishes error counters per function and the last errors under the expvar "errgotrace"
+type expvarSink struct {
+	counts *expvar.Map
+
+	mu   sync.Mutex
+	last []expvarEvent
+	size int
+}
+
+type expvarEvent struct {
+	Time  time.Time `json:"time"`
+	Func  string    `json:"func"`
+	Error string    `json:"error"`
+}
+
+func newExpvarSink(size int) *expvarSink {
+	s := &expvarSink{counts: new(expvar.Map).Init(), size: size}
+
+	m := expvar.NewMap("errgotrace")
+	m.Set("errors", s.counts)
+	m.Set("last", expvar.Func(s.lastEvents))
+	return s
+}
+
+// Calls are not published, only errors
+func (s *expvarSink) Emit(e *Event) {
+	if e.Trace != NoCall {
+		return
+	}
+	if !e.Alert {
+		s.counts.Add(e.Func, int64(e.occurrences()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = append(s.last, expvarEvent{Time: e.Time, Func: e.Func, Error: e.Message()})
+	if len(s.last) > s.size {
+		s.last = s.last[len(s.last)-s.size:]
+	}
+}
+
+// the last errors, newest first
+func (s *expvarSink) lastEvents() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]expvarEvent, len(s.last))
+	for i, e := range s.last {
+		events[len(s.last)-1-i] = e
+	}
+	return events
+}
@@ -0,0 +1,38 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	fieldsMu sync.Mutex
+	ambient  atomic.Value // []Field, replaced on every change
+)
+
+// With attaches a field, e.g. the service name or the build, to all events emitted afterwards.
+// Setting a key again replaces its value. Strings are used as they are, other values are formatted once,
+// fields are never hashed or redacted.
+func With(key string, value interface{}) {
+	fieldsMu.Lock()
+	defer fieldsMu.Unlock()
+
+	old, _ := ambient.Load().([]Field)
+	fields := make([]Field, 0, len(old)+1)
+	for _, f := range old {
+		if f.Key != key {
+			fields = append(fields, f)
+		}
+	}
+	s, ok := value.(string)
+	if !ok {
+		s = prettyPrint(value)
+	}
+	ambient.Store(append(fields, Field{Key: key, Value: s}))
+}
+
+// the fields for new events, must not be modified
+func ambientFields() []Field {
+	fields, _ := ambient.Load().([]Field)
+	return fields
+}
@@ -0,0 +1,72 @@
+package log
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSink appends the events to a file, in the format of the standard logger
+type FileSink struct {
+	f *os.File
+}
+
+// NewFileSink opens the file for appending, it is created if it doesn't exist.
+func NewFileSink(file string) (*FileSink, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("file: %s", err)
+	}
+	return &FileSink{f}, nil
+}
+
+// Writing is best effort, like the standard logger
+func (s *FileSink) Emit(e *Event) {
+	fmt.Fprintf(s.f, "%s [ERRGOTRACE] %s%s", e.Time.Format("2006/01/02 15:04:05"), textLines(e.Text()), newline)
+}
+
+// Use the line endings of the platform in the output of the text sinks
+func textLines(s string) string {
+	if newline == "\n" {
+		return s
+	}
+	return strings.Replace(s, "\n", newline, -1)
+}
+
+var (
+	fallbackOnce sync.Once
+	fallback     Sink
+	// replaced by the tests
+	consoleLost = stderrLost
+)
+
+// Get the sink replacing the standard logger of a process without a console, e.g. a Windows service.
+// The events are written to a file in the temporary directory, whose path is logged once.
+func fallbackSink() Sink {
+	fallbackOnce.Do(func() {
+		if s := openFallbackSink(); s != nil {
+			fallback = s
+		}
+	})
+	return fallback
+}
+
+func openFallbackSink() *FileSink {
+	if !consoleLost() {
+		return nil
+	}
+
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	file := filepath.Join(os.TempDir(), "errgotrace-"+name+".log")
+	s, err := NewFileSink(file)
+	if err != nil {
+		return nil
+	}
+	fmt.Fprintf(s.f, "%s [ERRGOTRACE] no console, events of process %d are written to %s%s", time.Now().Format("2006/01/02 15:04:05"), os.Getpid(), file, newline)
+	log.Printf("[ERRGOTRACE] no console, events are written to %s", file)
+	return s
+}
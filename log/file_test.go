@@ -0,0 +1,150 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Pretend to run on a platform, with or without a console, and in a temporary directory of its own.
+func fakePlatform(t *testing.T, lost bool, eol string, tmp string) {
+	oldLost, oldNewline := consoleLost, newline
+	consoleLost = func() bool { return lost }
+	newline = eol
+	fallbackOnce, fallback = sync.Once{}, nil
+	t.Cleanup(func() {
+		consoleLost, newline = oldLost, oldNewline
+		fallbackOnce, fallback = sync.Once{}, nil
+	})
+	// os.TempDir reads TMPDIR on unix and TMP or TEMP on Windows
+	for _, env := range []string{"TMPDIR", "TMP", "TEMP"} {
+		t.Setenv(env, tmp)
+	}
+}
+
+// Capture the output of the standard logger.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	flags := stdlog.Flags()
+	stdlog.SetOutput(&buf)
+	stdlog.SetFlags(0)
+	t.Cleanup(func() {
+		stdlog.SetOutput(os.Stderr)
+		stdlog.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestFallbackSink(t *testing.T) {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	tests := []struct {
+		name    string
+		lost    bool
+		eol     string
+		missing bool // the temporary directory doesn't exist
+		file    bool
+	}{
+		{name: "console", eol: "\r\n"},
+		{name: "service", lost: true, eol: "\r\n", file: true},
+		{name: "service unix newlines", lost: true, eol: "\n", file: true},
+		{name: "service without temporary directory", lost: true, eol: "\r\n", missing: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			if tt.missing {
+				tmp = filepath.Join(tmp, "missing")
+			}
+			fakePlatform(t, tt.lost, tt.eol, tmp)
+			logged := captureLog(t)
+
+			s := fallbackSink()
+			if again := fallbackSink(); again != s {
+				t.Error("the fallback sink changed")
+			}
+			if _, ok := platformSink().(logSink); ok == tt.file {
+				t.Errorf("got platform sink %T, expected a file sink: %v", platformSink(), tt.file)
+			}
+			if !tt.file {
+				if s != nil {
+					t.Errorf("expected no fallback sink, got %T", s)
+				}
+				if logged.Len() != 0 {
+					t.Errorf("expected nothing to be logged, got %q", logged)
+				}
+				return
+			}
+
+			file := filepath.Join(tmp, "errgotrace-"+name+".log")
+			if want := "[ERRGOTRACE] no console, events are written to " + file + "\n"; logged.String() != want {
+				t.Errorf("got log %q, expected the path once: %q", logged, want)
+			}
+			s.Emit(&Event{Time: time.Now(), Func: "svc.Run", Error: errors.New("failed")})
+			s.(*FileSink).f.Close()
+
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.SplitAfter(string(data), tt.eol)
+			if len(lines) != 3 || lines[2] != "" || strings.Count(string(data), "\n") != 2 {
+				t.Fatalf("expected the header and one event, got %q", data)
+			}
+			if !strings.Contains(lines[0], "no console") || !strings.Contains(lines[0], file) {
+				t.Errorf("got header %q, expected the path of the file", lines[0])
+			}
+			if !strings.HasSuffix(lines[1], "[ERRGOTRACE] svc.Run: failed"+tt.eol) {
+				t.Errorf("got event %q", lines[1])
+			}
+		})
+	}
+}
+
+// The text sinks end every line of an event with the newline of the platform, without doubling CRLF.
+func TestTextSinkNewlines(t *testing.T) {
+	tests := []struct {
+		name string
+		eol  string
+		err  string
+		want string
+	}{
+		{"unix", "\n", "failed", "svc.Run: failed\n"},
+		{"unix multiline", "\n", "failed:\nline 2", "svc.Run: failed:\nline 2\n"},
+		{"windows", "\r\n", "failed", "svc.Run: failed\r\n"},
+		{"windows multiline", "\r\n", "failed:\nline 2", "svc.Run: failed:\r\nline 2\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePlatform(t, false, tt.eol, t.TempDir())
+			e := &Event{Time: time.Now(), Func: "svc.Run", Error: errors.New(tt.err)}
+
+			logged := captureLog(t)
+			logSink{}.Emit(e)
+			if got := strings.TrimPrefix(logged.String(), "[ERRGOTRACE] "); got != tt.want {
+				t.Errorf("standard logger: got %q, expected %q", got, tt.want)
+			}
+
+			file := filepath.Join(t.TempDir(), "errgotrace.log")
+			s, err := NewFileSink(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Emit(e)
+			s.f.Close()
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(data); !strings.HasSuffix(got, " [ERRGOTRACE] "+tt.want) {
+				t.Errorf("file: got %q, expected it to end with %q", got, tt.want)
+			}
+		})
+	}
+}
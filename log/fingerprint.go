@@ -0,0 +1,46 @@
+package log
+
+import (
+	"regexp"
+	"sync"
+)
+
+// number of fingerprints remembered for the sampling, the oldest are forgotten first
+const maxFingerprints = 4096
+
+var (
+	fingerprintMu   sync.Mutex
+	fingerprints    = make(map[string]bool)
+	fingerprintRing []string
+	fingerprintPos  int
+)
+
+// numbers and hex values in messages, like ids, ports and addresses, don't make an error distinct
+var variablePart = regexp.MustCompile(`0x[0-9a-fA-F]+|[0-9]+`)
+
+// Identify the failure mode of an error by the function, its dynamic type and its message without numbers,
+// e.g. main.dial *net.OpError dial tcp #.#.#.#:#: connect: connection refused
+func fingerprint(f string, err error) string {
+	return f + " " + errorTypeName(err) + " " + variablePart.ReplaceAllString(err.Error(), "#")
+}
+
+// Check if the fingerprint of the error wasn't seen before and remember it.
+func novelError(f string, err error) bool {
+	fp := fingerprint(f, err)
+
+	fingerprintMu.Lock()
+	defer fingerprintMu.Unlock()
+	if fingerprints[fp] {
+		return false
+	}
+
+	if len(fingerprintRing) < maxFingerprints {
+		fingerprintRing = append(fingerprintRing, fp)
+	} else {
+		delete(fingerprints, fingerprintRing[fingerprintPos])
+		fingerprintRing[fingerprintPos] = fp
+		fingerprintPos = (fingerprintPos + 1) % maxFingerprints
+	}
+	fingerprints[fp] = true
+	return true
+}
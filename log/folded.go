@@ -0,0 +1,98 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the folded stacks are written this often if they changed
+const foldedInterval = time.Second
+
+// FoldedSink counts errors per call path and writes them as folded stacks, one line per path
+// with the functions separated by semicolons and the count, e.g.
+//
+//   main.top;main.middle;main.leaf 3
+//
+// The file can be rendered by flamegraph.pl or speedscope. Call paths are only known for functions
+// instrumented with -depth or -calls, others appear as roots. Call Flush before exiting.
+type FoldedSink struct {
+	file string
+
+	mu     sync.Mutex
+	counts map[string]int
+	dirty  bool
+}
+
+// NewFoldedSink creates a sink rewriting the given file with the folded stacks every second.
+func NewFoldedSink(file string) *FoldedSink {
+	s := &FoldedSink{file: file, counts: make(map[string]int)}
+	go func() {
+		for range time.Tick(foldedInterval) {
+			s.Flush()
+		}
+	}()
+	return s
+}
+
+// Only errors are counted, alerts and calls are not
+func (s *FoldedSink) Emit(e *Event) {
+	if e.Alert || e.Trace != NoCall {
+		return
+	}
+
+	stack := strings.Join(append(append([]string(nil), e.Path...), e.Func), ";")
+	s.mu.Lock()
+	s.counts[foldedFrame(stack)] += e.occurrences()
+	s.dirty = true
+	s.mu.Unlock()
+}
+
+// Flush writes the file if errors were counted since the last write.
+func (s *FoldedSink) Flush() {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	var stacks []string
+	for stack := range s.counts {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	var buf bytes.Buffer
+	for _, stack := range stacks {
+		buf.WriteString(stack + " " + strconv.Itoa(s.counts[stack]) + "\n")
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err := writeFileAtomic(s.file, buf.Bytes()); err != nil {
+		log.Printf("[ERRGOTRACE] %s", err)
+	}
+}
+
+// Spaces separate the count, they must not appear in the frames
+func foldedFrame(s string) string {
+	return strings.Replace(s, " ", "_", -1)
+}
+
+// Write the file via a temporary file, so readers never see a partial file.
+func writeFileAtomic(file string, data []byte) error {
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("%s: failed to write (%s)", tmp, err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("%s: failed to write (%s)", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+)
+
+// Format a value for the output, in privacy mode only a hash of the value is shown.
+// The same value always gets the same hash, as long as the salt stays the same.
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok && s == Redacted {
+		return Redacted
+	}
+	return hashValue(prettyPrint(v))
+}
+
+func hashValue(s string) string {
+	if !hashValues {
+		return s
+	}
+
+	mac := hmac.New(sha256.New, hashSalt)
+	mac.Write([]byte(s))
+	return "#" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// receiver snapshots are cut after this many bytes
+const maxReceiverLength = 512
+
+// the default of the -redact flag of errgotrace, for the field names of receivers
+var defaultRedactFields = regexp.MustCompile(`(?i)passw|secret|token|credential|api_?key|private_?key`)
+
+type fieldRedaction struct {
+	names *regexp.Regexp
+}
+
+var redactFields atomic.Value // *fieldRedaction
+
+// SetRedactFields logs Redacted instead of the values of receiver fields whose names match the
+// regular expression, nested fields included. By default names like Password, Token or apiKey
+// match, nil turns the redaction off.
+func SetRedactFields(names *regexp.Regexp) {
+	redactFields.Store(&fieldRedaction{names})
+}
+
+func redactedName(name string) bool {
+	r := defaultRedactFields
+	if f, _ := redactFields.Load().(*fieldRedaction); f != nil {
+		r = f.names
+	}
+	return r != nil && r.MatchString(name)
+}
+
+// Format the receiver of a method, either completely or only the given exported fields.
+func formatReceiver(v interface{}, fields []string) string {
+	p := newPrettyPrinter(maxReceiverLength)
+	p.redact = true
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if len(fields) < 1 || rv.Kind() != reflect.Struct {
+		return hashValue(p.format(v))
+	}
+
+	n := 0
+	for _, name := range fields {
+		f := rv.FieldByName(name)
+		if !f.IsValid() || !f.CanInterface() {
+			continue
+		}
+		if p.full {
+			break
+		}
+		if n > 0 {
+			p.write(", ")
+		}
+		n++
+
+		p.write(name + "=")
+		if redactedName(name) {
+			p.write(Redacted)
+			continue
+		}
+		// each field is hashed on its own, the budget is shared
+		fp := newPrettyPrinter(p.remaining)
+		fp.redact = true
+		p.write(hashValue(fp.format(f.Interface())))
+	}
+	return p.buf.String()
+}
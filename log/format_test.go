@@ -0,0 +1,64 @@
+package log
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type receiverAuth struct {
+	Password string
+}
+
+type receiverClient struct {
+	User   string
+	Token  string
+	apiKey string
+	Auth   receiverAuth
+	Tags   map[string]string
+}
+
+func TestFormatReceiverRedacts(t *testing.T) {
+	t.Cleanup(func() { SetRedactFields(defaultRedactFields) })
+	c := &receiverClient{User: "bob", Token: "t0k3n", apiKey: "k3y", Auth: receiverAuth{"hunter2"}}
+
+	s := formatReceiver(c, nil)
+	if strings.Contains(s, "t0k3n") || strings.Contains(s, "k3y") || strings.Contains(s, "hunter2") {
+		t.Errorf("got %s, expected the secrets to be redacted", s)
+	}
+	if want := `&log.receiverClient{User: "bob", Token: [REDACTED], apiKey: [REDACTED], Auth: log.receiverAuth{Password: [REDACTED]}, Tags: nil}`; s != want {
+		t.Errorf("got\n%s\nexpected\n%s", s, want)
+	}
+
+	if s := formatReceiver(c, []string{"User", "Token", "Auth"}); s != `User="bob", Token=[REDACTED], Auth=log.receiverAuth{Password: [REDACTED]}` {
+		t.Errorf("got %s", s)
+	}
+
+	SetRedactFields(regexp.MustCompile(`^User$`))
+	if s := formatReceiver(c, []string{"User", "Token"}); s != `User=[REDACTED], Token="t0k3n"` {
+		t.Errorf("got %s, expected the names of SetRedactFields", s)
+	}
+	SetRedactFields(nil)
+	if s := formatReceiver(c, []string{"User", "Token"}); s != `User="bob", Token="t0k3n"` {
+		t.Errorf("got %s, expected no redaction", s)
+	}
+
+	// arguments are only redacted by the generated code
+	if s := prettyPrint(receiverAuth{"hunter2"}); s != `log.receiverAuth{Password: "hunter2"}` {
+		t.Errorf("got %s", s)
+	}
+}
+
+func TestFormatReceiverLength(t *testing.T) {
+	c := &receiverClient{User: strings.Repeat("u", 200), Tags: make(map[string]string)}
+	for i := 0; i < 1000; i++ {
+		c.Tags[strings.Repeat("k", i%50)+string(rune('a'+i%26))+strings.Repeat("v", i)] = strings.Repeat("v", 200)
+	}
+
+	for _, fields := range [][]string{nil, {"User", "Tags"}, {"Tags", "User", "Tags"}} {
+		s := formatReceiver(c, fields)
+		if len(s) > maxReceiverLength+len("...") || !strings.HasSuffix(s, "...") {
+			t.Errorf("got %d bytes ending in %q, expected at most %d cut off with ...", len(s), s[len(s)-10:], maxReceiverLength)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package log
+
+import (
+	"net/http"
+)
+
+// RecoverRequest is deferred by instrumented HTTP handlers, it reports a panic of the handler
+// together with the request and then panics again, so the server handles it as usual.
+func RecoverRequest(f string, r *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	// http.ErrAbortHandler is the intended way to abort a response
+	if v != http.ErrAbortHandler {
+		reportPanic(f, v, r)
+	}
+	panic(v)
+}
+
+// method and path of a request
+func describeRequest(r *http.Request) string {
+	if r == nil || r.URL == nil {
+		return ""
+	}
+	return r.Method + " " + r.URL.Path
+}
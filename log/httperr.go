@@ -0,0 +1,120 @@
+package log
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// 1 if the query strings of logged URLs are replaced by Redacted
+var scrubQueries int32
+
+// SetScrubQueries replaces the query strings and fragments of the URLs of failed HTTP requests in the error
+// fields and the error messages by Redacted, they often hold tokens and personal data.
+func SetScrubQueries(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&scrubQueries, v)
+}
+
+func scrubbingQueries() bool {
+	return atomic.LoadInt32(&scrubQueries) == 1
+}
+
+// Remove the query string and fragment of a URL if the scrubbing is on.
+func scrubURL(raw string) string {
+	if !scrubbingQueries() {
+		return raw
+	}
+	i := strings.IndexAny(raw, "?#")
+	if i < 0 {
+		return raw
+	}
+	return raw[:i] + "?" + Redacted
+}
+
+// scrubbedError is an error with the query strings of the URLs in its message removed, it unwraps to
+// the original error.
+type scrubbedError struct {
+	err error
+	msg string
+}
+
+func (e *scrubbedError) Error() string {
+	return e.msg
+}
+
+func (e *scrubbedError) Unwrap() error {
+	return e.err
+}
+
+// Scrub the URL of a failed request from the message of an error if the scrubbing is on.
+func scrubError(err error) error {
+	var ue *url.Error
+	if err == nil || !scrubbingQueries() || !errors.As(err, &ue) {
+		return err
+	}
+	scrubbed := scrubURL(ue.URL)
+	if scrubbed == ue.URL {
+		return err
+	}
+	return &scrubbedError{err, strings.Replace(err.Error(), ue.URL, scrubbed, -1)}
+}
+
+// Add the method, URL and status code of a failed HTTP request, false if the error doesn't describe one.
+// The status comes from a StatusCode() or HTTPStatusCode() method, a StatusCode field or the http.Response
+// a client error holds in its Response field.
+func httpErrorFields(err error, add func(key string, v interface{})) bool {
+	if e, ok := err.(*url.Error); ok {
+		add("method", strings.ToUpper(e.Op))
+		add("url", scrubURL(e.URL))
+		return true
+	}
+
+	found := false
+	switch s := err.(type) {
+	case interface{ StatusCode() int }:
+		add("status", s.StatusCode())
+		found = true
+	case interface{ HTTPStatusCode() int }:
+		add("status", s.HTTPStatusCode())
+		found = true
+	}
+
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return found
+	}
+	if f := v.FieldByName("StatusCode"); f.IsValid() && f.Kind() == reflect.Int && f.Int() != 0 {
+		add("status", int(f.Int()))
+		found = true
+	}
+	f := v.FieldByName("Response")
+	if !f.IsValid() || !f.CanInterface() {
+		return found
+	}
+	resp, ok := f.Interface().(*http.Response)
+	if !ok || resp == nil {
+		return found
+	}
+	if resp.Request != nil {
+		add("method", resp.Request.Method)
+		if resp.Request.URL != nil {
+			u := *resp.Request.URL
+			if _, has := u.User.Password(); has {
+				u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			}
+			add("url", scrubURL(u.String()))
+		}
+	}
+	add("status", resp.StatusCode)
+	return true
+}
@@ -0,0 +1,69 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultIgnoreFile is read by Setup if ERRGOTRACE_IGNORE is not set
+const defaultIgnoreFile = "errgotrace.ignore"
+
+var liveIgnore atomic.Value // []*regexp.Regexp
+
+// Load an ignore file, a list of regular expressions matching the functions whose events are dropped,
+// one per line. Empty lines and lines starting with # are skipped, e.g.
+//
+//   # closing idle connections always fails on shutdown
+//   ^storage\.\*Client\.Close$
+//   ^cache\.
+//
+// Unlike -exclude the list applies to the events, whatever was instrumented.
+func loadIgnoreFile(file string) ([]*regexp.Regexp, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to open (%s)", file, err)
+	}
+
+	list := []*regexp.Regexp{}
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", file, n, err)
+		}
+		list = append(list, r)
+	}
+	return list, scanner.Err()
+}
+
+func applyIgnoreFile(file string) error {
+	list, err := loadIgnoreFile(file)
+	if err != nil {
+		return err
+	}
+	liveIgnore.Store(list)
+	return nil
+}
+
+// Check if the ignore file or Mute drops the events of the function.
+func ignoredFunction(f string) bool {
+	if mutedFunction(f) {
+		return true
+	}
+	list, _ := liveIgnore.Load().([]*regexp.Regexp)
+	for _, r := range list {
+		if matchName(r, f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package log
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/gellweiler/errgotrace/log/schema"
+)
+
+// Schema returns the event in the versioned form of the schema package, as written by the JSON sink
+func (e *Event) Schema() *schema.Event {
+	s := &schema.Event{
+		SchemaVersion: schema.Version,
+		Time:          e.Time,
+		Func:          e.Func,
+		Error:         e.Message(),
+		ErrorFields:   schemaFields(e.ErrorFields),
+		Call:          e.Trace.String(),
+		Alert:         e.Alert,
+		Propagation:   e.Propagation.String(),
+		Depth:         e.Depth,
+		Caller:        e.Caller,
+		Path:          e.Path,
+		Goroutines:    e.Goroutines,
+		Seq:           e.Seq,
+		MonoNs:        int64(e.Mono),
+		Fields:        schemaFields(e.Fields),
+		Build:         schemaFields(e.Build),
+		Tags:          e.Tags,
+		Request:       e.Request,
+		Panic:         e.Panic,
+		ErrorsBefore:  e.Before,
+		Args:          schemaFields(e.Args),
+		Receiver:      e.Receiver,
+		DurationNs:    int64(e.Duration),
+		Stack:         e.Stack,
+	}
+	if e.Error != nil {
+		s.ErrorType = errorTypeName(e.Error)
+	}
+	if e.Loop != nil {
+		s.Loop = &schema.Loop{Count: e.Loop.Count, Suppressed: e.Loop.Suppressed, First: e.Loop.First, Last: e.Loop.Last}
+	}
+	return s
+}
+
+func schemaFields(fields []Field) []schema.Field {
+	var s []schema.Field
+	for _, f := range fields {
+		s = append(s, schema.Field{Key: f.Key, Value: f.Value})
+	}
+	return s
+}
+
+// jsonSink writes the events as JSON objects of the schema package, one per line
+type jsonSink struct {
+	w io.Writer
+}
+
+// NewJSONSink creates a sink writing the events to w in the versioned JSON form of the schema package,
+// which schema.Decoder reads.
+func NewJSONSink(w io.Writer) Sink {
+	return jsonSink{w}
+}
+
+func (s jsonSink) Emit(e *Event) {
+	data, _ := json.Marshal(e.Schema())
+	s.w.Write(append(data, '\n'))
+}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// number of durations kept per function, later errors replace random ones so they stay a uniform sample
+const maxLatencySamples = 1024
+
+// Latency is the time functions with timing ran before they returned an error
+type Latency struct {
+	Count int
+	P50   time.Duration
+	P95   time.Duration
+}
+
+// the durations of the errors of a function
+type latencySamples struct {
+	mu      sync.Mutex
+	count   int
+	samples []time.Duration
+}
+
+var errorLatencies sync.Map // string -> *latencySamples
+
+// Remember how long the function ran before it failed, only known with timing.
+func recordLatency(e *Event) {
+	if e.Duration <= 0 || e.Alert || e.Trace != NoCall {
+		return
+	}
+
+	v, ok := errorLatencies.Load(e.Func)
+	if !ok {
+		v, _ = errorLatencies.LoadOrStore(e.Func, &latencySamples{})
+	}
+	l := v.(*latencySamples)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	if len(l.samples) < maxLatencySamples {
+		l.samples = append(l.samples, e.Duration)
+	} else if i := rand.Intn(l.count); i < maxLatencySamples {
+		l.samples[i] = e.Duration
+	}
+}
+
+// ErrorLatencies returns the median and 95th percentile of the time to failure per function, for the
+// functions instrumented with timing. The percentiles of functions with many errors are estimated
+// from a sample. Timeouts show up as a p50 close to the timeout.
+func ErrorLatencies() map[string]Latency {
+	m := make(map[string]Latency)
+	errorLatencies.Range(func(k, v interface{}) bool {
+		l := v.(*latencySamples)
+		l.mu.Lock()
+		sorted := append([]time.Duration(nil), l.samples...)
+		count := l.count
+		l.mu.Unlock()
+
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		m[k.(string)] = Latency{Count: count, P50: percentile(sorted, 50), P95: percentile(sorted, 95)}
+		return true
+	})
+	return m
+}
+
+// The nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) < 1 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	if i < 1 {
+		i = 1
+	}
+	return sorted[i-1]
+}
+
+// Write the time to failure of every function to the standard logger.
+func logLatencies() {
+	latencies := ErrorLatencies()
+	var funcs []string
+	for f := range latencies {
+		funcs = append(funcs, f)
+	}
+	sort.Strings(funcs)
+
+	for _, f := range funcs {
+		l := latencies[f]
+		log.Printf("[ERRGOTRACE] %s: %d errors after p50 %s, p95 %s\n", f, l.Count, l.P50, l.P95)
+	}
+}
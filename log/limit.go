@@ -0,0 +1,111 @@
+package log
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// maximum number of events per function and error, 0 for unlimited
+var maxPerFunc int64
+
+// number of occurrences per fingerprint, only counted while there is a limit
+var funcCounts sync.Map // string -> *occurrences
+
+// Like the fingerprints of the sampling at most maxFingerprints errors are counted, the oldest are
+// forgotten first. Their suppressed errors are kept per function, a forgotten error is logged again.
+var (
+	countsMu            sync.Mutex
+	countsRing          []string
+	countsPos           int
+	forgottenSuppressed = make(map[string]int)
+)
+
+// occurrences counts the errors of a function with the same fingerprint
+type occurrences struct {
+	fn string
+	n  int64
+}
+
+// SetMaxPerFunction limits the events of every function to the first n occurrences of each distinct error,
+// identified by its fingerprint, further occurrences are only counted and reported by Suppressed and Flush.
+// Keeps the output bounded if a function fails in a loop. 0 removes the limit.
+func SetMaxPerFunction(n int) {
+	atomic.StoreInt64(&maxPerFunc, int64(n))
+}
+
+// Count the error of the function, false if it exceeds the limit.
+func withinLimit(f string, err error) bool {
+	max := atomic.LoadInt64(&maxPerFunc)
+	if max <= 0 {
+		return true
+	}
+
+	key := f
+	if err != nil {
+		key = fingerprint(f, err)
+	}
+	c, ok := funcCounts.Load(key)
+	if !ok {
+		c = countError(key, f, max)
+	}
+	return atomic.AddInt64(&c.(*occurrences).n, 1) <= max
+}
+
+// Start counting an error, the oldest one is forgotten if too many are counted.
+func countError(key, f string, max int64) interface{} {
+	countsMu.Lock()
+	defer countsMu.Unlock()
+	c, loaded := funcCounts.LoadOrStore(key, &occurrences{fn: f})
+	if loaded {
+		return c
+	}
+
+	if len(countsRing) < maxFingerprints {
+		countsRing = append(countsRing, key)
+		return c
+	}
+	if old, ok := funcCounts.LoadAndDelete(countsRing[countsPos]); ok {
+		o := old.(*occurrences)
+		if n := atomic.LoadInt64(&o.n); n > max {
+			forgottenSuppressed[o.fn] += int(n - max)
+		}
+	}
+	countsRing[countsPos] = key
+	countsPos = (countsPos + 1) % maxFingerprints
+	return c
+}
+
+// Suppressed returns the number of errors per function that were not reported because of SetMaxPerFunction.
+func Suppressed() map[string]int {
+	max := atomic.LoadInt64(&maxPerFunc)
+	m := make(map[string]int)
+	countsMu.Lock()
+	for f, n := range forgottenSuppressed {
+		m[f] = n
+	}
+	countsMu.Unlock()
+	funcCounts.Range(func(k, v interface{}) bool {
+		c := v.(*occurrences)
+		if n := atomic.LoadInt64(&c.n); max > 0 && n > max {
+			m[c.fn] += int(n - max)
+		}
+		return true
+	})
+	return m
+}
+
+// Write the numbers of suppressed errors to the standard logger.
+func logSuppressed() {
+	counts := Suppressed()
+	var funcs []string
+	for f := range counts {
+		funcs = append(funcs, f)
+	}
+	sort.Strings(funcs)
+
+	for _, f := range funcs {
+		log.Printf("[ERRGOTRACE] %s: %d more errors not logged\n", f, counts[f])
+	}
+}
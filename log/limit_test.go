@@ -0,0 +1,76 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func resetFuncCounts() {
+	funcCounts.Range(func(k, v interface{}) bool {
+		funcCounts.Delete(k)
+		return true
+	})
+	countsRing, countsPos = nil, 0
+	forgottenSuppressed = make(map[string]int)
+}
+
+func TestMaxPerFunctionCountsDistinctErrors(t *testing.T) {
+	resetRuntime(t)
+	resetFuncCounts()
+	SetMaxPerFunction(2)
+	var got []string
+	SetSinks(SinkFunc(func(e *Event) { got = append(got, e.Func+": "+e.Error.Error()) }))
+
+	for i := 0; i < 5; i++ {
+		// the numbers don't make an error distinct
+		InspectReturnValues("limit.F", fmt.Errorf("request %d timed out", i))
+		InspectReturnValues("limit.F", errors.New("connection refused"))
+		InspectReturnValues("limit.G", errors.New("connection refused"))
+	}
+
+	want := []string{
+		"limit.F: request 0 timed out", "limit.F: connection refused", "limit.G: connection refused",
+		"limit.F: request 1 timed out", "limit.F: connection refused", "limit.G: connection refused",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got events\n%q\nexpected\n%q", got, want)
+	}
+	if s := Suppressed(); s["limit.F"] != 6 || s["limit.G"] != 3 || len(s) != 2 {
+		t.Errorf("got suppressed %v, expected limit.F 6 and limit.G 3", s)
+	}
+}
+
+func TestMaxPerFunctionForgetsOldErrors(t *testing.T) {
+	resetRuntime(t)
+	resetFuncCounts()
+	t.Cleanup(resetFuncCounts)
+	SetMaxPerFunction(1)
+	logged := make(map[string]int)
+	SetSinks(SinkFunc(func(e *Event) { logged[e.Func]++ }))
+
+	err := errors.New("connection refused")
+	InspectReturnValues("limit.Old", err)
+	InspectReturnValues("limit.Old", err)
+	for i := 0; i < 2*maxFingerprints; i++ {
+		InspectReturnValues(fmt.Sprintf("limit.F%d", i), err)
+	}
+
+	n := 0
+	funcCounts.Range(func(k, v interface{}) bool {
+		n++
+		return true
+	})
+	if n != maxFingerprints || len(countsRing) != maxFingerprints {
+		t.Errorf("got %d counted errors, expected %d", n, maxFingerprints)
+	}
+
+	// forgotten errors are logged again, their suppressed errors are still reported
+	InspectReturnValues("limit.Old", err)
+	if logged["limit.Old"] != 2 {
+		t.Errorf("got %d events of limit.Old, expected 2", logged["limit.Old"])
+	}
+	if s := Suppressed(); s["limit.Old"] != 1 || len(s) != 1 {
+		t.Errorf("got suppressed %v, expected limit.Old 1", s)
+	}
+}
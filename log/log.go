@@ -2,21 +2,149 @@
 package log
 
 import (
-	"log"
+	"context"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-func logf(format string, vars ...interface{}) {
-	log.Printf("[ERRGOTRACE] " + format + "\n", vars...)
+// set by Disable, tracing is enabled by default
+var disabled int32
+
+// Enable turns tracing on again after Disable, it starts a new capture if SetCapture limits it.
+func Enable() {
+	atomic.StoreInt32(&disabled, 0)
+	armCapture()
+}
+
+// Disable stops tracing until Enable is called, errors returned in between are not reported.
+// Both are safe to call from any goroutine, e.g. to only trace while a feature flag is set.
+func Disable() {
+	atomic.StoreInt32(&disabled, 1)
+}
+
+// Enabled reports whether errors are traced.
+func Enabled() bool {
+	return atomic.LoadInt32(&disabled) == 0 && !captureExpired()
 }
 
 func InspectReturnValues(f string, vars ...interface{}) {
+	// without a context the call can't be part of a traced call tree
+	if !Enabled() || contextScoped() {
+		return
+	}
 	for _, v := range vars {
-		if err, ok := v.(error); ok && err != nil{
-			logf("%s: %s", f, err.Error());
+		if err, ok := v.(error); ok && err != nil && traced(f, err){
+			emit(&Event{Time: time.Now(), Func: f, Error: err})
+		}
+	}
+}
+
+// InspectNamed is deferred by the defer mode, results are pointers to the named results of the function.
+func InspectNamed(f string, results ...interface{}) {
+	InspectReturnValues(f, deref(results)...)
+}
+
+// InspectNamedCall is the deferred form of InspectCall, see InspectNamed.
+func InspectNamedCall(c *Call, results ...interface{}) {
+	InspectCall(c, deref(results)...)
+}
+
+// Get the values the pointers point to, at the time the function returns
+func deref(ptrs []interface{}) []interface{} {
+	vals := make([]interface{}, len(ptrs))
+	for i, p := range ptrs {
+		if ep, ok := p.(*error); ok {
+			vals[i] = *ep
+			continue
+		}
+		if v := reflect.ValueOf(p); v.Kind() == reflect.Ptr && !v.IsNil() {
+			vals[i] = v.Elem().Interface()
+		}
+	}
+	return vals
+}
+
+// Call describes an instrumented function call, all fields but Func are optional.
+type Call struct {
+	Func     string
+	Start    time.Time
+	ArgNames []string
+	Args     []interface{}
+	Stack    bool
+
+	// Context of the call, errors are only traced for contexts from WithTracing if SetContextScope is on
+	Ctx context.Context
+
+	// Request of an HTTP handler, its context is used if Ctx is not set
+	Request *http.Request
+
+	// Receiver of a method, only the given fields are logged if ReceiverFields is set
+	Receiver       interface{}
+	ReceiverFields []string
+}
+
+// Redacted replaces the values of arguments that must not be logged.
+const Redacted = "[REDACTED]"
+
+// Now returns the current time, so instrumented code does not need to import time.
+func Now() time.Time {
+	return time.Now()
+}
+
+// Create the event for an error of the call, with everything the options asked for
+func (c *Call) event() Event {
+	e := Event{Time: time.Now(), Func: c.Func}
+	for i, v := range c.Args {
+		name := "?"
+		if i < len(c.ArgNames) {
+			name = c.ArgNames[i]
 		}
+		e.Args = append(e.Args, Field{Key: name, Value: formatValue(v)})
 	}
+
+	if c.Receiver != nil {
+		e.Receiver = formatReceiver(c.Receiver, c.ReceiverFields)
+	}
+
+	if !c.Start.IsZero() {
+		e.Duration = e.Time.Sub(c.Start)
+	}
+
+	if c.Stack {
+		e.Stack = strings.TrimRight(string(debug.Stack()), "\n")
+	}
+
+	e.Request = describeRequest(c.Request)
+
+	return e
+}
+
+func (c *Call) context() context.Context {
+	if c.Ctx == nil && c.Request != nil {
+		return c.Request.Context()
+	}
+	return c.Ctx
 }
 
-func Setup() bool {
-	return true
+func InspectCall(c *Call, vars ...interface{}) {
+	if !Enabled() || (contextScoped() && !Tracing(c.context())) {
+		return
+	}
+	var base *Event
+	for _, v := range vars {
+		if err, ok := v.(error); ok && err != nil && traced(c.Func, err){
+			if base == nil {
+				e := c.event()
+				base = &e
+			}
+			e := *base
+			e.Error = err
+			emit(&e)
+		}
+	}
+	inspectSlow(c)
 }
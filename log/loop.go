@@ -0,0 +1,169 @@
+package log
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Loop summarizes an error recurring in a retry loop, see SetLoopDetection
+type Loop struct {
+	// Count is the number of times the error occurred in the loop, Suppressed the number of them
+	// that were not logged individually
+	Count      int
+	Suppressed int
+
+	First time.Time
+	Last  time.Time
+}
+
+// Rate returns the occurrences per second, 0 if they all happened at once
+func (l *Loop) Rate() float64 {
+	d := l.Last.Sub(l.First)
+	if d <= 0 {
+		return 0
+	}
+	return float64(l.Count) / d.Seconds()
+}
+
+func (l *Loop) String() string {
+	return strconv.Itoa(l.Count) + " times from " + l.First.Format("15:04:05.000") + " to " + l.Last.Format("15:04:05.000") +
+		", " + strconv.FormatFloat(l.Rate(), 'f', 1, 64) + "/s"
+}
+
+// Number of errors an event stands for, the suppressed repeats for loops
+func (e *Event) occurrences() int {
+	if e.Loop != nil {
+		return e.Loop.Suppressed
+	}
+	return 1
+}
+
+// an error of a call site that recurs, last is the latest suppressed event of a loop
+type repeat struct {
+	loop    Loop
+	looping bool
+	last    *Event
+}
+
+var (
+	loopMu     sync.Mutex
+	loopMax    int
+	loopWindow time.Duration
+	repeats    = make(map[string]*repeat)
+
+	// 1 if loops are detected, read without the lock
+	detectingLoops int32
+)
+
+// SetLoopDetection detects retry loops: once the same error of the same call site, identified like the
+// fingerprints of the sampling, recurs more than n times within the window, further occurrences are not
+// logged. A single LOOP event summarizes them after the error didn't recur for a window, or on Flush.
+// n 0 turns the detection off.
+func SetLoopDetection(n int, window time.Duration) {
+	if n <= 0 || window <= 0 {
+		atomic.StoreInt32(&detectingLoops, 0)
+		flushLoops()
+		return
+	}
+
+	loopMu.Lock()
+	loopMax, loopWindow = n, window
+	loopMu.Unlock()
+	atomic.StoreInt32(&detectingLoops, 1)
+}
+
+// Count the error in its loop, false if it is part of a loop and must not be logged.
+func outsideLoop(e *Event) bool {
+	if atomic.LoadInt32(&detectingLoops) == 0 || e.Alert || e.Panic || e.Trace != NoCall {
+		return true
+	}
+	key := fingerprint(e.Func, e.Error) + " " + e.Caller
+
+	loopMu.Lock()
+	defer loopMu.Unlock()
+	r := repeats[key]
+	if r != nil && !r.looping && e.Time.Sub(r.loop.First) > loopWindow {
+		r = nil
+	}
+	if r == nil {
+		if len(repeats) >= maxFingerprints && !pruneRepeats(e.Time) {
+			return true
+		}
+		r = &repeat{loop: Loop{First: e.Time}}
+		repeats[key] = r
+	}
+
+	r.loop.Count++
+	r.loop.Last = e.Time
+	if r.loop.Count <= loopMax {
+		return true
+	}
+
+	r.loop.Suppressed++
+	r.last = e
+	if !r.looping {
+		r.looping = true
+		watchLoop(key, r, loopWindow)
+	}
+	return false
+}
+
+// Forget the repeats that can't become loops anymore, false if there is still no room for another one.
+func pruneRepeats(now time.Time) bool {
+	for key, r := range repeats {
+		if !r.looping && now.Sub(r.loop.First) > loopWindow {
+			delete(repeats, key)
+		}
+	}
+	return len(repeats) < maxFingerprints
+}
+
+// Emit the summary of a loop once the error didn't recur for the window.
+func watchLoop(key string, r *repeat, after time.Duration) {
+	time.AfterFunc(after, func() {
+		loopMu.Lock()
+		if repeats[key] != r {
+			loopMu.Unlock()
+			return
+		}
+		if wait := r.loop.Last.Add(loopWindow).Sub(time.Now()); wait > 0 {
+			loopMu.Unlock()
+			watchLoop(key, r, wait)
+			return
+		}
+		delete(repeats, key)
+		loopMu.Unlock()
+
+		emitLoop(r)
+	})
+}
+
+// Emit the summaries of all loops, also of the ones that still go on.
+func flushLoops() {
+	loopMu.Lock()
+	var loops []*repeat
+	for key, r := range repeats {
+		if r.looping {
+			loops = append(loops, r)
+		}
+		delete(repeats, key)
+	}
+	loopMu.Unlock()
+
+	for _, r := range loops {
+		emitLoop(r)
+	}
+}
+
+// The summary is the last suppressed event with its own number, it was stamped in the goroutine of the error
+func emitLoop(r *repeat) {
+	e := *r.last
+	loop := r.loop
+	e.Loop = &loop
+	e.Time = time.Now()
+	e.Seq = atomic.AddUint64(&lastSeq, 1)
+	e.Mono = time.Since(processStart)
+	emitEvent(&e)
+}
@@ -0,0 +1,106 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// mutePath is where ERRGOTRACE_PROFILE=1 serves the mute handler on the default mux, next to the profile
+const mutePath = "/debug/errgotrace/mute"
+
+var (
+	muteMu sync.Mutex
+	muted  atomic.Value // []*regexp.Regexp, replaced on every change
+)
+
+// Mute drops the events of the functions matching the regular expression until Unmute is called with
+// the same expression, like the ignore file but for the lifetime of the process.
+func Mute(pattern string) error {
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	muteMu.Lock()
+	defer muteMu.Unlock()
+	list, _ := muted.Load().([]*regexp.Regexp)
+	for _, m := range list {
+		if m.String() == pattern {
+			return nil
+		}
+	}
+	muted.Store(append(append([]*regexp.Regexp(nil), list...), r))
+	return nil
+}
+
+// Unmute removes an expression given to Mute, false if it wasn't muted.
+func Unmute(pattern string) bool {
+	muteMu.Lock()
+	defer muteMu.Unlock()
+	list, _ := muted.Load().([]*regexp.Regexp)
+	var kept []*regexp.Regexp
+	for _, m := range list {
+		if m.String() != pattern {
+			kept = append(kept, m)
+		}
+	}
+	muted.Store(kept)
+	return len(kept) < len(list)
+}
+
+// Muted returns the expressions given to Mute, in the order they were added.
+func Muted() []string {
+	list, _ := muted.Load().([]*regexp.Regexp)
+	patterns := []string{}
+	for _, m := range list {
+		patterns = append(patterns, m.String())
+	}
+	return patterns
+}
+
+func mutedFunction(f string) bool {
+	list, _ := muted.Load().([]*regexp.Regexp)
+	for _, r := range list {
+		if matchName(r, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// MuteHandler mutes and unmutes functions while the program runs. GET lists the muted expressions as JSON,
+// POST mutes the expression given as func, DELETE unmutes it:
+//
+//	$ curl -X POST 'http://localhost:8080/debug/errgotrace/mute?func=^cache\.'
+//	$ curl -X DELETE 'http://localhost:8080/debug/errgotrace/mute?func=^cache\.'
+//
+// With ERRGOTRACE_PROFILE=1 the handler is registered on http.DefaultServeMux.
+func MuteHandler() http.Handler {
+	return http.HandlerFunc(serveMute)
+}
+
+func serveMute(w http.ResponseWriter, r *http.Request) {
+	pattern := r.FormValue("func")
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if err := Mute(pattern); err != nil || pattern == "" {
+			http.Error(w, "func must be a regular expression", http.StatusBadRequest)
+			return
+		}
+	case "DELETE":
+		if !Unmute(pattern) {
+			http.Error(w, "not muted: "+pattern, http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "use GET, POST or DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Muted())
+}
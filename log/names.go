@@ -0,0 +1,41 @@
+package log
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// set by SetShortNames
+var shortNames int32
+
+// SetShortNames logs functions without the directories of their import path, github.com/org/repo/storage.Open
+// is shown as storage.Open. Only the text output is shortened, sinks, limits and budgets see the full names.
+func SetShortNames(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&shortNames, v)
+}
+
+// ShortName strips the directories of the import path from a function name.
+func ShortName(f string) string {
+	if i := strings.LastIndex(f, "/"); i >= 0 {
+		return f[i+1:]
+	}
+	return f
+}
+
+// Match a function by its full or its short name, so patterns like ^storage\. keep working with import paths.
+func matchName(r *regexp.Regexp, f string) bool {
+	return r.MatchString(f) || r.MatchString(ShortName(f))
+}
+
+// Get the name of a function as it is shown in the text output
+func displayName(f string) string {
+	if atomic.LoadInt32(&shortNames) == 1 {
+		return ShortName(f)
+	}
+	return f
+}
@@ -0,0 +1,118 @@
+package log
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Propagation tells if an event is the first one for its error
+type Propagation int
+
+const (
+	// Untracked events were emitted without TrackOrigins
+	Untracked Propagation = iota
+
+	// Origin is the first traced function returning the error
+	Origin
+
+	// Propagated errors, or errors wrapping them, were already returned by another traced function
+	Propagated
+)
+
+func (p Propagation) String() string {
+	switch p {
+	case Origin:
+		return "ORIGIN"
+	case Propagated:
+		return "PROPAGATED"
+	}
+	return ""
+}
+
+// number of errors remembered for the origin tracking
+const maxSeenErrors = 4096
+
+// origin tracking mode, 0 off, 1 mark, 2 only origins
+var originMode int32
+
+var (
+	seenMu   sync.Mutex
+	seen     = make(map[interface{}]bool)
+	seenRing []interface{}
+	seenPos  int
+)
+
+// TrackOrigins marks events as ORIGIN or PROPAGATED, depending on whether the error, or an error it wraps,
+// was already returned by another traced function. With onlyOrigins propagated errors are not reported.
+// Errors are identified by their pointers, so errors that are no pointers are always origins and
+// sentinel errors like io.EOF are only an origin the first time.
+func TrackOrigins(onlyOrigins bool) {
+	mode := int32(1)
+	if onlyOrigins {
+		mode = 2
+	}
+	atomic.StoreInt32(&originMode, mode)
+}
+
+// Set the propagation of the event, false if it must not be reported.
+func trackOrigin(e *Event) bool {
+	mode := atomic.LoadInt32(&originMode)
+	if mode == 0 {
+		return true
+	}
+
+	seenMu.Lock()
+	defer seenMu.Unlock()
+
+	e.Propagation = Origin
+	if seenBefore(e.Error, 0) {
+		e.Propagation = Propagated
+	}
+	remember(e.Error)
+
+	return mode != 2 || e.Propagation == Origin
+}
+
+// Check the error and the errors it wraps, the depth protects against broken Unwrap methods.
+func seenBefore(err error, depth int) bool {
+	if err == nil || depth > maxPrettyDepth*4 {
+		return false
+	}
+
+	if identifiable(err) && seen[err] {
+		return true
+	}
+
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return seenBefore(u.Unwrap(), depth+1)
+	case interface{ Unwrap() []error }:
+		for _, w := range u.Unwrap() {
+			if seenBefore(w, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func identifiable(err error) bool {
+	return reflect.TypeOf(err).Kind() == reflect.Ptr
+}
+
+// Remember the error, the oldest one is forgotten once there are maxSeenErrors
+func remember(err error) {
+	if !identifiable(err) || seen[err] {
+		return
+	}
+
+	if len(seenRing) < maxSeenErrors {
+		seenRing = append(seenRing, err)
+	} else {
+		delete(seen, seenRing[seenPos])
+		seenRing[seenPos] = err
+		seenPos = (seenPos + 1) % maxSeenErrors
+	}
+	seen[err] = true
+}
@@ -0,0 +1,347 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The exporter sends a batch once it holds this many events, or after the interval.
+const (
+	otlpBatchSize = 512
+	otlpInterval  = time.Second
+	otlpQueueSize = 4096
+)
+
+// OTLPSink exports events as OTLP logs to a collector, using the HTTP/JSON protocol.
+// Events are sent in batches from a background goroutine, if the collector can't keep
+// up events are dropped instead of blocking the program. Call Flush before exiting.
+type OTLPSink struct {
+	endpoint string
+	headers  map[string]string
+	resource map[string]string
+	client   *http.Client
+
+	events chan *Event
+	flush  chan chan struct{}
+	failed bool
+}
+
+// NewOTLPSink creates a sink exporting to the logs endpoint of a collector, e.g. http://localhost:4318/v1/logs.
+// The headers are sent with every request, resource describes the program, e.g. service.name.
+func NewOTLPSink(endpoint string, headers, resource map[string]string, timeout time.Duration) *OTLPSink {
+	s := &OTLPSink{
+		endpoint: endpoint,
+		headers:  headers,
+		resource: resource,
+		client:   &http.Client{Timeout: timeout},
+		events:   make(chan *Event, otlpQueueSize),
+		flush:    make(chan chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Create the sink from the standard OTEL_EXPORTER_OTLP_* variables, the logs specific ones take precedence.
+func otlpSinkFromEnv() (*OTLPSink, error) {
+	if p := otlpEnv("PROTOCOL"); p != "" && p != "http/json" {
+		return nil, fmt.Errorf("otlp: protocol %s is not supported, only http/json", p)
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT")
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		endpoint = strings.TrimRight(endpoint, "/") + "/v1/logs"
+	}
+
+	timeout := 10 * time.Second
+	if t := otlpEnv("TIMEOUT"); t != "" {
+		ms, err := strconv.Atoi(t)
+		if err != nil {
+			return nil, fmt.Errorf("otlp: invalid timeout %q", t)
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	headers, err := parseOTLPList(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("otlp: headers: %s", err)
+	}
+	logHeaders, err := parseOTLPList(os.Getenv("OTEL_EXPORTER_OTLP_LOGS_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("otlp: headers: %s", err)
+	}
+	for k, v := range logHeaders {
+		headers[k] = v
+	}
+
+	resource, err := parseOTLPList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("otlp: resource attributes: %s", err)
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	} else if _, ok := resource["service.name"]; !ok {
+		resource["service.name"] = "unknown_service:" + filepath.Base(os.Args[0])
+	}
+
+	return NewOTLPSink(endpoint, headers, resource, timeout), nil
+}
+
+// OTEL_EXPORTER_OTLP_LOGS_<name> or OTEL_EXPORTER_OTLP_<name>
+func otlpEnv(name string) string {
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_" + name); v != "" {
+		return v
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + name)
+}
+
+// Parse a list of key=value pairs separated by commas, with URL encoded values.
+func parseOTLPList(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		v, err := url.QueryUnescape(strings.TrimSpace(pair[i+1:]))
+		if err != nil {
+			return nil, err
+		}
+		m[strings.TrimSpace(pair[:i])] = v
+	}
+	return m, nil
+}
+
+func (s *OTLPSink) Emit(e *Event) {
+	select {
+	case s.events <- e:
+	default:
+	}
+}
+
+// Flush sends all events queued so far and waits until they are delivered.
+func (s *OTLPSink) Flush() {
+	done := make(chan struct{})
+	s.flush <- done
+	<-done
+}
+
+func (s *OTLPSink) run() {
+	tick := time.NewTicker(otlpInterval)
+	var batch []*Event
+	for {
+		select {
+		case e := <-s.events:
+			batch = append(batch, e)
+			if len(batch) < otlpBatchSize {
+				continue
+			}
+		case <-tick.C:
+		case done := <-s.flush:
+			for n := len(s.events); n > 0; n-- {
+				batch = append(batch, <-s.events)
+			}
+			s.send(batch)
+			batch = nil
+			close(done)
+			continue
+		}
+		s.send(batch)
+		batch = nil
+	}
+}
+
+// Send a batch, only the first of consecutive failures is reported.
+func (s *OTLPSink) send(batch []*Event) {
+	if len(batch) < 1 {
+		return
+	}
+
+	err := s.post(batch)
+	if err != nil && !s.failed {
+		log.Printf("[ERRGOTRACE] otlp: %s", err)
+	}
+	s.failed = err != nil
+}
+
+func (s *OTLPSink) post(batch []*Event) error {
+	body, err := json.Marshal(s.request(batch))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", s.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// The JSON encoding of an OTLP ExportLogsServiceRequest
+type (
+	otlpRequest struct {
+		ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+	}
+	otlpResourceLogs struct {
+		Resource  otlpResource    `json:"resource"`
+		ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeLogs struct {
+		Scope      otlpScope       `json:"scope"`
+		LogRecords []otlpLogRecord `json:"logRecords"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpLogRecord struct {
+		TimeUnixNano         string          `json:"timeUnixNano"`
+		ObservedTimeUnixNano string          `json:"observedTimeUnixNano"`
+		SeverityNumber       int             `json:"severityNumber"`
+		SeverityText         string          `json:"severityText"`
+		Body                 otlpValue       `json:"body"`
+		Attributes           []otlpAttribute `json:"attributes"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+	}
+)
+
+// severity numbers of ERROR and INFO, for calls
+const (
+	otlpSeverityError = 17
+	otlpSeverityInfo  = 9
+)
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpAttribute {
+	s := strconv.FormatInt(value, 10)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+func (s *OTLPSink) request(batch []*Event) *otlpRequest {
+	var resource []otlpAttribute
+	for k, v := range s.resource {
+		resource = append(resource, otlpString(k, v))
+	}
+	sort.Slice(resource, func(i, j int) bool { return resource[i].Key < resource[j].Key })
+
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+	var records []otlpLogRecord
+	for _, e := range batch {
+		msg := e.Message()
+		body := e.Func + ": " + msg
+		severity, severityText := otlpSeverityError, "ERROR"
+		attrs := []otlpAttribute{otlpString("code.function", e.Func)}
+		if e.Trace != NoCall {
+			body = e.Trace.String() + " " + e.Func
+			severity, severityText = otlpSeverityInfo, "INFO"
+			attrs = append(attrs, otlpString("errgotrace.call", e.Trace.String()))
+		} else {
+			attrs = append(attrs,
+				otlpString("exception.type", errorTypeName(e.Error)),
+				otlpString("exception.message", msg))
+		}
+		for _, a := range e.Args {
+			attrs = append(attrs, otlpString("errgotrace.arg."+a.Key, a.Value))
+		}
+		for _, f := range e.Fields {
+			attrs = append(attrs, otlpString(f.Key, f.Value))
+		}
+		if len(e.Tags) > 0 {
+			attrs = append(attrs, otlpString("errgotrace.tags", strings.Join(e.Tags, ",")))
+		}
+		for _, f := range e.Build {
+			attrs = append(attrs, otlpString("errgotrace.build."+f.Key, f.Value))
+		}
+		for _, f := range e.ErrorFields {
+			attrs = append(attrs, otlpString("errgotrace.error."+f.Key, f.Value))
+		}
+		if e.Receiver != "" {
+			attrs = append(attrs, otlpString("errgotrace.receiver", e.Receiver))
+		}
+		if e.Request != "" {
+			attrs = append(attrs, otlpString("errgotrace.request", e.Request))
+		}
+		if e.Caller != "" {
+			attrs = append(attrs, otlpString("errgotrace.caller", e.Caller), otlpInt("errgotrace.depth", int64(e.Depth)))
+		}
+		if len(e.Goroutines) > 0 {
+			attrs = append(attrs, otlpString("errgotrace.goroutines", strings.Join(e.Goroutines, " > ")))
+		}
+		if e.Duration > 0 {
+			attrs = append(attrs, otlpInt("errgotrace.duration_ns", int64(e.Duration)))
+		}
+		attrs = append(attrs, otlpInt("errgotrace.seq", int64(e.Seq)))
+		if e.Stack != "" {
+			attrs = append(attrs, otlpString("exception.stacktrace", e.Stack))
+		}
+		if len(e.Before) > 0 {
+			attrs = append(attrs, otlpString("errgotrace.errors_before", strings.Join(e.Before, "\n")))
+		}
+		if e.Loop != nil {
+			attrs = append(attrs, otlpInt("errgotrace.loop.count", int64(e.Loop.Count)), otlpInt("errgotrace.loop.suppressed", int64(e.Loop.Suppressed)),
+				otlpString("errgotrace.loop.first", e.Loop.First.Format(time.RFC3339Nano)), otlpString("errgotrace.loop.last", e.Loop.Last.Format(time.RFC3339Nano)))
+		}
+
+		records = append(records, otlpLogRecord{
+			TimeUnixNano:         strconv.FormatInt(e.Time.UnixNano(), 10),
+			ObservedTimeUnixNano: observed,
+			SeverityNumber:       severity,
+			SeverityText:         severityText,
+			Body:                 otlpValue{StringValue: &body},
+			Attributes:           attrs,
+		})
+	}
+
+	return &otlpRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource: otlpResource{Attributes: resource},
+		ScopeLogs: []otlpScopeLogs{{
+			Scope:      otlpScope{Name: "errgotrace"},
+			LogRecords: records,
+		}},
+	}}}
+}
@@ -0,0 +1,177 @@
+package log
+
+import (
+	"errors"
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The benchmarks behind the overhead budget of the README, run them with
+//
+//   go test -run '^$' -bench . -benchmem ./log/
+//
+// go test -bench turns on the benchmark mode of the runtime, which keeps the events from the sinks, so the
+// benchmarks measuring sinks switch it off again.
+
+var errBench = errors.New("benchmark error")
+
+//go:noinline
+func succeed() error { return nil }
+
+//go:noinline
+func fail() error { return errBench }
+
+// benchResult is a named result type that may implement error, the runtime is always called for it
+type benchResult interface{}
+
+//go:noinline
+func succeedNamed() benchResult { return nil }
+
+// Prepare a benchmark of the error path with the given sinks.
+func benchSinks(b *testing.B, s ...Sink) {
+	SetBenchmarkMode(false)
+	Enable()
+	SetSinks(s...)
+	b.Cleanup(func() {
+		// sinks writing in the background are idle once flushed
+		flushSinks()
+		SetSinks(DefaultSink())
+		SetBenchmarkMode(true)
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+}
+
+// The code generated for a function whose results are all of type error, without an error.
+func BenchmarkNilError(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := succeed(); err != nil {
+			InspectReturnValues("bench.F", err)
+		}
+	}
+}
+
+// Results of other types are always passed to the runtime.
+func BenchmarkNilNamedResult(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		InspectReturnValues("bench.F", succeedNamed())
+	}
+}
+
+func BenchmarkErrorCustomSink(b *testing.B) {
+	benchSinks(b, SinkFunc(func(e *Event) {}))
+	for i := 0; i < b.N; i++ {
+		if err := fail(); err != nil {
+			InspectReturnValues("bench.F", err)
+		}
+	}
+}
+
+// The default sink formats the event for the standard logger, the write itself goes nowhere.
+func BenchmarkErrorDefaultLogger(b *testing.B) {
+	stdlog.SetOutput(ioutil.Discard)
+	defer stdlog.SetOutput(os.Stderr)
+	benchSinks(b, DefaultSink())
+	for i := 0; i < b.N; i++ {
+		if err := fail(); err != nil {
+			InspectReturnValues("bench.F", err)
+		}
+	}
+}
+
+// The code generated with args formats the arguments of failed calls.
+func BenchmarkErrorArgs(b *testing.B) {
+	type request struct {
+		ID    string
+		Items []int
+	}
+	args := []interface{}{"7f3a", &request{ID: "7f3a", Items: []int{1, 2, 3}}, 42}
+	benchSinks(b, SinkFunc(func(e *Event) {}))
+	for i := 0; i < b.N; i++ {
+		if err := fail(); err != nil {
+			InspectCall(&Call{Func: "bench.F", ArgNames: []string{"id", "req", "n"}, Args: args}, err)
+		}
+	}
+}
+
+// Without sinks, what benchmarks of instrumented code measure.
+func BenchmarkErrorBenchmarkMode(b *testing.B) {
+	SetBenchmarkMode(true)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := fail(); err != nil {
+			InspectReturnValues("bench.F", err)
+		}
+	}
+}
+
+func benchSink(b *testing.B, s Sink) {
+	benchSinks(b, s)
+	for i := 0; i < b.N; i++ {
+		InspectReturnValues("bench.F", errBench)
+	}
+}
+
+func BenchmarkSinkJSON(b *testing.B) {
+	benchSink(b, NewJSONSink(ioutil.Discard))
+}
+
+// expvar can only publish once, the named sink is created once
+func BenchmarkSinkExpvar(b *testing.B) {
+	s, err := namedSink("expvar")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchSink(b, s)
+}
+
+func BenchmarkSinkFolded(b *testing.B) {
+	benchSink(b, NewFoldedSink(filepath.Join(b.TempDir(), "errors.folded")))
+}
+
+func BenchmarkSinkFile(b *testing.B) {
+	s, err := NewFileSink(filepath.Join(b.TempDir(), "errgotrace.log"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchSink(b, s)
+}
+
+func BenchmarkSinkStatsd(b *testing.B) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		b.Skip(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			if _, _, err := conn.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	s, err := NewStatsdSink(conn.LocalAddr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchSink(b, s)
+}
+
+func BenchmarkSinkOTLP(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	}))
+	b.Cleanup(server.Close)
+	benchSink(b, NewOTLPSink(server.URL+"/v1/logs", nil, nil, time.Second))
+}
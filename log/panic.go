@@ -0,0 +1,58 @@
+package log
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Report a recovered panic, r is the request of an HTTP handler or nil.
+func reportPanic(f string, v interface{}, r *http.Request) {
+	if !Enabled() {
+		return
+	}
+	if contextScoped() && (r == nil || !Tracing(r.Context())) {
+		return
+	}
+
+	err := fmt.Errorf("panic: %v", v)
+	if !traced(f, err) {
+		return
+	}
+
+	emit(&Event{
+		Time:    time.Now(),
+		Func:    f,
+		Error:   err,
+		Request: describeRequest(r),
+		Panic:   true,
+		Stack:   strings.TrimRight(string(debug.Stack()), "\n"),
+		Before:  goroutineBreadcrumbs(),
+	})
+}
+
+// RecoverGoroutine is deferred by instrumented goroutines, it reports a panic and then panics again.
+func RecoverGoroutine(f string) {
+	if v := recover(); v != nil {
+		reportPanic(f, v, nil)
+		panic(v)
+	}
+}
+
+// Goroutine is the name of a goroutine in the trace output
+type Goroutine string
+
+// Wrap the function passed to errgroup.Group.Go and similar calls, to report its error or panic.
+// Like Spawn it is called by the goroutine starting the new one.
+func (g Goroutine) Wrap(fn func() error) func() error {
+	chain := g.chain()
+	return func() error {
+		defer enterGoroutine(chain)()
+		defer RecoverGoroutine(string(g))
+		err := fn()
+		InspectReturnValues(string(g), err)
+		return err
+	}
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// the instrumented goroutines every running goroutine was started from, itself included, outermost first
+var (
+	parentMu sync.Mutex
+	parents  = make(map[uint64][]string)
+	spawned  int32
+)
+
+// Spawn is called by the go statements of instrumented goroutines, in the goroutine starting the new one.
+// The returned function runs fn in the new goroutine, reporting its panic, and attributes its events to the
+// goroutines it was started from:
+//
+//	go __errgotrace.Goroutine("pkg.Func.go@12").Spawn(func() {...})()
+func (g Goroutine) Spawn(fn func()) func() {
+	chain := g.chain()
+	return func() {
+		defer enterGoroutine(chain)()
+		defer RecoverGoroutine(string(g))
+		fn()
+	}
+}
+
+// The goroutines a goroutine named g started by the current goroutine is in
+func (g Goroutine) chain() []string {
+	return append(goroutineChain(), string(g))
+}
+
+// Record the goroutines of the current goroutine, the returned function forgets them when it ends.
+func enterGoroutine(chain []string) func() {
+	gid := goroutineID()
+	parentMu.Lock()
+	parents[gid] = chain
+	parentMu.Unlock()
+	atomic.AddInt32(&spawned, 1)
+
+	return func() {
+		parentMu.Lock()
+		delete(parents, gid)
+		parentMu.Unlock()
+		atomic.AddInt32(&spawned, -1)
+	}
+}
+
+// Get the instrumented goroutines the current goroutine was started from, nil if there are none running.
+func goroutineChain() []string {
+	if atomic.LoadInt32(&spawned) == 0 {
+		return nil
+	}
+
+	gid := goroutineID()
+	parentMu.Lock()
+	defer parentMu.Unlock()
+	return append([]string(nil), parents[gid]...)
+}
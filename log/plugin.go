@@ -0,0 +1,47 @@
+//go:build errgotrace_plugin
+// +build errgotrace_plugin
+
+package log
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// Load a go plugin built with go build -buildmode=plugin against the same version of the runtime. It exports
+// a Sink of type Sink or func(*Event), a Filter of type Filter or func(*Event) bool, or both.
+func loadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	if sym, err := p.Lookup("Sink"); err == nil {
+		switch s := sym.(type) {
+		case *Sink:
+			AddSink(*s)
+		case func(*Event):
+			AddSink(SinkFunc(s))
+		default:
+			return fmt.Errorf("Sink is a %T, not a Sink or func(*log.Event)", sym)
+		}
+		found = true
+	}
+	if sym, err := p.Lookup("Filter"); err == nil {
+		switch f := sym.(type) {
+		case *Filter:
+			AddFilter(*f)
+		case func(*Event) bool:
+			AddFilter(f)
+		default:
+			return fmt.Errorf("Filter is a %T, not a Filter or func(*log.Event) bool", sym)
+		}
+		found = true
+	}
+
+	if !found {
+		return fmt.Errorf("exports neither Sink nor Filter")
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !errgotrace_plugin
+// +build !errgotrace_plugin
+
+package log
+
+import "fmt"
+
+// go plugins need cgo and dynamic linking, programs only load them when built with -tags errgotrace_plugin
+func loadPlugin(path string) error {
+	return fmt.Errorf("the program was built without -tags errgotrace_plugin")
+}
@@ -0,0 +1,46 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// fraction of the repeated errors traced by PresetKubernetes
+	kubernetesSample = 0.1
+
+	// namespace of the pod, mounted by default unless the service account token is disabled
+	kubernetesNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// PresetKubernetes configures the runtime for containers, it's selected with ERRGOTRACE_PRESET=k8s:
+//
+//   - the events are written as JSON lines to stdout, for the log collector of the cluster, instead of
+//     the standard logger
+//   - the first error of every function, type and message is traced, its repeats are sampled at 10%
+//   - the events get the fields pod, namespace and node from the variables POD_NAME, POD_NAMESPACE and
+//     NODE_NAME set with the downward API, or the host name and the namespace of the service account
+//
+// Sinks and settings applied afterwards, by the environment or the configuration file, work as usual.
+func PresetKubernetes() {
+	SetSinks(NewJSONSink(os.Stdout))
+	SetSampling(kubernetesSample, true)
+
+	pod := os.Getenv("POD_NAME")
+	if pod == "" {
+		pod = os.Getenv("HOSTNAME")
+	}
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		if data, err := ioutil.ReadFile(kubernetesNamespaceFile); err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+	}
+
+	for _, f := range []Field{{"pod", pod}, {"namespace", namespace}, {"node", os.Getenv("NODE_NAME")}} {
+		if f.Value != "" {
+			With(f.Key, f.Value)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of the pretty printer, everything beyond is cut off with ...
+const (
+	maxPrettyDepth  = 5
+	maxPrettyItems  = 32
+	maxPrettyBytes  = 64
+	maxPrettyString = 256
+
+	// overall budget of a formatted value, printing stops once it is used up
+	maxPrettyLength = 1024
+)
+
+var (
+	stringerType   = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	goStringerType = reflect.TypeOf((*fmt.GoStringer)(nil)).Elem()
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// prettyPrinter formats arbitrary values depth limited and safe against cycles.
+type prettyPrinter struct {
+	buf     strings.Builder
+	visited map[uintptr]bool
+
+	// bytes left until the output is cut off, full is set once it is used up
+	remaining int
+	full      bool
+
+	// show Redacted for struct fields with a sensitive name, see SetRedactFields
+	redact bool
+}
+
+func newPrettyPrinter(limit int) *prettyPrinter {
+	return &prettyPrinter{visited: make(map[uintptr]bool), remaining: limit}
+}
+
+// Format a value for the output, never panics.
+func prettyPrint(v interface{}) string {
+	return newPrettyPrinter(maxPrettyLength).format(v)
+}
+
+func (p *prettyPrinter) format(v interface{}) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.write(fmt.Sprintf("<panic: %v>", r))
+			s = p.buf.String()
+		}
+	}()
+
+	p.print(reflect.ValueOf(v), 0)
+	return p.buf.String()
+}
+
+// Append to the output until the budget is used up, the rest is replaced by ...
+func (p *prettyPrinter) write(s string) {
+	if p.full {
+		return
+	}
+	if len(s) <= p.remaining {
+		p.buf.WriteString(s)
+		p.remaining -= len(s)
+		return
+	}
+
+	// don't cut a character in half
+	n := p.remaining
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	p.buf.WriteString(s[:n] + "...")
+	p.remaining = 0
+	p.full = true
+}
+
+// Call String, Error or GoString if the value implements any of them.
+func (p *prettyPrinter) printMethod(v reflect.Value) (ok bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return false
+	}
+
+	t := v.Type()
+	if !t.Implements(errorType) && !t.Implements(stringerType) && !t.Implements(goStringerType) {
+		return false
+	}
+
+	// methods of nil pointers and broken implementations may panic
+	defer func() {
+		if r := recover(); r != nil {
+			p.write(fmt.Sprintf("<panic in %s: %v>", t, r))
+			ok = true
+		}
+	}()
+
+	var s string
+	switch i := v.Interface().(type) {
+	case error:
+		s = i.Error()
+	case fmt.Stringer:
+		s = i.String()
+	case fmt.GoStringer:
+		s = i.GoString()
+	}
+	p.write(truncate(s, maxPrettyString))
+	return true
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
+
+// Check for a cycle before descending into a reference, leave must be called afterwards.
+func (p *prettyPrinter) enter(ptr uintptr) bool {
+	if ptr == 0 {
+		return true
+	}
+	if p.visited[ptr] {
+		p.write("<cycle>")
+		return false
+	}
+	p.visited[ptr] = true
+	return true
+}
+
+func (p *prettyPrinter) leave(ptr uintptr) {
+	delete(p.visited, ptr)
+}
+
+func (p *prettyPrinter) print(v reflect.Value, depth int) {
+	if p.full {
+		return
+	}
+	if !v.IsValid() {
+		p.write("<nil>")
+		return
+	}
+
+	if depth > maxPrettyDepth {
+		p.write("...")
+		return
+	}
+
+	if p.printMethod(v) {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		p.write(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p.write(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		p.write(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		p.write(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	case reflect.Complex64, reflect.Complex128:
+		p.write(fmt.Sprint(v.Complex()))
+	case reflect.String:
+		p.write(strconv.Quote(truncate(v.String(), maxPrettyString)))
+	case reflect.Ptr:
+		if v.IsNil() {
+			p.write("nil")
+			return
+		}
+		if !p.enter(v.Pointer()) {
+			return
+		}
+		p.write("&")
+		p.print(v.Elem(), depth+1)
+		p.leave(v.Pointer())
+	case reflect.Interface:
+		if v.IsNil() {
+			p.write("nil")
+			return
+		}
+		p.print(v.Elem(), depth)
+	case reflect.Struct:
+		p.write(v.Type().String() + "{")
+		for i := 0; i < v.NumField() && !p.full; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			name := v.Type().Field(i).Name
+			p.write(name + ": ")
+			if p.redact && redactedName(name) {
+				p.write(Redacted)
+			} else {
+				p.print(v.Field(i), depth+1)
+			}
+		}
+		p.write("}")
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				p.write("nil")
+				return
+			}
+			if v.Type().Elem().Kind() == reflect.Uint8 {
+				p.printBytes(v)
+				return
+			}
+			if !p.enter(v.Pointer()) {
+				return
+			}
+			defer p.leave(v.Pointer())
+		}
+
+		p.write("[")
+		for i := 0; i < v.Len() && !p.full; i++ {
+			if i > 0 {
+				p.write(" ")
+			}
+			if i >= maxPrettyItems {
+				p.write(fmt.Sprintf("... (%d items)", v.Len()))
+				break
+			}
+			p.print(v.Index(i), depth+1)
+		}
+		p.write("]")
+	case reflect.Map:
+		if v.IsNil() {
+			p.write("nil")
+			return
+		}
+		if !p.enter(v.Pointer()) {
+			return
+		}
+		defer p.leave(v.Pointer())
+
+		keys := p.mapKeys(v, depth)
+		p.write("map[")
+		for i, k := range keys {
+			if p.full {
+				break
+			}
+			if i > 0 {
+				p.write(" ")
+			}
+			p.print(k, depth+1)
+			p.write(":")
+			p.print(v.MapIndex(k), depth+1)
+		}
+		if v.Len() > len(keys) {
+			p.write(fmt.Sprintf(" ... (%d items)", v.Len()))
+		}
+		p.write("]")
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		if v.IsNil() {
+			p.write("nil")
+			return
+		}
+		p.write(fmt.Sprintf("(%s)(%#x)", v.Type(), v.Pointer()))
+	default:
+		p.write("<" + v.Type().String() + ">")
+	}
+}
+
+// Byte slices are shown as quoted strings, long slices are cut off.
+func (p *prettyPrinter) printBytes(v reflect.Value) {
+	b := v.Bytes()
+	n := len(b)
+	if n > maxPrettyBytes {
+		b = b[:maxPrettyBytes]
+	}
+
+	p.write(strconv.Quote(string(b)))
+	if n > maxPrettyBytes {
+		p.write(fmt.Sprintf("... (%d bytes)", n))
+	}
+}
+
+// Pick the keys of a map to print, sorted for a stable output. Only maxPrettyItems
+// keys are kept while iterating, so huge maps aren't formatted completely. Keys
+// of a basic type are compared by value, the smallest ones are shown. Other keys
+// are sorted by their formatted value, for maps that are too large for that an
+// arbitrary selection is shown.
+func (p *prettyPrinter) mapKeys(v reflect.Value, depth int) []reflect.Value {
+	less := keyLess(v.Type().Key().Kind())
+	if less == nil && v.Len() <= maxPrettyItems {
+		type entry struct {
+			key string
+			val reflect.Value
+		}
+		var entries []entry
+		for _, k := range v.MapKeys() {
+			kp := newPrettyPrinter(maxPrettyString)
+			kp.visited, kp.redact = p.visited, p.redact
+			kp.print(k, depth+1)
+			entries = append(entries, entry{kp.buf.String(), k})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+		keys := make([]reflect.Value, len(entries))
+		for i, e := range entries {
+			keys[i] = e.val
+		}
+		return keys
+	}
+
+	var keys []reflect.Value
+	iter := v.MapRange()
+	for iter.Next() {
+		k := iter.Key()
+		if less == nil {
+			keys = append(keys, k)
+			if len(keys) == maxPrettyItems {
+				break
+			}
+			continue
+		}
+
+		// insert into the sorted keys, the largest one falls out
+		i := sort.Search(len(keys), func(i int) bool { return less(k, keys[i]) })
+		if i == maxPrettyItems {
+			continue
+		}
+		if len(keys) < maxPrettyItems {
+			keys = append(keys, reflect.Value{})
+		}
+		copy(keys[i+1:], keys[i:])
+		keys[i] = k
+	}
+	return keys
+}
+
+// Compare map keys of a basic kind by value, nil for the other kinds.
+func keyLess(kind reflect.Kind) func(a, b reflect.Value) bool {
+	switch kind {
+	case reflect.String:
+		return func(a, b reflect.Value) bool { return a.String() < b.String() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		return func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	case reflect.Bool:
+		return func(a, b reflect.Value) bool { return !a.Bool() && b.Bool() }
+	}
+	return nil
+}
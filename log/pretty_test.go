@@ -0,0 +1,88 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type prettyNode struct {
+	Name     string
+	Children []*prettyNode
+}
+
+func TestPrettyPrintBudget(t *testing.T) {
+	// 32^5 nodes, the item and depth limits alone still allow megabytes
+	var build func(depth int) *prettyNode
+	build = func(depth int) *prettyNode {
+		n := &prettyNode{Name: strings.Repeat("x", 200)}
+		if depth < 3 {
+			for i := 0; i < maxPrettyItems; i++ {
+				n.Children = append(n.Children, build(depth+1))
+			}
+		}
+		return n
+	}
+
+	var accents []string
+	for i := 0; i < maxPrettyItems; i++ {
+		accents = append(accents, strings.Repeat("é", 100))
+	}
+
+	for _, v := range []interface{}{build(0), accents, map[string][]string{"a": accents, "b": accents}} {
+		s := prettyPrint(v)
+		if len(s) > maxPrettyLength+len("...") {
+			t.Errorf("got %d bytes, expected at most %d", len(s), maxPrettyLength+len("..."))
+		}
+		if !strings.HasSuffix(s, "...") {
+			t.Errorf("expected %q to be cut off with ...", s[len(s)-20:])
+		}
+		if !strings.Contains(s, "\"") {
+			t.Errorf("expected %q to contain a string", s)
+		}
+	}
+
+	p := newPrettyPrinter(10)
+	if s := p.format("ééééé"); s != "\"éééé..." {
+		t.Errorf("got %q, expected the cut after a whole character", s)
+	}
+}
+
+func TestPrettyPrintMap(t *testing.T) {
+	ints := make(map[int]string)
+	for i := 10000; i > 0; i-- {
+		ints[i] = "v"
+	}
+	want := "map["
+	for i := 1; i <= maxPrettyItems; i++ {
+		if i > 1 {
+			want += " "
+		}
+		want += fmt.Sprintf("%d:\"v\"", i)
+	}
+	want += " ... (10000 items)]"
+
+	for i := 0; i < 5; i++ {
+		if s := prettyPrint(ints); s != want {
+			t.Fatalf("got\n%s\nexpected\n%s", s, want)
+		}
+	}
+
+	type key struct{ A, B int }
+	small := map[key]bool{{2, 1}: true, {1, 2}: false, {1, 1}: true}
+	if s := prettyPrint(small); s != "map[log.key{A: 1, B: 1}:true log.key{A: 1, B: 2}:false log.key{A: 2, B: 1}:true]" {
+		t.Errorf("got %s, expected the keys sorted by their formatted value", s)
+	}
+
+	large := make(map[key]int)
+	for i := 0; i < 1000; i++ {
+		large[key{i, i}] = i
+	}
+	if s := prettyPrint(large); strings.Count(s, "log.key{") != maxPrettyItems || !strings.HasSuffix(s, " ... (1000 items)]") {
+		t.Errorf("got %s, expected %d keys and the number of items", s, maxPrettyItems)
+	}
+
+	if s := prettyPrint(map[string]int{"b": 2, "a": 1}); s != "map[\"a\":1 \"b\":2]" {
+		t.Errorf("got %s", s)
+	}
+}
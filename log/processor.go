@@ -0,0 +1,225 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gellweiler/errgotrace/log/schema"
+)
+
+// Filter sees every event before the sinks, it may change the event and returns false to drop it. Filters are
+// called concurrently by the goroutines emitting events.
+type Filter func(e *Event) bool
+
+var (
+	filterMu sync.Mutex
+	filters  atomic.Value // []Filter, replaced on every change
+
+	// plugins import this package, so they are loaded with the first event instead of while it is initialized
+	pluginOnce sync.Once
+)
+
+// AddFilter registers a filter, the filters run in the order they were registered until one drops the event.
+func AddFilter(f Filter) {
+	filterMu.Lock()
+	defer filterMu.Unlock()
+
+	old, _ := filters.Load().([]Filter)
+	filters.Store(append(append([]Filter(nil), old...), f))
+}
+
+// Check if the event passes all filters.
+func filtered(e *Event) bool {
+	pluginOnce.Do(loadPlugins)
+	list, _ := filters.Load().([]Filter)
+	for _, f := range list {
+		if !safeFilter(f, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// a panicking filter keeps the event
+func safeFilter(f Filter, e *Event) (keep bool) {
+	defer func() {
+		if recover() != nil {
+			keep = true
+		}
+	}()
+	return f(e)
+}
+
+// time an exec filter has to answer, before it is stopped and the events pass unfiltered
+const processorTimeout = time.Second
+
+// ExecProcessor runs a command that processes the events, e.g. proprietary processing shipped as its own
+// program. Every event is written to its stdin as a JSON line of the schema package. As a filter it answers
+// every line with a JSON line of its own, see ProcessorReply. A processor that fails or takes longer than a
+// second for a reply is stopped, the events pass unfiltered from then on.
+type ExecProcessor struct {
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	replies chan []byte
+	failed  bool
+}
+
+// ProcessorReply is the answer of an exec filter to an event, the fields and tags are added to the event.
+// An empty line or null keeps the event as it is.
+type ProcessorReply struct {
+	Drop   bool           `json:"drop,omitempty"`
+	Fields []schema.Field `json:"fields,omitempty"`
+	Tags   []string       `json:"tags,omitempty"`
+}
+
+// NewExecProcessor starts the command, the arguments are separated by spaces. Its stderr is the one of the
+// program. Replies are only read from processors used as a filter.
+func NewExecProcessor(command string, filter bool) (*ExecProcessor, error) {
+	args := strings.Fields(command)
+	if len(args) < 1 {
+		return nil, fmt.Errorf("exec: no command")
+	}
+
+	p := &ExecProcessor{cmd: exec.Command(args[0], args[1:]...)}
+	p.cmd.Stderr = os.Stderr
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("exec: %s", err)
+	}
+	p.stdin = stdin
+
+	var stdout io.Reader
+	if filter {
+		if stdout, err = p.cmd.StdoutPipe(); err != nil {
+			return nil, fmt.Errorf("exec: %s", err)
+		}
+	}
+	if err := p.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("exec: %s", err)
+	}
+
+	if filter {
+		p.replies = make(chan []byte)
+		go func() {
+			scanner := bufio.NewScanner(stdout)
+			scanner.Buffer(nil, 1024*1024)
+			for scanner.Scan() {
+				p.replies <- append([]byte(nil), scanner.Bytes()...)
+			}
+			close(p.replies)
+		}()
+	}
+	return p, nil
+}
+
+// Write an event to the processor, must be called with the lock held.
+func (p *ExecProcessor) write(e *Event) error {
+	data, err := json.Marshal(e.Schema())
+	if err != nil {
+		return err
+	}
+	_, err = p.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// Stop a failed processor, only the first failure is reported. Must be called with the lock held.
+func (p *ExecProcessor) fail(err error) {
+	if !p.failed {
+		log.Printf("[ERRGOTRACE] exec %s: %s", p.cmd.Path, err)
+	}
+	p.failed = true
+	p.stdin.Close()
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+}
+
+// Emit passes the event to a processor used as a sink.
+func (p *ExecProcessor) Emit(e *Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed {
+		return
+	}
+	if err := p.write(e); err != nil {
+		p.fail(err)
+	}
+}
+
+// Filter passes the event to a processor used as a filter and applies its reply, see AddFilter.
+func (p *ExecProcessor) Filter(e *Event) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed || p.replies == nil {
+		return true
+	}
+	if err := p.write(e); err != nil {
+		p.fail(err)
+		return true
+	}
+
+	var line []byte
+	select {
+	case l, ok := <-p.replies:
+		if !ok {
+			p.fail(fmt.Errorf("exited"))
+			return true
+		}
+		line = l
+	case <-time.After(processorTimeout):
+		p.fail(fmt.Errorf("no reply within %s", processorTimeout))
+		return true
+	}
+
+	var reply *ProcessorReply
+	if len(strings.TrimSpace(string(line))) > 0 {
+		if err := json.Unmarshal(line, &reply); err != nil {
+			p.fail(fmt.Errorf("invalid reply (%s)", err))
+			return true
+		}
+	}
+	if reply == nil {
+		return true
+	}
+	if len(reply.Fields) > 0 {
+		// the fields are shared between events
+		e.Fields = append([]Field(nil), e.Fields...)
+		for _, f := range reply.Fields {
+			e.Fields = append(e.Fields, Field{Key: f.Key, Value: f.Value})
+		}
+	}
+	e.Tags = append(e.Tags, reply.Tags...)
+	return !reply.Drop
+}
+
+// Start the exec filter of the environment.
+func loadProcessors() {
+	if command := os.Getenv("ERRGOTRACE_EXEC_FILTER"); command != "" {
+		if p, err := NewExecProcessor(command, true); err != nil {
+			log.Printf("[ERRGOTRACE] %s", err)
+		} else {
+			AddFilter(p.Filter)
+		}
+	}
+}
+
+// Load the plugins of the environment.
+func loadPlugins() {
+	if plugins := os.Getenv("ERRGOTRACE_PLUGINS"); plugins != "" {
+		for _, path := range strings.Split(plugins, ",") {
+			if err := loadPlugin(strings.TrimSpace(path)); err != nil {
+				log.Printf("[ERRGOTRACE] plugin %s: %s", path, err)
+			}
+		}
+	}
+}
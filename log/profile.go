@@ -0,0 +1,173 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// profilePath is where ERRGOTRACE_PROFILE=1 serves the profile on the default mux
+const profilePath = "/debug/errgotrace/profile"
+
+// profileSink counts errors per call path for the profile handler
+type profileSink struct {
+	start time.Time
+
+	mu     sync.Mutex
+	counts map[string]int
+	attach sync.Once
+}
+
+func newProfileSink() *profileSink {
+	return &profileSink{start: time.Now(), counts: make(map[string]int)}
+}
+
+// Only errors are counted, alerts and calls are not
+func (s *profileSink) Emit(e *Event) {
+	if e.Alert || e.Trace != NoCall {
+		return
+	}
+
+	// innermost first, as pprof expects it; names can't contain newlines
+	stack := []string{e.Func}
+	for i := len(e.Path) - 1; i >= 0; i-- {
+		stack = append(stack, e.Path[i])
+	}
+	s.mu.Lock()
+	s.counts[strings.Join(stack, "\n")] += e.occurrences()
+	s.mu.Unlock()
+}
+
+// ProfileHandler serves the errors counted so far as a pprof profile, the samples are errors keyed by the
+// instrumented call path. Call paths are only known for functions instrumented with -depth or -calls.
+//
+//   $ go tool pprof -top http://localhost:8080/debug/errgotrace/profile
+//
+// With ERRGOTRACE_PROFILE=1 the handler is registered on http.DefaultServeMux, otherwise errors are
+// counted from the first call of ProfileHandler on.
+func ProfileHandler() http.Handler {
+	s, _ := namedSink("profile")
+	p := s.(*profileSink)
+	if !sinkEnabled("profile") {
+		p.attach.Do(func() { AddSink(p) })
+	}
+	return p
+}
+
+func (s *profileSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	z := gzip.NewWriter(&buf)
+	z.Write(s.profile())
+	z.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="errors.pb.gz"`)
+	w.Write(buf.Bytes())
+}
+
+// Encode the counts in the profile.proto format of pprof
+func (s *profileSink) profile() []byte {
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(v string) uint64 {
+		if i, ok := strs[v]; ok {
+			return uint64(i)
+		}
+		strs[v] = len(table)
+		table = append(table, v)
+		return uint64(len(table) - 1)
+	}
+
+	// every function gets a location of its own with the same id
+	funcs := make(map[string]uint64)
+	var locations, functions bytes.Buffer
+	location := func(name string) uint64 {
+		if id, ok := funcs[name]; ok {
+			return id
+		}
+		id := uint64(len(funcs) + 1)
+		funcs[name] = id
+
+		var fn protoBuffer
+		fn.uint(1, id)
+		fn.uint(2, str(name))
+		fn.uint(3, str(name))
+		functions.Write(protoMessage(5, fn.Bytes()))
+
+		var line, loc protoBuffer
+		line.uint(1, id)
+		loc.uint(1, id)
+		loc.bytes(4, line.Bytes())
+		locations.Write(protoMessage(4, loc.Bytes()))
+		return id
+	}
+
+	var p protoBuffer
+	var sampleType protoBuffer
+	sampleType.uint(1, str("errors"))
+	sampleType.uint(2, str("count"))
+	p.bytes(1, sampleType.Bytes())
+
+	s.mu.Lock()
+	for stack, n := range s.counts {
+		var ids []uint64
+		for _, name := range strings.Split(stack, "\n") {
+			ids = append(ids, location(name))
+		}
+		var sample protoBuffer
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{uint64(n)})
+		p.bytes(2, sample.Bytes())
+	}
+	s.mu.Unlock()
+
+	p.Write(locations.Bytes())
+	p.Write(functions.Bytes())
+	for _, v := range table {
+		p.bytes(6, []byte(v))
+	}
+	p.uint(9, uint64(s.start.UnixNano()))
+	p.uint(10, uint64(time.Since(s.start)))
+	return p.Bytes()
+}
+
+// protoBuffer encodes the few protobuf wire types needed for profiles
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	b.WriteByte(byte(v))
+}
+
+func (b *protoBuffer) uint(field int, v uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(v)
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(v)))
+	b.Write(v)
+}
+
+func (b *protoBuffer) packed(field int, vs []uint64) {
+	var inner protoBuffer
+	for _, v := range vs {
+		inner.varint(v)
+	}
+	b.bytes(field, inner.Bytes())
+}
+
+func protoMessage(field int, v []byte) []byte {
+	var b protoBuffer
+	b.bytes(field, v)
+	return b.Bytes()
+}
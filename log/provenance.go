@@ -0,0 +1,13 @@
+package log
+
+import "expvar"
+
+// provenance marks binaries built from instrumented sources, errgotrace provenance and release tooling search
+// binaries for it. Only Setup refers to it, which is only called by instrumented code, so binaries that just use
+// the API of the runtime don't contain it.
+const provenance = "errgotrace-provenance: built from instrumented sources"
+
+// Publish the marker as the expvar errgotrace_instrumented, so running processes can be checked too.
+func publishProvenance() {
+	expvar.NewString("errgotrace_instrumented").Set(provenance)
+}
@@ -0,0 +1,181 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Run these with go test -race, they hammer the runtime from many goroutines.
+const (
+	stressGoroutines = 16
+	stressEvents     = 500
+)
+
+// recordingSink remembers the events it got and fails the test if Emit is ever called concurrently
+type recordingSink struct {
+	t      *testing.T
+	active int32
+	seqs   []uint64
+	funcs  []string
+}
+
+func (s *recordingSink) Emit(e *Event) {
+	if atomic.AddInt32(&s.active, 1) != 1 {
+		s.t.Error("Emit called concurrently")
+	}
+	s.seqs = append(s.seqs, e.Seq)
+	s.funcs = append(s.funcs, e.Func)
+	atomic.AddInt32(&s.active, -1)
+}
+
+// Reset the global state the tests change.
+func resetRuntime(t *testing.T) {
+	t.Cleanup(func() {
+		SetMaxPerFunction(0)
+		SetSampling(1, false)
+		SetShortNames(false)
+		SetSlowThreshold(0)
+		removeConfigFile()
+		SetSinks(DefaultSink())
+		Enable()
+	})
+	SetBenchmarkMode(false)
+	Enable()
+}
+
+func TestConcurrentSinks(t *testing.T) {
+	resetRuntime(t)
+	a, b := &recordingSink{t: t}, &recordingSink{t: t}
+	SetSinks(a, b)
+
+	var wg sync.WaitGroup
+	for g := 0; g < stressGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			name := fmt.Sprintf("stress.F%d", g)
+			for i := 0; i < stressEvents; i++ {
+				InspectReturnValues(name, errors.New("failed"))
+				InspectReturnValues(name, nil)
+			}
+		}(g)
+	}
+	wg.Wait()
+	SetSinks(DefaultSink())
+
+	if len(a.seqs) != stressGoroutines*stressEvents {
+		t.Fatalf("got %d events, expected %d", len(a.seqs), stressGoroutines*stressEvents)
+	}
+
+	// every sink sees the same order
+	for i := range a.seqs {
+		if a.seqs[i] != b.seqs[i] {
+			t.Fatalf("event %d: sinks disagree on the order, seq %d and %d", i, a.seqs[i], b.seqs[i])
+		}
+	}
+
+	// the events of one goroutine keep the order of the calls
+	last := make(map[string]uint64)
+	for i, f := range a.funcs {
+		if a.seqs[i] <= last[f] {
+			t.Fatalf("%s: seq %d delivered after %d", f, a.seqs[i], last[f])
+		}
+		last[f] = a.seqs[i]
+	}
+}
+
+func TestReconfigureWhileEmitting(t *testing.T) {
+	resetRuntime(t)
+	dir, err := ioutil.TempDir("", "errgotrace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "errgotrace-runtime.yaml")
+
+	var delivered int64
+	counting := SinkFunc(func(e *Event) { atomic.AddInt64(&delivered, 1) })
+	SetSinks(counting)
+
+	stop := make(chan struct{})
+	var emitters, changers sync.WaitGroup
+	for g := 0; g < stressGoroutines; g++ {
+		emitters.Add(1)
+		go func(g int) {
+			defer emitters.Done()
+			for i := 0; i < stressEvents; i++ {
+				InspectReturnValues(fmt.Sprintf("stress.G%d", g%4), errors.New("failed"))
+			}
+		}(g)
+	}
+
+	// the settings of the environment, the sinks and the configuration file change all the time
+	changers.Add(3)
+	go func() {
+		defer changers.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			SetMaxPerFunction(i % 3 * 100)
+			SetShortNames(i%2 == 0)
+			SetSampling(1, i%2 == 0)
+			SetSlowThreshold(time.Duration(i%2) * time.Second)
+			With("iteration", i)
+		}
+	}()
+	go func() {
+		defer changers.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if i%2 == 0 {
+				SetSinks(counting)
+			} else {
+				AddSink(SinkFunc(func(e *Event) {}))
+			}
+			Flush()
+		}
+	}()
+	go func() {
+		defer changers.Done()
+		w := &configWatcher{file: config, size: -1, load: applyConfigFile, remove: removeConfigFile}
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			content := fmt.Sprintf("exclude: 'G%d$'\nsample: 1\n", i%4)
+			if err := ioutil.WriteFile(config, []byte(content), 0644); err != nil {
+				t.Error(err)
+				return
+			}
+			w.check()
+			if i%10 == 0 {
+				os.Remove(config)
+				w.check()
+			}
+		}
+	}()
+
+	emitters.Wait()
+	close(stop)
+	changers.Wait()
+
+	if atomic.LoadInt64(&delivered) == 0 {
+		t.Error("no event was delivered")
+	}
+}
@@ -0,0 +1,113 @@
+package log
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gellweiler/errgotrace/log/schema"
+)
+
+// replayedError is the error of a replayed event, it keeps the dynamic type of the recorded error
+type replayedError struct {
+	msg string
+	typ string
+}
+
+func (e *replayedError) Error() string {
+	return e.msg
+}
+
+// Get the dynamic type of an error for the sinks, the recorded one for replayed events
+func errorTypeName(err error) string {
+	switch e := err.(type) {
+	case *replayedError:
+		return e.typ
+	case *scrubbedError:
+		return errorTypeName(e.err)
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// Replay emits a recorded event to the sinks again, e.g. one read by schema.Decoder from the output of the
+// JSON sink. The filters, limits and budgets apply as if the program had returned the error, the budgets
+// count by the recorded times. The events keep their sequence numbers, the process of events sent to an
+// agent becomes the field process.
+func Replay(s *schema.Event) {
+	e := &Event{
+		Time:        s.Time,
+		Func:        s.Func,
+		ErrorFields: replayFields(s.ErrorFields),
+		Alert:       s.Alert,
+		Depth:       s.Depth,
+		Caller:      s.Caller,
+		Path:        s.Path,
+		Goroutines:  s.Goroutines,
+		Seq:         s.Seq,
+		Mono:        time.Duration(s.MonoNs),
+		Fields:      replayFields(s.Fields),
+		Build:       replayFields(s.Build),
+		Tags:        s.Tags,
+		Request:     s.Request,
+		Panic:       s.Panic,
+		Before:      s.ErrorsBefore,
+		Args:        replayFields(s.Args),
+		Receiver:    s.Receiver,
+		Duration:    time.Duration(s.DurationNs),
+		Stack:       s.Stack,
+	}
+	if s.Process != "" {
+		e.Fields = append(e.Fields, Field{Key: "process", Value: s.Process})
+	}
+	switch s.Call {
+	case "ENTER":
+		e.Trace = CallEnter
+	case "EXIT":
+		e.Trace = CallExit
+	case "SLOW":
+		e.Trace = CallSlow
+	}
+	switch s.Propagation {
+	case "ORIGIN":
+		e.Propagation = Origin
+	case "PROPAGATED":
+		e.Propagation = Propagated
+	}
+
+	if e.Trace != NoCall {
+		if !ignoredFunction(e.Func) {
+			emitEvent(e)
+		}
+		return
+	}
+
+	// recorded alerts are replayed as they are, the budgets raise their own
+	if s.Alert {
+		emitEvent(e)
+		return
+	}
+
+	// as are recorded loops, the loop detection only summarizes the replayed errors
+	e.Error = &replayedError{s.Error, s.ErrorType}
+	if s.Loop != nil {
+		e.Loop = &Loop{Count: s.Loop.Count, Suppressed: s.Loop.Suppressed, First: s.Loop.First, Last: s.Loop.Last}
+		emitEvent(e)
+		return
+	}
+
+	if !traced(e.Func, e.Error) {
+		return
+	}
+	recordLatency(e)
+	if outsideLoop(e) && withinLimit(e.Func, e.Error) {
+		emitEvent(e)
+	}
+	checkBudgets(e)
+}
+
+func replayFields(fields []schema.Field) []Field {
+	var f []Field
+	for _, s := range fields {
+		f = append(f, Field{Key: s.Key, Value: s.Value})
+	}
+	return f
+}
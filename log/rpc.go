@@ -0,0 +1,14 @@
+package log
+
+import (
+	"context"
+)
+
+// InspectRPC reports the error of an RPC with its full method name, e.g. /pkg.Service/Method.
+// It's called by the interceptors added to grpc.NewServer with -grpc, they live in the instrumented
+// code so the runtime doesn't depend on grpc.
+func InspectRPC(ctx context.Context, method string, err error) {
+	if err != nil {
+		InspectCall(&Call{Func: method, Ctx: ctx}, err)
+	}
+}
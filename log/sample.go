@@ -0,0 +1,40 @@
+package log
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// sampling set with SetSampling, nil traces every error
+var sampling atomic.Value // *sampleConfig
+
+type sampleConfig struct {
+	rate          float64
+	byFingerprint bool
+}
+
+// SetSampling traces only a fraction of the errors, between 0 and 1. With byFingerprint the first error with
+// a new function, type and message is always traced and only its repeats are sampled. The keys sample and
+// sample_by of the configuration file take precedence. A rate of 1 traces every error again.
+func SetSampling(rate float64, byFingerprint bool) {
+	sampling.Store(&sampleConfig{rate: rate, byFingerprint: byFingerprint})
+}
+
+// Check if an error is traced with the sampling of SetSampling, changed by the configuration file.
+func sampled(c *fileConfig, f string, err error) bool {
+	s := sampleConfig{rate: 1}
+	if p, _ := sampling.Load().(*sampleConfig); p != nil {
+		s = *p
+	}
+	if c != nil && c.sampleSet {
+		s.rate = c.sample
+	}
+	if c != nil && c.sampleBy != "" {
+		s.byFingerprint = c.sampleBy == "fingerprint"
+	}
+
+	if s.rate >= 1 {
+		return true
+	}
+	return s.byFingerprint && novelError(f, err) || rand.Float64() < s.rate
+}
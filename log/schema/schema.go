@@ -0,0 +1,115 @@
+// Package schema defines the JSON form of the events of the errgotrace runtime, as written by the JSON sink,
+// one object per line, and decodes it.
+//
+// Compatibility: within a schema version fields are only ever added, never renamed, removed or given a
+// different meaning. Tools written against version 1 keep working with the output of later runtimes,
+// the decoder ignores fields it doesn't know. A change that breaks this increments Version, the decoder
+// of an older version rejects such events instead of misreading them.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Version is the schema version of the events written by this runtime
+const Version = 1
+
+// Field is a named, already formatted value, in the order the runtime recorded it
+type Field struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Loop summarizes the Count occurrences of an error between First and Last, Suppressed of them were
+// not written as events of their own
+type Loop struct {
+	Count      int       `json:"count"`
+	Suppressed int       `json:"suppressed"`
+	First      time.Time `json:"first"`
+	Last       time.Time `json:"last"`
+}
+
+// Event is a single error or call of an instrumented function. Optional fields are omitted if empty.
+type Event struct {
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	Func          string    `json:"func"`
+
+	// Process is the name and pid of the process, set for the events sent to an agent, e.g. app[4711]
+	Process string `json:"process,omitempty"`
+
+	// The error and its dynamic type, empty for calls
+	Error       string  `json:"error,omitempty"`
+	ErrorType   string  `json:"error_type,omitempty"`
+	ErrorFields []Field `json:"error_fields,omitempty"`
+
+	// Call is ENTER, EXIT or SLOW for the events of call tracing and slow calls
+	Call string `json:"call,omitempty"`
+
+	// Alert is set for exceeded error budgets, Error describes the budget
+	Alert bool `json:"alert,omitempty"`
+
+	// Loop is set for the events summarizing the repeats of an error in a retry loop
+	Loop *Loop `json:"loop,omitempty"`
+
+	// Propagation is ORIGIN or PROPAGATED if the runtime tracks the origins of errors
+	Propagation string `json:"propagation,omitempty"`
+
+	// The tracked calls and the instrumented goroutines the event happened in, outermost first
+	Depth      int      `json:"depth,omitempty"`
+	Caller     string   `json:"caller,omitempty"`
+	Path       []string `json:"path,omitempty"`
+	Goroutines []string `json:"goroutines,omitempty"`
+
+	// Seq numbers the events of a process, MonoNs is the time since its start on the monotonic clock
+	Seq    uint64 `json:"seq"`
+	MonoNs int64  `json:"mono_ns"`
+
+	Fields []Field  `json:"fields,omitempty"`
+	Build  []Field  `json:"build,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+
+	// HTTP handlers and panics
+	Request      string   `json:"request,omitempty"`
+	Panic        bool     `json:"panic,omitempty"`
+	ErrorsBefore []string `json:"errors_before,omitempty"`
+
+	// Only set if the corresponding options were enabled for the function
+	Args       []Field `json:"args,omitempty"`
+	Receiver   string  `json:"receiver,omitempty"`
+	DurationNs int64   `json:"duration_ns,omitempty"`
+	Stack      string  `json:"stack,omitempty"`
+}
+
+// Duration returns the duration of the call, zero if it wasn't measured
+func (e *Event) Duration() time.Duration {
+	return time.Duration(e.DurationNs)
+}
+
+// Decoder reads events written one per line
+type Decoder struct {
+	dec *json.Decoder
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{json.NewDecoder(r)}
+}
+
+// Decode reads the next event, io.EOF after the last one. Events without a schema version or of a
+// later, incompatible version are an error.
+func (d *Decoder) Decode() (*Event, error) {
+	var e Event
+	if err := d.dec.Decode(&e); err != nil {
+		return nil, err
+	}
+	switch {
+	case e.SchemaVersion < 1:
+		return nil, fmt.Errorf("schema: event without schema_version")
+	case e.SchemaVersion > Version:
+		return nil, fmt.Errorf("schema: event of schema version %d, only %d is supported", e.SchemaVersion, Version)
+	}
+	return &e, nil
+}
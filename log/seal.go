@@ -0,0 +1,83 @@
+package log
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gellweiler/errgotrace/internal/seal"
+)
+
+// sealed batches are written this often if there are events
+const sealInterval = time.Second
+
+// SealedSink writes the events in batches to w, every batch encrypted to a public key or signed, so traces
+// can be shipped out of regulated environments. Every batch is a single line, errgotrace unseal reads them.
+// The events are in the format of the standard logger, they are written every second and by Flush.
+type SealedSink struct {
+	w    io.Writer
+	seal func(batch []byte) (string, error)
+
+	mu     sync.Mutex
+	batch  bytes.Buffer
+	failed bool
+}
+
+// NewEncryptedSink creates a sink encrypting every batch to the X25519 public key, similar to a NaCl
+// sealed box. Only the owner of the private key can read the events. Needs go 1.20.
+func NewEncryptedSink(w io.Writer, publicKey []byte) (*SealedSink, error) {
+	f, err := seal.Encrypter(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("sealed: %s", err)
+	}
+	return newSealedSink(w, f), nil
+}
+
+// NewSignedSink creates a sink signing every batch with the Ed25519 key, the events stay readable.
+func NewSignedSink(w io.Writer, key ed25519.PrivateKey) (*SealedSink, error) {
+	f, err := seal.Signer(key)
+	if err != nil {
+		return nil, fmt.Errorf("signed: %s", err)
+	}
+	return newSealedSink(w, f), nil
+}
+
+func newSealedSink(w io.Writer, f func(batch []byte) (string, error)) *SealedSink {
+	s := &SealedSink{w: w, seal: f}
+	go func() {
+		for range time.Tick(sealInterval) {
+			s.Flush()
+		}
+	}()
+	return s
+}
+
+func (s *SealedSink) Emit(e *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch.WriteString(e.Time.Format("2006/01/02 15:04:05") + " [ERRGOTRACE] " + e.Text() + "\n")
+}
+
+// Flush seals and writes the events collected since the last batch, only the first of consecutive
+// failures is reported.
+func (s *SealedSink) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.batch.Len() == 0 {
+		return
+	}
+
+	line, err := s.seal(s.batch.Bytes())
+	if err == nil {
+		_, err = io.WriteString(s.w, line+newline)
+	}
+	if err != nil && !s.failed {
+		log.Printf("[ERRGOTRACE] sealed: %s", err)
+	}
+	s.failed = err != nil
+	s.batch.Reset()
+}
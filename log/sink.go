@@ -0,0 +1,152 @@
+package log
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sink receives the events of the runtime.
+//
+// Ordering guarantees: Emit is never called concurrently, neither for the same sink nor for
+// different sinks, so sinks do not need synchronization of their own. Every sink sees all
+// events in the same order, the order in which they were emitted. Events emitted by one
+// goroutine keep the order of the calls, events of different goroutines are interleaved.
+// Emit blocks the instrumented function, slow sinks should buffer. With EnableBuffering
+// the events are only ordered by sequence number within each delivered batch.
+type Sink interface {
+	Emit(e *Event)
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(e *Event)
+
+func (f SinkFunc) Emit(e *Event) {
+	f(e)
+}
+
+// logSink writes events with the standard logger, the default sink
+type logSink struct{}
+
+func (logSink) Emit(e *Event) {
+	log.Printf("[ERRGOTRACE] %s%s", textLines(e.Text()), newline)
+}
+
+var (
+	sinkMu sync.Mutex
+	sinks  = []Sink{platformSink()}
+)
+
+// AddSink registers an additional sink.
+func AddSink(s Sink) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	sinks = append(sinks, s)
+}
+
+// SetSinks replaces all sinks, including the default one writing to the standard logger.
+func SetSinks(s ...Sink) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	sinks = append([]Sink(nil), s...)
+}
+
+// DefaultSink returns the sink writing to the standard logger, or to the console under GOOS=js
+func DefaultSink() Sink {
+	return platformSink()
+}
+
+// Errors beyond the limit of the function still count for the budgets
+func emit(e *Event) {
+	if !trackOrigin(e) {
+		return
+	}
+	stamp(e)
+	if !e.Alert && !e.Panic {
+		recordBreadcrumb(e)
+		recordLatency(e)
+	}
+	if outsideLoop(e) && withinLimit(e.Func, e.Error) {
+		emitEvent(e)
+	}
+	checkBudgets(e)
+}
+
+// Calls are neither limited nor counted for the budgets
+func emitCall(e *Event) {
+	if ignoredFunction(e.Func) {
+		return
+	}
+	stamp(e)
+	emitEvent(e)
+}
+
+var (
+	processStart = time.Now()
+	lastSeq      uint64
+)
+
+// Number the event and attach the fields of With, the build and the tags, also alerts get their own number
+func stamp(e *Event) {
+	e.Seq = atomic.AddUint64(&lastSeq, 1)
+	e.Mono = time.Since(processStart)
+	e.Fields = ambientFields()
+	e.Build = buildFields()
+	if !e.Alert {
+		e.Goroutines = goroutineChain()
+	}
+	if !e.Alert && e.Trace == NoCall {
+		e.Tags = classify(e.Error)
+		e.ErrorFields = errorFields(e.Error)
+		e.Error = scrubError(e.Error)
+		if e.Path = callPath(e.Func); len(e.Path) > 0 {
+			e.Depth, e.Caller = len(e.Path), e.Path[len(e.Path)-1]
+		}
+	}
+}
+
+func emitEvent(e *Event) {
+	if !filtered(e) {
+		return
+	}
+	keep, last := captured()
+	if !keep {
+		return
+	}
+	if last {
+		defer endCapture()
+	}
+	if benchmarked(e) {
+		return
+	}
+	if atomic.LoadInt32(&buffered) == 1 {
+		bufferEvent(e)
+		return
+	}
+	dispatch(e)
+}
+
+// Flush the sinks that buffer events, outside of sinkMu as flushing may take a while
+func flushSinks() {
+	sinkMu.Lock()
+	current := append([]Sink(nil), sinks...)
+	sinkMu.Unlock()
+
+	for _, s := range current {
+		if f, ok := s.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+	}
+}
+
+// Deliver events to all sinks
+func dispatch(events ...*Event) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	for _, e := range events {
+		for _, s := range sinks {
+			s.Emit(e)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package log
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// calls with timing that ran at least this long emit a SLOW event, 0 disables them
+var slowThreshold int64
+
+// SetSlowThreshold makes calls of functions instrumented with timing emit a SLOW event if they ran for at
+// least d, whether they failed or not. Errors are reported as usual. 0 turns SLOW events off.
+func SetSlowThreshold(d time.Duration) {
+	atomic.StoreInt64(&slowThreshold, int64(d))
+}
+
+// Slow reports whether a call started at start exceeded the threshold, instrumented code calls it to
+// inspect the results of successful calls too.
+func Slow(start time.Time) bool {
+	d := atomic.LoadInt64(&slowThreshold)
+	return d > 0 && !start.IsZero() && time.Since(start) >= time.Duration(d)
+}
+
+// Emit the SLOW event of a call, calls are not slow without a start time.
+func inspectSlow(c *Call) {
+	if !Slow(c.Start) {
+		return
+	}
+	e := c.event()
+	e.Trace = CallSlow
+	emitCall(&e)
+}
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+var statsdFields atomic.Value // map[string]bool, the fields of With tagging the metrics
+
+// statsdSink counts errors as the metric errgotrace.errors on a statsd server,
+// tagged with the function and the type of the error in the DogStatsD format. Alerts are
+// counted as errgotrace.alerts, calls as errgotrace.calls without the error type. Fields of With
+// are only tags if allowed by SetStatsdFields, to keep the number of metrics bounded.
+type statsdSink struct {
+	conn net.Conn
+	tags string
+}
+
+// NewStatsdSink creates a sink sending a counter for every error to the statsd server at addr via UDP,
+// tags such as "env:prod" are added to every metric.
+func NewStatsdSink(addr string, tags ...string) (Sink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %s", err)
+	}
+
+	s := &statsdSink{conn: conn}
+	for _, t := range tags {
+		s.tags += "," + statsdTag(t)
+	}
+	return s, nil
+}
+
+// Sending is best effort, lost packets and unreachable servers are ignored.
+func (s *statsdSink) Emit(e *Event) {
+	metric := "errgotrace.errors"
+	if e.Alert {
+		metric = "errgotrace.alerts"
+	}
+	if e.Trace == CallExit {
+		metric = "errgotrace.calls"
+	} else if e.Trace != NoCall {
+		return
+	}
+	tags := s.tags
+	allowed, _ := statsdFields.Load().(map[string]bool)
+	for _, f := range e.Fields {
+		if allowed[f.Key] {
+			tags += "," + statsdTag(f.Key+":"+f.Value)
+		}
+	}
+	for _, t := range e.Tags {
+		tags += ",class:" + statsdTag(t)
+	}
+	if e.Error != nil {
+		tags = ",error_type:" + statsdTag(errorTypeName(e.Error)) + tags
+	}
+	msg := fmt.Sprintf("%s:%d|c|#function:%s%s", metric, e.occurrences(), statsdTag(e.Func), tags)
+	s.conn.Write([]byte(msg))
+}
+
+// SetStatsdFields sets the keys of the fields of With that are added as tags to the statsd metrics,
+// e.g. "service". By default no field is a tag, as every distinct value is a metric of its own.
+func SetStatsdFields(keys ...string) {
+	m := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		m[k] = true
+	}
+	statsdFields.Store(m)
+}
+
+// Replace the characters with a special meaning in the statsd protocol.
+func statsdTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', ',', '#', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package log
+
+var newline = "\n"
+
+func stderrLost() bool {
+	return false
+}
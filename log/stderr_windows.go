@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package log
+
+import "syscall"
+
+// Windows tools expect CRLF in text files and on the console
+var newline = "\r\n"
+
+// Services have no console, the output of the standard logger to stderr is lost without error.
+func stderrLost() bool {
+	t, err := syscall.GetFileType(syscall.Stderr)
+	return err != nil || t == syscall.FILE_TYPE_UNKNOWN
+}
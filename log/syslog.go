@@ -0,0 +1,140 @@
+//go:build !windows && !plan9 && !js && !wasip1 && !tinygo
+// +build !windows,!plan9,!js,!wasip1,!tinygo
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// syslogSink writes events to the local syslog daemon with the priority LOG_ERR, alerts with LOG_ALERT
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink creates a sink writing to the local syslog daemon, tag defaults to the program name.
+func NewSyslogSink(tag string) (Sink, error) {
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	w, err := syslog.New(syslog.LOG_ERR|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, fmt.Errorf("syslog: %s", err)
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Emit(e *Event) {
+	msg := "[ERRGOTRACE] " + strings.Replace(e.Text(), "\n", " | ", -1)
+	switch {
+	case e.Alert:
+		s.w.Alert(msg)
+	case e.Trace != NoCall:
+		s.w.Info(msg)
+	default:
+		s.w.Err(msg)
+	}
+}
+
+// journalSocket is where journald receives messages in its native protocol
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalSink sends events to journald, with the details as structured fields
+type journalSink struct {
+	conn net.Conn
+}
+
+// NewJournalSink creates a sink sending to the systemd journal. Besides MESSAGE every entry has the
+// fields ERRGO_FUNCTION, ERRGO_ERRTYPE, ERRGO_ERROR, ERRGO_SEQ and, if known, ERRGO_ARGS, ERRGO_FIELDS, ERRGO_TAGS, ERRGO_RECEIVER, ERRGO_REQUEST, ERRGO_CALLER,
+// ERRGO_DURATION and ERRGO_STACK. Calls have ERRGO_CALL instead of the error fields.
+func NewJournalSink() (Sink, error) {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return nil, fmt.Errorf("journal: %s", err)
+	}
+	return &journalSink{conn: conn}, nil
+}
+
+// Sending is best effort, the journal drops messages it can't keep up with anyway.
+func (s *journalSink) Emit(e *Event) {
+	var buf bytes.Buffer
+	switch {
+	case e.Alert:
+		journalField(&buf, "MESSAGE", e.Func+": "+e.Message())
+		journalField(&buf, "PRIORITY", "1")
+	case e.Trace != NoCall:
+		journalField(&buf, "MESSAGE", e.Trace.String()+" "+e.Func)
+		journalField(&buf, "PRIORITY", "6")
+	default:
+		journalField(&buf, "MESSAGE", e.Func+": "+e.Message())
+		journalField(&buf, "PRIORITY", "3")
+	}
+	journalField(&buf, "SYSLOG_IDENTIFIER", filepath.Base(os.Args[0]))
+	journalField(&buf, "ERRGO_FUNCTION", e.Func)
+	if e.Trace != NoCall {
+		journalField(&buf, "ERRGO_CALL", e.Trace.String())
+	} else {
+		journalField(&buf, "ERRGO_ERRTYPE", errorTypeName(e.Error))
+		journalField(&buf, "ERRGO_ERROR", e.Message())
+	}
+	journalField(&buf, "ERRGO_SEQ", strconv.FormatUint(e.Seq, 10))
+
+	if len(e.Args) > 0 {
+		journalField(&buf, "ERRGO_ARGS", joinFields(e.Args))
+	}
+	if len(e.Fields) > 0 {
+		journalField(&buf, "ERRGO_FIELDS", joinFields(e.Fields))
+	}
+	if len(e.Build) > 0 {
+		journalField(&buf, "ERRGO_BUILD", joinFields(e.Build))
+	}
+	if len(e.ErrorFields) > 0 {
+		journalField(&buf, "ERRGO_ERROR_FIELDS", joinFields(e.ErrorFields))
+	}
+	if len(e.Tags) > 0 {
+		journalField(&buf, "ERRGO_TAGS", strings.Join(e.Tags, ","))
+	}
+	if e.Receiver != "" {
+		journalField(&buf, "ERRGO_RECEIVER", e.Receiver)
+	}
+	if e.Request != "" {
+		journalField(&buf, "ERRGO_REQUEST", e.Request)
+	}
+	if e.Caller != "" {
+		journalField(&buf, "ERRGO_CALLER", e.Caller)
+	}
+	if len(e.Goroutines) > 0 {
+		journalField(&buf, "ERRGO_GOROUTINES", strings.Join(e.Goroutines, " > "))
+	}
+	if e.Duration > 0 {
+		journalField(&buf, "ERRGO_DURATION", e.Duration.String())
+	}
+	if e.Loop != nil {
+		journalField(&buf, "ERRGO_LOOP", e.Loop.String())
+	}
+	if e.Stack != "" {
+		journalField(&buf, "ERRGO_STACK", e.Stack)
+	}
+
+	s.conn.Write(buf.Bytes())
+}
+
+// Append a field in the native journal format, values with newlines are length prefixed.
+func journalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(name + "=" + value + "\n")
+		return
+	}
+
+	buf.WriteString(name + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
@@ -0,0 +1,19 @@
+//go:build windows || plan9 || js || wasip1 || tinygo
+// +build windows plan9 js wasip1 tinygo
+
+package log
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// NewSyslogSink is not supported on this platform.
+func NewSyslogSink(tag string) (Sink, error) {
+	return nil, fmt.Errorf("syslog: not supported on %s", runtime.GOOS)
+}
+
+// NewJournalSink is not supported on this platform.
+func NewJournalSink() (Sink, error) {
+	return nil, fmt.Errorf("journal: not supported on %s", runtime.GOOS)
+}
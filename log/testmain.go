@@ -0,0 +1,140 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TB is the part of testing.TB used by Test, so programs don't link the testing package by importing the runtime
+type TB interface {
+	Name() string
+	Failed() bool
+	Cleanup(func())
+	Helper()
+	Logf(format string, args ...interface{})
+}
+
+var (
+	testMu sync.Mutex
+	// tests started with Test that didn't finish yet, parallel tests run at the same time
+	runningTests []*testRun
+	// set by TestMain, tracing is disabled while no test runs
+	testsOnly bool
+
+	testFilterOnce sync.Once
+)
+
+// errors of a test for its summary
+type testRun struct {
+	name   string
+	total  int
+	funcs  []string
+	errors map[string]*testErrors
+}
+
+type testErrors struct {
+	count int
+	first string
+}
+
+// TestMain runs the tests of a package with tracing disabled outside of the tests calling Test, e.g.
+//
+//   func TestMain(m *testing.M) {
+//       log.TestMain(m)
+//   }
+//
+// It exits with the result of m.Run, after flushing the sinks.
+func TestMain(m interface{ Run() int }) {
+	testMu.Lock()
+	testsOnly = true
+	testMu.Unlock()
+	Disable()
+
+	code := m.Run()
+	Flush()
+	os.Exit(code)
+}
+
+// Test traces the errors while the test runs and tags their events with the field test, the name of the test.
+// If the test fails, the errors traced while it ran are logged with it. Events of parallel tests are tagged
+// with the names of all tests running at the time.
+func Test(t TB) {
+	t.Helper()
+	testFilterOnce.Do(func() { AddFilter(tagTest) })
+
+	r := &testRun{name: t.Name(), errors: make(map[string]*testErrors)}
+	testMu.Lock()
+	runningTests = append(runningTests, r)
+	testMu.Unlock()
+	Enable()
+
+	t.Cleanup(func() {
+		testMu.Lock()
+		for i, running := range runningTests {
+			if running == r {
+				runningTests = append(runningTests[:i:i], runningTests[i+1:]...)
+				break
+			}
+		}
+		if testsOnly && len(runningTests) < 1 {
+			Disable()
+		}
+		summary := r.summary()
+		testMu.Unlock()
+
+		if t.Failed() && summary != "" {
+			t.Logf("%s", summary)
+		}
+	})
+}
+
+// Tag an event with the running tests and count its error for them, see AddFilter.
+func tagTest(e *Event) bool {
+	testMu.Lock()
+	defer testMu.Unlock()
+	if len(runningTests) < 1 {
+		return true
+	}
+
+	names := make([]string, len(runningTests))
+	for i, r := range runningTests {
+		names[i] = r.name
+		if e.Error != nil && e.Trace == NoCall && !e.Alert {
+			r.add(e.Func, e.Message())
+		}
+	}
+
+	// the fields are shared between events
+	e.Fields = append(append([]Field(nil), e.Fields...), Field{Key: "test", Value: strings.Join(names, ",")})
+	return true
+}
+
+func (r *testRun) add(f, msg string) {
+	r.total++
+	if errs, ok := r.errors[f]; ok {
+		errs.count++
+		return
+	}
+	r.funcs = append(r.funcs, f)
+	r.errors[f] = &testErrors{count: 1, first: msg}
+}
+
+// The errors of the test per function with the first message, empty without errors.
+func (r *testRun) summary() string {
+	if r.total < 1 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[ERRGOTRACE] %d errors traced while the test ran:", r.total)
+	for _, f := range r.funcs {
+		errs := r.errors[f]
+		fmt.Fprintf(&b, "\n%s: %s", f, errs.first)
+		if errs.count > 1 {
+			fmt.Fprintf(&b, " (%d times)", errs.count)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+	"unicode"
+)
+
+// Check if a method has no receiver name to call its backend with.
+func unnamedReceiver(f *ast.FuncDecl) bool {
+	return f.Recv != nil && len(f.Recv.List) > 0 && (len(f.Recv.List[0].Names) < 1 || f.Recv.List[0].Names[0].Name == "_")
+}
+
+// Check if a receiver is of a generic type, like List[K, V] or *List[K, V].
+func genericReceiver(t ast.Expr) bool {
+	switch t := t.(type) {
+	case *ast.ParenExpr:
+		return genericReceiver(t.X)
+	case *ast.StarExpr:
+		return genericReceiver(t.X)
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		return true
+	}
+	return false
+}
+
+// Mangle the receiver type of a method into an identifier, for the backend of methods with an unnamed
+// receiver, which becomes a function: T and *T are both T. A type can't have a method of the same name for
+// both, so pointers need no marker, which could collide with a type named like it, e.g. __T. Identifiers are
+// kept as they are, unicode included, everything else is replaced by fixed ASCII sequences, so the name only
+// depends on the source and the source map can relate the backend to its method. Receivers of generic types
+// keep a backend method, for them the result is only an identifier, e.g. List_oK_V_c for List[K, V].
+func mangleReceiver(t ast.Expr) string {
+	switch t := t.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.ParenExpr:
+		return mangleReceiver(t.X)
+	case *ast.StarExpr:
+		return mangleReceiver(t.X)
+	case *ast.SelectorExpr:
+		return mangleReceiver(t.X) + "_" + t.Sel.Name
+	case *ast.IndexExpr:
+		return mangleReceiver(t.X) + "_o" + mangleReceiver(t.Index) + "_c"
+	case *ast.IndexListExpr:
+		var args []string
+		for _, idx := range t.Indices {
+			args = append(args, mangleReceiver(idx))
+		}
+		return mangleReceiver(t.X) + "_o" + strings.Join(args, "_") + "_c"
+	}
+
+	// receivers are always one of the above, anything else only needs to be a valid identifier
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, types.ExprString(t))
+}
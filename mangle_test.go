@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// Set the options of add for the tests, as if given on the command line.
+func annotateOptions(t testing.TB, args ...string) {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	registerPathFlags(fs)
+	registerAnnotateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	old := activeFlags
+	activeFlags = fs
+	t.Cleanup(func() {
+		activeFlags = old
+		rules, rulesSource = nil, nil
+	})
+	if err := loadOptions(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Methods with an unnamed receiver get a backend function named after the mangled receiver, which has to be an
+// identifier, keep the identifiers of the receiver and be related to its method by the source map. Methods of
+// generic types get a backend method.
+func FuzzMangledReceiver(f *testing.F) {
+	f.Add("List", "K, V", true)
+	f.Add("Ünïcödé", "", false)
+	f.Add("日本", "T", true)
+	f.Add("τ_o", "_c", false)
+	f.Add("T", "", true)
+
+	f.Fuzz(func(t *testing.T, name, params string, pointer bool) {
+		annotateOptions(t)
+		decl, args := "", ""
+		if params != "" {
+			var names []string
+			for _, p := range strings.Split(params, ",") {
+				names = append(names, strings.TrimSpace(p))
+			}
+			decl, args = " any", "["+strings.Join(names, ", ")+"]"
+			decl = "[" + strings.Join(names, decl+", ") + decl + "]"
+		}
+		recv := name + args
+		if pointer {
+			recv = "*" + recv
+		}
+		src := []byte(fmt.Sprintf("package p\n\ntype %s%s struct{}\n\nfunc (%s) M() error { return nil }\n", name, decl, recv))
+
+		file, err := parser.ParseFile(token.NewFileSet(), "fuzz.go", src, 0)
+		if err != nil || len(file.Decls) != 2 {
+			return
+		}
+		fn, ok := file.Decls[1].(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 {
+			return
+		}
+
+		mangled := mangleReceiver(fn.Recv.List[0].Type)
+		if !token.IsIdentifier(mangled) {
+			t.Fatalf("receiver %s mangled to %q, not an identifier", recv, mangled)
+		}
+		rest := mangled
+		ast.Inspect(fn.Recv.List[0].Type, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				i := strings.Index(rest, id.Name)
+				if i < 0 {
+					t.Fatalf("receiver %s mangled to %q, without %s", recv, mangled, id.Name)
+				}
+				rest = rest[i+len(id.Name):]
+			}
+			return true
+		})
+
+		out, _, err := annotate("fuzz.go", src)
+		if err != nil {
+			t.Fatalf("%s: %s", src, err)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "fuzz.go", out, 0); err != nil {
+			t.Fatalf("%s: result doesn't parse (%s)\n%s", src, err, out)
+		}
+		// generic types keep their methods, the backend needs the type parameters
+		backend := "__" + mangled + "_M"
+		if genericReceiver(fn.Recv.List[0].Type) {
+			backend = "__M"
+		}
+		funcs := buildSourceMap("fuzz.go", src, out).Functions
+		if len(funcs) != 1 || funcs[0].Func != "M" || funcs[0].Backend != backend {
+			t.Fatalf("%s: expected the backend of M in the source map, got %+v\n%s", src, funcs, out)
+		}
+	})
+}
+
+// Pointer receivers need no marker in the backend name, which could collide with a type named like it.
+func TestMangledPointerReceiver(t *testing.T) {
+	annotateOptions(t)
+	src := []byte("package p\n\nimport \"errors\"\n\ntype T struct{}\n\ntype __T struct{}\n\n" +
+		"func (*T) Get() error { return errors.New(\"T\") }\n\nfunc (__T) Get() error { return errors.New(\"__T\") }\n")
+	out, _, err := annotate("p.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", out, 0)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	if err := checkTypes(fset, f); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+
+	var got []string
+	for _, fn := range buildSourceMap("p.go", src, out).Functions {
+		got = append(got, fn.Name+" "+fn.Backend)
+	}
+	if want := "p.*T.Get __T_Get, p.__T.Get ____T_Get"; strings.Join(got, ", ") != want {
+		t.Errorf("got backends %q, expected %s", got, want)
+	}
+}
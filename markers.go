@@ -0,0 +1,120 @@
+package main
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	beginMarker    = "/* BEGIN_ERRGOTRACE */"
+	endMarker      = "/* END_ERRGOTRACE */"
+	originalMarker = "/* ERRGOTRACE_ORIGINAL "
+	onelineMarker  = "/* ERRGOTRACE_ONELINE "
+)
+
+// Find the marker comments of a go source by their offsets. Only comments of their own count,
+// the same text in string literals or inside other comments is left alone by the removal.
+func markerComments(src []byte) map[int]bool {
+	markers := make(map[int]bool)
+
+	var s scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return markers
+		}
+		if tok == token.COMMENT && (lit == beginMarker || lit == endMarker || strings.HasPrefix(lit, originalMarker) || strings.HasPrefix(lit, onelineMarker)) {
+			markers[file.Offset(pos)] = true
+		}
+	}
+}
+
+// Find the lines of the one-line functions getting tracing code, which formatting expands to several lines.
+func oneLiners(f *ast.File, edits []edit) []int {
+	var starts []int
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		pos, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+		if pos.Line != end.Line || pos.Column != 1 {
+			continue
+		}
+		for _, e := range edits {
+			if e.pos >= pos.Offset && e.pos <= end.Offset {
+				starts = append(starts, pos.Offset)
+				break
+			}
+		}
+	}
+	return starts
+}
+
+// Keep the line starting at start in a marker before it, so the removal can put it back in place of the
+// expanded function. The line is quoted, and the end of a comment escaped inside the quotes.
+func onelineCode(src []byte, start int) string {
+	line := strings.TrimSuffix(string(src[start:lineEnd(src, start)]), "\n")
+	return onelineMarker + strings.Replace(strconv.Quote(line), "*/", `*\x2f`, -1) + " */\n"
+}
+
+// Hide the marker lookalikes of a line that aren't marker comments from the regular expressions of the
+// removal. NUL can't appear in go source, it replaces the slash of a lookalike until unmaskLookalikes.
+func maskLookalikes(line string, marker func(int) bool) string {
+	b := []byte(line)
+	for i := strings.Index(line, "/*"); i >= 0; {
+		rest := line[i:]
+		if !marker(i) && (strings.HasPrefix(rest, beginMarker) || strings.HasPrefix(rest, endMarker) || strings.HasPrefix(rest, originalMarker) || strings.HasPrefix(rest, onelineMarker)) {
+			b[i] = 0
+		}
+
+		next := strings.Index(line[i+2:], "/*")
+		if next < 0 {
+			break
+		}
+		i += next + 2
+	}
+	return string(b)
+}
+
+func unmaskLookalikes(line string) string {
+	return strings.Replace(line, "\x00", "/", -1)
+}
+
+// Check if a file belongs to the runtime of errgotrace, also in a vendor directory. The runtime is never
+// instrumented, it would trace itself, and removing code from it would break the tool.
+func runtimeFile(file string) bool {
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return false
+	}
+
+	p := packageImportPath(dir)
+	if p == "" {
+		p = gopathImportPath(dir)
+	}
+	if i := strings.LastIndex(p, "/vendor/"); i >= 0 {
+		p = p[i+len("/vendor/"):]
+	} else {
+		p = strings.TrimPrefix(p, "vendor/")
+	}
+
+	return p == runtimeModule+"/log" || strings.HasPrefix(p, runtimeModule+"/log/") || strings.HasPrefix(p, runtimeModule+"/internal/")
+}
+
+// Remove the files of the runtime from the files to process.
+func withoutRuntime(files []string) []string {
+	var kept []string
+	for _, file := range files {
+		if !runtimeFile(file) {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// -merge of view, -correlate implies it
+	viewMerge     bool
+	viewCorrelate string
+)
+
+// Layouts of the timestamps log lines start with: the standard logger with and without microseconds,
+// RFC 3339 of docker logs -t and the syslog format, whose year is the current one.
+var mergeTimeLayouts = []string{
+	"2006/01/02 15:04:05.000000",
+	"2006/01/02 15:04:05",
+	time.RFC3339Nano,
+	"Jan _2 15:04:05",
+}
+
+// the service prefix of docker compose logs, e.g. "api-1  | "
+var composePrefix = regexp.MustCompile(`^([\w.-]+)\s+\| ?`)
+
+// mergedLine is a trace line of one of the merged processes
+type mergedLine struct {
+	process string
+	time    time.Time
+	id      string
+	text    string
+}
+
+// Get the name of a process from the name of its log file, e.g. api for logs/api.log.
+func processName(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Parse the timestamp a log line starts with, false if it doesn't.
+func lineTime(line string) (time.Time, bool) {
+	for _, layout := range mergeTimeLayouts {
+		n := len(layout)
+		if layout == time.RFC3339Nano {
+			n = strings.IndexByte(line, ' ')
+		}
+		if n < 1 || len(line) < n {
+			continue
+		}
+		t, err := time.ParseInLocation(layout, line[:n], time.Local)
+		if err != nil {
+			continue
+		}
+		if t.Year() == 0 {
+			t = t.AddDate(time.Now().Year(), 0, 0)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// Find the value of key=value in the fields and arguments of a trace line, empty if it has none.
+func correlationID(key *regexp.Regexp, line string) string {
+	m := key.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// Read the trace lines of a process. Lines of docker compose logs are attributed to their service instead.
+// Lines without a timestamp get the time of the line before them.
+func readMergedLines(r io.Reader, process string, funcFilter, key *regexp.Regexp) ([]mergedLine, error) {
+	var lines []mergedLine
+	var last time.Time
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		text, name := scanner.Text(), process
+		if m := composePrefix.FindStringSubmatch(text); m != nil {
+			text, name = text[len(m[0]):], m[1]
+		}
+
+		f, ok := traceLineFunc(text)
+		if !ok || funcFilter != nil && !funcFilter.MatchString(f) {
+			continue
+		}
+		if t, ok := lineTime(text); ok {
+			last = t
+		}
+
+		l := mergedLine{process: name, time: last, text: text}
+		if key != nil {
+			l.id = correlationID(key, text)
+		}
+		lines = append(lines, l)
+	}
+	return lines, scanner.Err()
+}
+
+// Merge the trace lines of several processes into one timeline, every line prefixed with its process.
+// With a correlation key the lines are grouped by its value, the groups in the order they started.
+func mergeTraces(files []string, w io.Writer, funcFilter *regexp.Regexp) error {
+	var key *regexp.Regexp
+	if viewCorrelate != "" {
+		key = regexp.MustCompile(`(?:^|[\s\[,])` + regexp.QuoteMeta(viewCorrelate) + `=("(?:[^"\\]|\\.)*"|[^,\]\s]+)`)
+	}
+
+	var lines []mergedLine
+	read := func(name string, r io.Reader) error {
+		l, err := readMergedLines(r, processName(name), funcFilter, key)
+		lines = append(lines, l...)
+		return err
+	}
+
+	if len(files) < 1 {
+		if err := read("stdin", os.Stdin); err != nil {
+			return fmt.Errorf("stdin: failed to read (%s)", err)
+		}
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("%s: failed to open (%s)", file, err)
+		}
+		err = read(file, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: failed to read (%s)", file, err)
+		}
+	}
+
+	// the lines of a process keep their order, its timestamps may be coarser than its events
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].time.Before(lines[j].time) })
+
+	width := 0
+	for _, l := range lines {
+		if len(l.process) > width {
+			width = len(l.process)
+		}
+	}
+	printLine := func(l mergedLine) {
+		fmt.Fprintf(w, "%-*s %s\n", width+2, "["+l.process+"]", l.text)
+	}
+
+	if key == nil {
+		for _, l := range lines {
+			printLine(l)
+		}
+		return nil
+	}
+
+	// lines without the key come last
+	var ids []string
+	groups := make(map[string][]mergedLine)
+	for _, l := range lines {
+		if _, ok := groups[l.id]; !ok && l.id != "" {
+			ids = append(ids, l.id)
+		}
+		groups[l.id] = append(groups[l.id], l)
+	}
+	for i, id := range ids {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "=== %s=%s\n", viewCorrelate, id)
+		for _, l := range groups[id] {
+			printLine(l)
+		}
+	}
+	if rest := groups[""]; len(rest) > 0 {
+		if len(ids) > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "=== without %s\n", viewCorrelate)
+		for _, l := range rest {
+			printLine(l)
+		}
+	}
+	return nil
+}
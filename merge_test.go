@@ -0,0 +1,25 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestReadMergedLines(t *testing.T) {
+	for _, tt := range traceLines {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "2024/05/01 09:59:59 listening on :8080\n" + tt.line + "\n"
+			lines, err := readMergedLines(strings.NewReader(input), "api", regexp.MustCompile("^"+regexp.QuoteMeta(tt.fn)+"$"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lines) != 1 || lines[0].text != tt.line || lines[0].process != "api" {
+				t.Fatalf("got %+v, expected the trace line of api", lines)
+			}
+			if lines[0].time.IsZero() {
+				t.Error("the time of the line wasn't parsed")
+			}
+		})
+	}
+}
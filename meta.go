@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metaFlags collects the key=value pairs of -meta, a key given again replaces its value
+type metaFlags map[string]string
+
+// the key of -meta that is taken from the build info of the program if it has no value
+const metaVersion = "version"
+
+var metaFlag = metaFlags{}
+
+func (m metaFlags) String() string {
+	var pairs []string
+	for _, k := range m.keys() {
+		pairs = append(pairs, k+"="+m[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metaFlags) Set(v string) error {
+	if v == metaVersion {
+		m[v] = ""
+		return nil
+	}
+	i := strings.Index(v, "=")
+	if i < 1 {
+		return fmt.Errorf("%q is not key=value", v)
+	}
+	m[v[:i]] = v[i+1:]
+	return nil
+}
+
+func (m metaFlags) keys() []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The setup code appended to every instrumented file, it registers the metadata of -meta with the runtime.
+// Without a value for the version, the runtime takes it from debug.ReadBuildInfo: the version of the main
+// module, or the vcs.revision and vcs.time of the commit the program was built from.
+func setupCode() string {
+	if len(metaFlag) < 1 {
+		return setup
+	}
+
+	var args []string
+	for _, k := range metaFlag.keys() {
+		if k == metaVersion && metaFlag[k] == "" {
+			continue
+		}
+		args = append(args, strconv.Quote(k), strconv.Quote(metaFlag[k]))
+	}
+	code := ""
+	if len(args) > 0 {
+		code += "var _ = __errgotrace.Build(" + strings.Join(args, ", ") + ")\n"
+	}
+	if metaFlag[metaVersion] == "" {
+		code += "var _ = __errgotrace.BuildVersion()\n"
+	}
+	return strings.Replace(setup, "/* END_ERRGOTRACE */", code+"/* END_ERRGOTRACE */", 1)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Without a value for the version the instrumented program takes it from its build info.
+func TestSetupCodeVersion(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"commit=3f2a1c"}, []string{`__errgotrace.Build("commit", "3f2a1c")`, "__errgotrace.BuildVersion()"}},
+		{[]string{"commit=3f2a1c", "version=v1.4.2"}, []string{`__errgotrace.Build("commit", "3f2a1c", "version", "v1.4.2")`}},
+		{[]string{"version"}, []string{"__errgotrace.BuildVersion()"}},
+		{[]string{"version=", "commit=3f2a1c"}, []string{`__errgotrace.Build("commit", "3f2a1c")`, "__errgotrace.BuildVersion()"}},
+	} {
+		old := metaFlag
+		metaFlag = metaFlags{}
+		for _, a := range test.args {
+			if err := metaFlag.Set(a); err != nil {
+				t.Fatal(err)
+			}
+		}
+		code := setupCode()
+		metaFlag = old
+
+		var got []string
+		for _, line := range strings.Split(code, "\n") {
+			if strings.HasPrefix(line, "var _ = ") && line != "var _ = __errgotrace.Setup()" {
+				got = append(got, strings.TrimPrefix(line, "var _ = "))
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%v: got\n%s\nexpected\n%s", test.args, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+
+	if err := (metaFlags{}).Set("commit"); err == nil {
+		t.Error("expected an error for a key without a value")
+	}
+}
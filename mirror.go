@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// module of the runtime imported by the instrumented code
+const runtimeModule = "github.com/gellweiler/errgotrace"
+
+var (
+	mirrorSrc     string
+	mirrorOut     string
+	mirrorModule  string
+	mirrorRuntime string
+)
+
+func registerMirrorFlags(fs *flag.FlagSet) {
+	fs.StringVar(&mirrorSrc, "src", "/src", "root directory of the module to mirror, it is never modified")
+	fs.StringVar(&mirrorOut, "out", "/out", "directory the instrumented copy is written to, must not exist or be empty")
+	fs.StringVar(&mirrorModule, "module", "", "rename the module of the copy, imports of its packages are rewritten")
+	fs.StringVar(&mirrorRuntime, "runtime", "", "directory of an errgotrace checkout to use with a replace directive, instead of fetching the runtime")
+}
+
+// Copy the tree below src to out, skipping version control directories and out itself.
+func copyTree(src, out string) error {
+	absOut, _ := filepath.Abs(out)
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if abs, _ := filepath.Abs(p); abs == absOut {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(out, rel)
+
+		switch {
+		case info.IsDir() && (info.Name() == ".git" || info.Name() == ".hg"):
+			return filepath.SkipDir
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		// the source may be mounted read-only, the copy has to be writable
+		return ioutil.WriteFile(target, data, info.Mode().Perm()|0200)
+	})
+}
+
+// Replace the import paths of packages of the module from with the module to.
+func rewriteImports(file string, from, to string) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("%s: failed to open (%s)", file, err)
+	}
+
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, file, src, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	var pos int
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || (p != from && !strings.HasPrefix(p, from+"/")) {
+			continue
+		}
+		start := fs.Position(imp.Path.Pos()).Offset
+		out = append(out, src[pos:start]...)
+		out = append(out, strconv.Quote(to+p[len(from):])...)
+		pos = fs.Position(imp.Path.End()).Offset
+	}
+	if out == nil {
+		return nil
+	}
+	out = append(out, src[pos:]...)
+
+	if err := ioutil.WriteFile(file, out, 0); err != nil {
+		return fmt.Errorf("%s: failed to write (%s)", file, err)
+	}
+	return nil
+}
+
+// Rename the module and point it to the runtime, returns the original module path.
+func rewriteGoMod(file string) (string, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to open (%s)", file, err)
+	}
+
+	m := moduleDirectiveRegex.FindSubmatchIndex(src)
+	if m == nil {
+		return "", fmt.Errorf("%s: no module directive", file)
+	}
+	module := string(src[m[2]:m[3]])
+
+	out := string(src)
+	if mirrorModule != "" {
+		out = out[:m[2]] + mirrorModule + out[m[3]:]
+	}
+
+	if mirrorRuntime != "" && module != runtimeModule {
+		runtime, err := filepath.Abs(mirrorRuntime)
+		if err != nil {
+			return "", err
+		}
+		out = strings.TrimRight(out, "\n") + fmt.Sprintf("\n\nrequire %s v0.0.0\n\nreplace %s => %s\n", runtimeModule, runtimeModule, runtime)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(out), 0644); err != nil {
+		return "", fmt.Errorf("%s: failed to write (%s)", file, err)
+	}
+	return module, nil
+}
+
+// Copy a module, instrument the copy and print the command building it.
+func runMirror(fs *flag.FlagSet) int {
+	if _, err := os.Stat(filepath.Join(mirrorSrc, "go.mod")); err != nil {
+		log.Printf("%s: not the root of a module (%s)", mirrorSrc, err)
+		return 1
+	}
+
+	if entries, err := ioutil.ReadDir(mirrorOut); err == nil && len(entries) > 0 {
+		log.Printf("%s: not empty, refusing to overwrite it", mirrorOut)
+		return 1
+	}
+
+	if err := copyTree(mirrorSrc, mirrorOut); err != nil {
+		log.Printf("%s: failed to copy (%s)", mirrorSrc, err)
+		return 1
+	}
+
+	module, err := rewriteGoMod(filepath.Join(mirrorOut, "go.mod"))
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	files, err := expandGlob(filepath.Join(mirrorOut, "**", "*.go"))
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	var sources []string
+	for _, file := range files {
+		rel, _ := filepath.Rel(mirrorOut, file)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if inDir(parts, "vendor") || inDir(parts, "testdata") {
+			continue
+		}
+		if mirrorModule != "" {
+			if err := rewriteImports(file, module, mirrorModule); err != nil {
+				log.Print(err)
+				return 1
+			}
+		}
+		sources = append(sources, file)
+	}
+
+	reverseProcess = false
+	writeFiles = true
+	filesFlag = ""
+	if status := processFiles(fs, sources); status != 0 {
+		return status
+	}
+
+	fetch := ""
+	if mirrorRuntime == "" {
+		fetch = "go get " + runtimeModule + "/log && "
+	}
+	fmt.Printf("cd %s && %sgo build ./...\n", mirrorOut, fetch)
+	return 0
+}
+
+// Check if any directory of a slash separated path has the given name.
+func inDir(parts []string, name string) bool {
+	for _, p := range parts[:len(parts)-1] {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
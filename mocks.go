@@ -0,0 +1,42 @@
+package main
+
+import (
+	"go/ast"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	// mocks/, fakes/, the xxxfakes/ packages of counterfeiter, *_mock.go and mock_*.go files
+	mockFileRegex = regexp.MustCompile(`(^|/)(mocks?|fakes?|[a-z0-9_]+fakes)/|_(mocks?|fakes?)\.go$|(^|/)mock_[^/]*\.go$`)
+
+	// the headers of gomock, mockery and counterfeiter
+	mockHeaderRegex = regexp.MustCompile(`^// Code generated by (MockGen|mockery|counterfeiter)`)
+
+	// the types generated by them, e.g. MockStore or FakeStore
+	mockTypeRegex = regexp.MustCompile(`^\*?(Mock|Fake)[A-Z]`)
+)
+
+// Check if a file holds test doubles, by its path or the header of the generator.
+func mockFile(filename string, f *ast.File) bool {
+	if mockFileRegex.MatchString(filepath.ToSlash(filename)) {
+		return true
+	}
+
+	for _, g := range f.Comments {
+		if g.Pos() > f.Package {
+			break
+		}
+		for _, c := range g.List {
+			if mockHeaderRegex.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check if methods of the receiver type belong to a test double.
+func mockReceiver(receiver string) bool {
+	return mockTypeRegex.MatchString(receiver)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// number of unchanged lines shown around every change
+const patchContext = 3
+
+// patchSet collects the changes of all processed files into one unified patch.
+type patchSet struct {
+	buf bytes.Buffer
+}
+
+// Add the difference between the original and the new contents of a file.
+func (p *patchSet) add(file string, orig, src []byte) {
+	name := filepath.ToSlash(filepath.Clean(file))
+	name = strings.TrimPrefix(name, "/")
+
+	a, b := splitLines(orig), splitLines(src)
+	d := differ{a: a, b: b, delA: make([]bool, len(a)), insB: make([]bool, len(b))}
+	d.compare(0, len(a), 0, len(b))
+
+	hunks := d.hunks()
+	if len(hunks) < 1 {
+		return
+	}
+
+	fmt.Fprintf(&p.buf, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", name, name, name, name)
+	for _, h := range hunks {
+		p.buf.WriteString(h)
+	}
+}
+
+func (p *patchSet) write(file string) error {
+	if err := ioutil.WriteFile(file, p.buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("%s: failed to write (%s)", file, err)
+	}
+
+	return nil
+}
+
+// Split data into lines, every line keeps its line break.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			i = len(data) - 1
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// differ computes a line based diff using the linear space variant of Myers' algorithm,
+// lines only present in a are marked in delA, lines only present in b in insB.
+type differ struct {
+	a, b []string
+	delA []bool
+	insB []bool
+}
+
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	// Skip the common prefix and suffix
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	if aLo == aHi || bLo == bHi {
+		for i := aLo; i < aHi; i++ {
+			d.delA[i] = true
+		}
+		for i := bLo; i < bHi; i++ {
+			d.insB[i] = true
+		}
+		return
+	}
+
+	x, y, ok := d.bisect(aLo, aHi, bLo, bHi)
+	if !ok {
+		d.compare(aLo, aHi, bLo, bLo)
+		d.compare(aHi, aHi, bLo, bHi)
+		return
+	}
+
+	d.compare(aLo, x, bLo, y)
+	d.compare(x, aHi, y, bHi)
+}
+
+// Find the middle snake of the shortest edit script, returns the point where to split.
+func (d *differ) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	off := maxD + 1
+	vf := make([]int, 2*off+2)
+	vb := make([]int, 2*off+2)
+	for i := range vf {
+		vf[i] = -1
+		vb[i] = -1
+	}
+	vf[off+1] = 0
+	vb[off+1] = 0
+
+	delta := n - m
+	odd := delta%2 != 0
+	var fStart, fEnd, bStart, bEnd int
+
+	for e := 0; e < maxD; e++ {
+		// walk forward from the top left
+		for k := -e + fStart; k <= e-fEnd; k += 2 {
+			var x int
+			if k == -e || (k != e && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+
+			if x > n {
+				fEnd += 2
+			} else if y > m {
+				fStart += 2
+			} else if odd {
+				kb := off + delta - k
+				if kb >= 0 && kb < len(vb) && vb[kb] != -1 && x >= n-vb[kb] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		// walk backward from the bottom right
+		for k := -e + bStart; k <= e-bEnd; k += 2 {
+			var x int
+			if k == -e || (k != e && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+
+			if x > n {
+				bEnd += 2
+			} else if y > m {
+				bStart += 2
+			} else if !odd {
+				kf := off + delta - k
+				if kf >= 0 && kf < len(vf) && vf[kf] != -1 {
+					fx := vf[kf]
+					fy := fx - (kf - off)
+					if fx >= n-x {
+						return aLo + fx, bLo + fy, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// Turn the marked lines into unified diff hunks.
+func (d *differ) hunks() []string {
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(d.a) || j < len(d.b) {
+		switch {
+		case i < len(d.a) && d.delA[i]:
+			lines = append(lines, diffLine{'-', d.a[i]})
+			i++
+		case j < len(d.b) && d.insB[j]:
+			lines = append(lines, diffLine{'+', d.b[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{' ', d.a[i]})
+			i++
+			j++
+		}
+	}
+
+	var hunks []string
+	for start := 0; start < len(lines); {
+		// find the next change
+		for start < len(lines) && lines[start].kind == ' ' {
+			start++
+		}
+		if start == len(lines) {
+			break
+		}
+
+		// extend the hunk as long as changes are close to each other
+		end := start
+		for k := start; k < len(lines); k++ {
+			if lines[k].kind != ' ' {
+				end = k + 1
+			} else if k-end >= 2*patchContext {
+				break
+			}
+		}
+
+		lo := start - patchContext
+		if lo < 0 {
+			lo = 0
+		}
+		hi := end + patchContext
+		if hi > len(lines) {
+			hi = len(lines)
+		}
+
+		hunks = append(hunks, formatHunk(lines, lo, hi))
+		start = hi
+	}
+
+	return hunks
+}
+
+func formatHunk(lines []diffLine, lo, hi int) string {
+	// line numbers of the hunk start in the old and new file
+	aStart, bStart := 1, 1
+	for _, l := range lines[:lo] {
+		if l.kind != '+' {
+			aStart++
+		}
+		if l.kind != '-' {
+			bStart++
+		}
+	}
+
+	var body strings.Builder
+	aLen, bLen := 0, 0
+	for _, l := range lines[lo:hi] {
+		if l.kind != '+' {
+			aLen++
+		}
+		if l.kind != '-' {
+			bLen++
+		}
+
+		body.WriteByte(l.kind)
+		body.WriteString(l.text)
+		if !strings.HasSuffix(l.text, "\n") {
+			body.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	// empty ranges are addressed by the line before them
+	if aLen == 0 {
+		aStart--
+	}
+	if bLen == 0 {
+		bStart--
+	}
+
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@\n%s", aStart, aLen, bStart, bLen, body.String())
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// -policy are the protected branches, -force adds tracing code on them anyway
+	policyFlag string
+	forceFlag  bool
+)
+
+// Get the git branch checked out in the directory, empty if it isn't in a repository or HEAD is detached.
+func gitBranch(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "symbolic-ref", "--short", "-q", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Check if a branch matches one of the comma separated patterns of -policy, e.g. main,release/*.
+func protectedBranch(branch, patterns string) bool {
+	for _, p := range strings.Split(patterns, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if ok, _ := path.Match(p, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Refuse to write tracing code into files checked out on a protected branch, unless -force is given.
+// Every repository the files are in is checked once.
+func checkPolicy(files []string) error {
+	if policyFlag == "" || forceFlag {
+		return nil
+	}
+
+	checked := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if checked[dir] {
+			continue
+		}
+		checked[dir] = true
+
+		if branch := gitBranch(dir); branch != "" && protectedBranch(branch, policyFlag) {
+			return fmt.Errorf("%s: refusing to add tracing code on the protected branch %s, use -force to add it anyway", file, branch)
+		}
+	}
+	return nil
+}
+
+// The protected branches of a team can be set once in the environment
+func defaultPolicy() string {
+	return os.Getenv("ERRGOTRACE_POLICY")
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// method is a method declared in the package, as found by scanning the sources of its directory
+type method struct {
+	name    string
+	pointer bool
+	params  *ast.FieldList
+	results *ast.FieldList
+	src     []byte
+}
+
+// Collect the methods of the package by the name of their receiver type. The file being processed
+// is given by its syntax tree, the other files of its directory are parsed.
+func packageMethods(filename string, f *ast.File, src []byte) map[string][]*method {
+	methods := make(map[string][]*method)
+	add := func(file *ast.File, src []byte) {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) < 1 || strings.HasPrefix(fn.Name.Name, "__") {
+				continue
+			}
+			t, pointer := fn.Recv.List[0].Type, false
+			if star, ok := t.(*ast.StarExpr); ok {
+				t, pointer = star.X, true
+			}
+			if id, ok := t.(*ast.Ident); ok {
+				methods[id.Name] = append(methods[id.Name], &method{fn.Name.Name, pointer, fn.Type.Params, fn.Type.Results, src})
+			}
+		}
+	}
+	add(f, src)
+
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(filename), "*.go"))
+	for _, file := range files {
+		if filepath.Base(file) == filepath.Base(filename) || strings.HasSuffix(file, "_test.go") != strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		other, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		parsed, err := parser.ParseFile(token.NewFileSet(), file, other, 0)
+		if err != nil || parsed.Name.Name != f.Name.Name {
+			continue
+		}
+		add(parsed, other)
+	}
+	return methods
+}
+
+// Check if the types of a signature can be written in the file, i.e. all packages they refer to are imported.
+func resolvable(fields *ast.FieldList, imports map[string]bool) bool {
+	ok := true
+	if fields == nil {
+		return ok
+	}
+	ast.Inspect(fields, func(n ast.Node) bool {
+		if sel, isSel := n.(*ast.SelectorExpr); isSel {
+			if id, isIdent := sel.X.(*ast.Ident); !isIdent || !imports[id.Name] {
+				ok = false
+			}
+			return false
+		}
+		return true
+	})
+	return ok
+}
+
+// Names the packages imported by a file are known by
+func importNames(f *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, imp := range f.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		name := p[strings.LastIndex(p, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// Write the declaration of a method of the outer type, calling the method promoted through the embedded field.
+func promotionMethod(field, receiver string, m *method) string {
+	text := func(e ast.Expr) string {
+		return string(m.src[e.Pos()-1 : e.End()-1])
+	}
+
+	var params, args []string
+	i := 0
+	for _, p := range m.params.List {
+		t := text(p.Type)
+		for j := 0; j == 0 || j < len(p.Names); j++ {
+			name := "__p" + strconv.Itoa(i)
+			if j < len(p.Names) && p.Names[j].Name != "_" {
+				name = p.Names[j].Name
+			}
+			i++
+
+			params = append(params, name+" "+t)
+			if strings.HasPrefix(t, "...") {
+				name += "..."
+			}
+			args = append(args, name)
+		}
+	}
+
+	results := string(m.src[m.results.Pos()-1 : m.results.End()-1])
+	return "func (__recv " + receiver + ") " + m.name + "(" + strings.Join(params, ", ") + ") " + results + " {\n" +
+		"\treturn __recv." + field + "." + m.name + "(" + strings.Join(args, ", ") + ")\n}\n"
+}
+
+// Add methods to a struct for the methods it promotes from types of the package embedded in it,
+// so errors are logged with the struct that was called. Methods promoted by several fields are
+// ambiguous and not promoted at all, like methods the struct declares itself.
+func (e *editList) tracePromoted(decl *ast.GenDecl) {
+	if decl.Tok != token.TYPE {
+		return
+	}
+
+	if e.methods == nil {
+		e.methods = packageMethods(e.filename, e.file, e.orig)
+	}
+	imports := importNames(e.file)
+
+	var shims bytes.Buffer
+	for _, spec := range decl.Specs {
+		ts := spec.(*ast.TypeSpec)
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok || ts.TypeParams != nil {
+			continue
+		}
+
+		// the names that already exist at depth 0 and the methods of every embedded field
+		taken := make(map[string]bool)
+		for _, m := range e.methods[ts.Name.Name] {
+			taken[m.name] = true
+		}
+		promoted := make(map[string]int)
+		type embedding struct {
+			field   string
+			pointer bool
+			methods []*method
+		}
+		var embedded []embedding
+		for _, field := range st.Fields.List {
+			for _, n := range field.Names {
+				taken[n.Name] = true
+			}
+			if len(field.Names) > 0 {
+				continue
+			}
+
+			t, pointer := field.Type, false
+			if star, ok := t.(*ast.StarExpr); ok {
+				t, pointer = star.X, true
+			}
+			id, ok := t.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			taken[id.Name] = true
+			embedded = append(embedded, embedding{id.Name, pointer, e.methods[id.Name]})
+			for _, m := range e.methods[id.Name] {
+				promoted[m.name]++
+			}
+		}
+
+		for _, emb := range embedded {
+			for _, m := range emb.methods {
+				if taken[m.name] || promoted[m.name] > 1 || m.results == nil || len(m.results.List) < 1 {
+					continue
+				}
+				if !resolvable(m.params, imports) || !resolvable(m.results, imports) {
+					continue
+				}
+
+				// value receivers keep the method in the method set of the struct value
+				receiver := ts.Name.Name
+				if m.pointer && !emb.pointer {
+					receiver = "*" + receiver
+				}
+
+				code, ok := e.promotionCode(promotionMethod(emb.field, receiver, m))
+				if !ok {
+					continue
+				}
+				if shims.Len() > 0 {
+					shims.WriteString("\n")
+				}
+				shims.WriteString(code)
+			}
+		}
+	}
+
+	if shims.Len() > 0 {
+		e.Add(int(decl.End())-1, []byte("\n\n/* BEGIN_ERRGOTRACE */\n"+shims.String()+"/* END_ERRGOTRACE */"))
+	}
+}
+
+// Instrument a generated promotion method like any other method. The markers of the generated code
+// are dropped, the whole method is enclosed in a single block.
+func (e *editList) promotionCode(src string) (string, bool) {
+	file := "package " + e.packageName + "\n\n" + src
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, e.filename, file, parser.ParseComments)
+	if err != nil {
+		return "", false
+	}
+	fn := f.Decls[0].(*ast.FuncDecl)
+
+	// describe and the code generation work on the positions of the global file set
+	saved := fset
+	fset = fs
+	defer func() { fset = saved }()
+
+	sub := &editList{filename: e.filename, packageName: e.packageName, qualified: e.qualified, orig: []byte(file), stats: &fileStats{}}
+	c := sub.describe(fn)
+	opts := flagOptions()
+	selected, err := selectFunction(c, &opts)
+	if err != nil {
+		e.fail(err)
+		return "", false
+	}
+	if !selected {
+		e.stats.Skipped = append(e.stats.Skipped, c.Name)
+		return "", false
+	}
+
+	injection, err := generateDebugCode(sub.outputName(c.Name), fn, sub.orig, opts, nil)
+	if err != nil {
+		e.fail(err)
+		return "", false
+	}
+
+	lbrace := int(fn.Body.Lbrace)
+	code := file[fn.Pos()-1:lbrace] + string(injection) + file[lbrace:]
+	var out []string
+	marker := false
+	for _, line := range strings.Split(code, "\n") {
+		if beginRegex.MatchString(line) || endRegex.MatchString(line) {
+			marker = true
+			continue
+		}
+		if marker && strings.TrimSpace(line) == "" {
+			continue
+		}
+		marker = false
+		out = append(out, line)
+	}
+
+	e.stats.Instrumented = append(e.stats.Instrumented, c.Name)
+	return strings.Join(out, "\n"), true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// The marker the runtime embeds in binaries built from instrumented sources. It's assembled at runtime, so
+// errgotrace itself doesn't contain it.
+var provenanceMarker = []byte(strings.Join([]string{"errgotrace-provenance", "built from instrumented sources"}, ": "))
+
+// Check if a binary contains the marker, reading it in chunks that overlap by the length of the marker.
+func instrumentedBinary(r io.Reader) (bool, error) {
+	buf := make([]byte, 0, 1<<20+len(provenanceMarker))
+	chunk := make([]byte, 1<<20)
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if bytes.Contains(buf, provenanceMarker) {
+			return true, nil
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if keep := len(provenanceMarker) - 1; len(buf) > keep {
+			buf = append(buf[:0], buf[len(buf)-keep:]...)
+		}
+	}
+}
+
+func runProvenance(fs *flag.FlagSet) int {
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var failure bool
+	for _, file := range fs.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("%s: failed to open (%s)", file, err)
+			failure = true
+			continue
+		}
+
+		instrumented, err := instrumentedBinary(f)
+		f.Close()
+		if err != nil {
+			log.Printf("%s: failed to read (%s)", file, err)
+			failure = true
+			continue
+		}
+		if instrumented {
+			fmt.Println(file)
+			failure = true
+		}
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"go/ast"
+	"path/filepath"
+	"strings"
+)
+
+var publicAPI bool
+
+// Check if a function is part of the API a module offers to others, for -public-api: exported functions and
+// the exported methods of exported types, outside of main packages, tests and internal packages. Vendored
+// packages belong to other modules.
+func publicFunction(c *candidate) bool {
+	if !c.Exported || c.Package == "main" || strings.HasSuffix(c.File, "_test.go") {
+		return false
+	}
+	if c.Receiver != "" && !ast.IsExported(receiverTypeName(c.Receiver)) {
+		return false
+	}
+
+	// outside of modules and GOPATH only the directories are known
+	p := qualifiedPackage(c.File, c.Package)
+	if p == c.Package {
+		p = filepath.ToSlash(filepath.Dir(c.File))
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if elem == "internal" || elem == "vendor" {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the name of the type of a receiver, e.g. T for *T[K].
+func receiverTypeName(receiver string) string {
+	name := strings.TrimLeft(strings.Trim(receiver, "()"), "*")
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSpace(name)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	errgolog "github.com/gellweiler/errgotrace/log"
+	"github.com/gellweiler/errgotrace/log/schema"
+)
+
+// -sink of replay, the names of built-in sinks separated by commas
+var replaySinks string
+
+func registerReplayFlags(fs *flag.FlagSet) {
+	fs.StringVar(&replaySinks, "sink", "", "built-in sinks to replay to, separated by commas, e.g. statsd,otlp, configured by the ERRGOTRACE_* variables (default log)")
+}
+
+func runReplay(fs *flag.FlagSet) int {
+	if replaySinks != "" {
+		var sinks []errgolog.Sink
+		for _, name := range strings.Split(replaySinks, ",") {
+			s, err := errgolog.NamedSink(strings.TrimSpace(name))
+			if err != nil {
+				log.Print(err)
+				return 2
+			}
+			sinks = append(sinks, s)
+		}
+		errgolog.SetSinks(sinks...)
+	}
+	defer errgolog.Flush()
+
+	replay := func(name string, r io.Reader) bool {
+		d := schema.NewDecoder(r)
+		for {
+			e, err := d.Decode()
+			if err == io.EOF {
+				return true
+			}
+			if err != nil {
+				log.Printf("%s: failed to read (%s)", name, err)
+				return false
+			}
+			errgolog.Replay(e)
+		}
+	}
+
+	if fs.NArg() < 1 {
+		if !replay("stdin", os.Stdin) {
+			return 1
+		}
+		return 0
+	}
+
+	var failure bool
+	for _, file := range fs.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("%s: failed to open (%s)", file, err)
+			failure = true
+			continue
+		}
+		if !replay(file, f) {
+			failure = true
+		}
+		f.Close()
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statistics of a single processed file
+type fileStats struct {
+	File         string   `json:"file"`
+	Instrumented []string `json:"instrumented,omitempty"`
+	Skipped      []string `json:"skipped,omitempty"`
+	BytesAdded   int      `json:"bytes_added"`
+	Error        string   `json:"error,omitempty"`
+
+	// the instrumented functions, for -list
+	candidates []*candidate
+}
+
+// Print the functions of a file for -list.
+func listFunctions(list []*candidate) error {
+	for _, c := range list {
+		if !listJSON {
+			fmt.Printf("%s:%d: %s %s\n", c.File, c.Line, c.Name, c.Signature)
+			continue
+		}
+
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
+
+// summary of a whole run, written with -report
+type runReport struct {
+	Files        int          `json:"files"`
+	Failed       int          `json:"failed"`
+	Instrumented int          `json:"instrumented"`
+	Skipped      int          `json:"skipped"`
+	BytesAdded   int          `json:"bytes_added"`
+	Elapsed      float64      `json:"elapsed_seconds"`
+	FileStats    []*fileStats `json:"file_stats"`
+
+	start time.Time
+}
+
+func newRunReport() *runReport {
+	return &runReport{start: time.Now()}
+}
+
+// Add the result of processing a file to the report
+func (r *runReport) add(file string, st *fileStats, err error) {
+	if st == nil {
+		st = &fileStats{File: file}
+	}
+
+	r.Files++
+	if err != nil {
+		r.Failed++
+		st.Error = err.Error()
+	}
+	r.Instrumented += len(st.Instrumented)
+	r.Skipped += len(st.Skipped)
+	r.BytesAdded += st.BytesAdded
+	r.Elapsed = time.Since(r.start).Seconds()
+	r.FileStats = append(r.FileStats, st)
+}
+
+// Mark a processed file as failed after its changes were undone
+func (r *runReport) rollback(file string, reason string) {
+	for _, st := range r.FileStats {
+		if st.File != file || st.Error != "" {
+			continue
+		}
+		r.Failed++
+		r.Instrumented -= len(st.Instrumented)
+		r.BytesAdded -= st.BytesAdded
+		st.Instrumented, st.BytesAdded = nil, 0
+		st.Error = "restored: " + reason
+	}
+}
+
+// Human readable one line summary of the run
+func (r *runReport) summary() string {
+	return fmt.Sprintf("%d files processed (%d failed), %d functions instrumented, %d skipped, %d bytes added in %s",
+		r.Files, r.Failed, r.Instrumented, r.Skipped, r.BytesAdded,
+		time.Duration(r.Elapsed*float64(time.Second)).Round(time.Millisecond))
+}
+
+// Write the report as JSON
+func (r *runReport) write(file string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%s: failed to encode report (%s)", file, err)
+	}
+
+	err = ioutil.WriteFile(file, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("%s: failed to write (%s)", file, err)
+	}
+
+	return nil
+}
+
+// progress prints a single, constantly overwritten status line to stderr
+type progress struct {
+	total int
+	width int
+}
+
+func (p *progress) update(n int, file string) {
+	line := fmt.Sprintf("[%d/%d] %s", n, p.total, file)
+	pad := p.width - len(line)
+	if pad < 0 {
+		pad = 0
+	}
+	p.width = len(line)
+	fmt.Fprint(os.Stderr, "\r"+line+strings.Repeat(" ", pad))
+}
+
+func (p *progress) done() {
+	fmt.Fprint(os.Stderr, "\r"+strings.Repeat(" ", p.width)+"\r")
+}
+
+var reportJSON bool
+
+// functions whose instrumentation differs between two reports
+type reportDiff struct {
+	Gained []string `json:"gained"`
+	Lost   []string `json:"lost"`
+}
+
+func readReport(file string) (*runReport, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to open (%s)", file, err)
+	}
+
+	var r runReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: invalid report (%s)", file, err)
+	}
+	return &r, nil
+}
+
+// The instrumented functions of a report, as file: name
+func (r *runReport) functions() map[string]bool {
+	funcs := make(map[string]bool)
+	for _, st := range r.FileStats {
+		for _, name := range st.Instrumented {
+			funcs[st.File+": "+name] = true
+		}
+	}
+	return funcs
+}
+
+func diffReports(before, after *runReport) *reportDiff {
+	d := &reportDiff{Gained: []string{}, Lost: []string{}}
+	old, cur := before.functions(), after.functions()
+	for f := range cur {
+		if !old[f] {
+			d.Gained = append(d.Gained, f)
+		}
+	}
+	for f := range old {
+		if !cur[f] {
+			d.Lost = append(d.Lost, f)
+		}
+	}
+	sort.Strings(d.Gained)
+	sort.Strings(d.Lost)
+	return d
+}
+
+func runReportCmd(fs *flag.FlagSet) int {
+	if fs.Arg(0) != "diff" {
+		fs.Usage()
+		return 2
+	}
+
+	// the flags of diff follow the subcommand
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	before, err := readReport(fs.Arg(0))
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	after, err := readReport(fs.Arg(1))
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	d := diffReports(before, after)
+	if reportJSON {
+		data, _ := json.MarshalIndent(d, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+
+	for _, f := range d.Gained {
+		fmt.Println("+ " + f)
+	}
+	for _, f := range d.Lost {
+		fmt.Println("- " + f)
+	}
+	fmt.Printf("%d functions gained instrumentation, %d lost it\n", len(d.Gained), len(d.Lost))
+	return 0
+}
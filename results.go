@@ -0,0 +1,73 @@
+package main
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// Get the names of the results to inspect in defer mode, the deferred call needs their addresses.
+// Unnamed and blank results are named __err0, __result1, ... by replacing the result list, the
+// original list is kept in a comment for the removal. ok is false if the results can't be named,
+// because a generated name is already used in the function or the list spans several lines.
+func (e *editList) nameResults(f *ast.FuncDecl) (names []string, ok bool) {
+	results := f.Type.Results
+	used := identNames(f)
+
+	var list []string
+	renamed := false
+	i := 0
+	names = []string{}
+	for _, field := range results.List {
+		t := string(e.orig[field.Type.Pos()-1 : field.Type.End()-1])
+		kind := errorKind(field.Type)
+		for j := 0; j == 0 || j < len(field.Names); j++ {
+			name := "_"
+			if j < len(field.Names) {
+				name = field.Names[j].Name
+			}
+			if name == "_" {
+				name = "__result" + strconv.Itoa(i)
+				if kind == isError {
+					name = "__err" + strconv.Itoa(i)
+				}
+				if used[name] {
+					return nil, false
+				}
+				renamed = true
+			}
+
+			list = append(list, name+" "+t)
+			if kind != notError {
+				names = append(names, name)
+			}
+			i++
+		}
+	}
+
+	// without results to inspect the signature stays as it is
+	if !renamed || len(names) < 1 {
+		return names, true
+	}
+
+	orig := string(e.orig[results.Pos()-1 : results.End()-1])
+	if strings.Contains(orig, "\n") || strings.Contains(orig, "*/") {
+		return nil, false
+	}
+
+	e.Add(int(results.Pos())-1, []byte("/* ERRGOTRACE_ORIGINAL "))
+	e.Add(int(results.End())-1, []byte(" */ "+inlineCode("("+strings.Join(list, ", ")+")")))
+	return names, true
+}
+
+// Collect all identifiers used in a function, including its parameters and results.
+func identNames(f *ast.FuncDecl) map[string]bool {
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+	return used
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Sources the fuzzer starts from, besides the files of the round trip corpus
+var roundTripSeeds = []string{
+	"package p\n\nimport \"errors\"\n\nfunc F() error { return errors.New(\"failed\") }\n",
+	"package p\n\nfunc F() (n int, err error) {\n\tdefer func() { err = nil }()\n\treturn 0, nil\n}\n",
+	"package p\n\ntype T struct{}\n\nfunc (t *T) M(a, b int) (int, error) { return a + b, nil }\n",
+	"package p\n\ntype L[K comparable, V any] map[K]V\n\nfunc (L[K, V]) Get(k K) (V, error) { var v V; return v, nil }\n",
+	"package p\n\nfunc F() func() error {\n\treturn func() error { return nil }\n}\n",
+	"package p\n\nimport \"errors\"\n\nfunc F() error { return errors.New(\"*/ \\\"\") } // one line\n\nfunc G() {}\n",
+}
+
+// Get the packages of the round trip corpus: every file of testdata/roundtrip is a package of its own, the
+// real packages of testdata/roundtrip/packages are directories.
+func roundTripCorpus(t testing.TB) map[string][]string {
+	corpus := make(map[string][]string)
+	files, _ := filepath.Glob(filepath.Join("testdata", "roundtrip", "*.go"))
+	for _, file := range files {
+		corpus[filepath.Base(file)] = []string{file}
+	}
+	files, _ = filepath.Glob(filepath.Join("testdata", "roundtrip", "packages", "*", "*.go"))
+	for _, file := range files {
+		name := filepath.Base(filepath.Dir(file))
+		corpus[name] = append(corpus[name], file)
+	}
+	if len(corpus) == 0 {
+		t.Fatal("no files in the round trip corpus")
+	}
+	return corpus
+}
+
+// Add the seeds and the files of the corpus to the fuzzer.
+func addRoundTripSeeds(f *testing.F) {
+	for _, src := range roundTripSeeds {
+		f.Add([]byte(src))
+	}
+	for _, files := range roundTripCorpus(f) {
+		for _, file := range files {
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(src)
+		}
+	}
+}
+
+// the imports of the type-checked sources, the runtime included, are checked once
+var fuzzImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// Type-check the files of a package, the file set has to hold them.
+func checkTypes(fset *token.FileSet, files ...*ast.File) error {
+	conf := types.Config{Importer: fuzzImporter}
+	_, err := conf.Check(files[0].Name.Name, fset, files, nil)
+	return err
+}
+
+// Adding the tracing code to a file that type-checks gives a file that type-checks, and removing it gives
+// back the file as formatted by gofmt.
+func FuzzRoundTrip(f *testing.F) {
+	addRoundTripSeeds(f)
+	f.Fuzz(func(t *testing.T, src []byte) {
+		annotateOptions(t)
+		fset := token.NewFileSet()
+		orig, err := parser.ParseFile(fset, "fuzz.go", src, parser.ParseComments)
+		if err != nil || containsTracing(src) {
+			return
+		}
+		checked := checkTypes(fset, orig) == nil
+
+		out, _, err := annotate("fuzz.go", src)
+		if err != nil {
+			t.Fatalf("%s\n%s", err, src)
+		}
+		fset = token.NewFileSet()
+		traced, err := parser.ParseFile(fset, "fuzz.go", out, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("result doesn't parse (%s)\n%s", err, out)
+		}
+		if checked {
+			if err := checkTypes(fset, traced); err != nil {
+				t.Fatalf("result doesn't type-check (%s)\n%s", err, out)
+			}
+		}
+
+		if err := roundTrip("fuzz.go", src, out); err != nil {
+			t.Fatalf("%s\n%s", err, out)
+		}
+	})
+}
+
+// The options the corpus is instrumented with
+var roundTripFlags = [][]string{
+	nil,
+	{"-mode", "defer"},
+	{"-args", "-timing", "-receiver"},
+	{"-closures", "-goroutines"},
+}
+
+func flagsName(flags []string) string {
+	if len(flags) == 0 {
+		return "default"
+	}
+	return strings.Join(flags, " ")
+}
+
+// Every package of the corpus type-checks once instrumented, and removing the tracing code gives back its
+// files as formatted by gofmt.
+func TestRoundTripCorpus(t *testing.T) {
+	corpus := roundTripCorpus(t)
+	for _, flags := range roundTripFlags {
+		for name, files := range corpus {
+			t.Run(flagsName(flags)+"/"+name, func(t *testing.T) {
+				annotateOptions(t, flags...)
+				fset := token.NewFileSet()
+				var parsed []*ast.File
+				traced := false
+				for _, file := range files {
+					src, err := ioutil.ReadFile(file)
+					if err != nil {
+						t.Fatal(err)
+					}
+					out, _, err := annotate(file, src)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := roundTrip(file, src, out); err != nil {
+						t.Errorf("%s\n%s", err, out)
+					}
+					f, err := parser.ParseFile(fset, file, out, parser.ParseComments)
+					if err != nil {
+						t.Fatalf("result doesn't parse (%s)\n%s", err, out)
+					}
+					parsed = append(parsed, f)
+					traced = traced || containsTracing(out)
+				}
+				if !traced {
+					t.Fatal("no tracing code was added")
+				}
+				if err := checkTypes(fset, parsed...); err != nil {
+					t.Fatalf("result doesn't type-check (%s)", err)
+				}
+			})
+		}
+	}
+}
+
+// The command of the corpus logs the errors of its functions once instrumented, and still behaves the same.
+func TestRoundTripRun(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	// the program is built in GOPATH mode, next to the runtime it imports
+	env := append(os.Environ(), "GO111MODULE=off", "GOFLAGS=")
+	list := exec.Command("go", "list", runtimeImportPath)
+	list.Env = env
+	if out, err := list.CombinedOutput(); err != nil {
+		t.Skipf("the runtime isn't in GOPATH (%s)", strings.TrimSpace(string(out)))
+	}
+
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "roundtrip", "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(src []byte) (stdout, stderr string) {
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+		var o, e strings.Builder
+		cmd := exec.Command("go", "run", "main.go")
+		cmd.Dir, cmd.Env, cmd.Stdout, cmd.Stderr = dir, env, &o, &e
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("%s\n%s", err, e.String())
+		}
+		return o.String(), e.String()
+	}
+	want, _ := run(src)
+
+	for _, flags := range roundTripFlags {
+		t.Run(flagsName(flags), func(t *testing.T) {
+			annotateOptions(t, flags...)
+			out, _, err := annotate("main.go", src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdout, stderr := run(out)
+			if stdout != want {
+				t.Errorf("instrumented program printed %q, expected %q", stdout, want)
+			}
+			for _, f := range []string{"main.parse", "main.sum", "main.check", "cannot parse \"three\"", "too large"} {
+				if !strings.Contains(stderr, f) {
+					t.Errorf("expected %s in the events\n%s", f, stderr)
+				}
+			}
+			if err := roundTrip("main.go", src, out); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Check that removing the tracing code from out gives back the source src as formatted by gofmt, byte for
+// byte, apart from the header, which annotate keeps as it was.
+func roundTrip(file string, src, out []byte) error {
+	reversed, err := reverse(out)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+
+	formatted, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	formatted = keepHeader(src, formatted)
+	if reversed == string(formatted) {
+		return nil
+	}
+	a, b := splitLines(formatted), splitLines([]byte(reversed))
+	for i := 0; ; i++ {
+		switch {
+		case i >= len(a):
+			return fmt.Errorf("%s: removal left line %d: %q", file, i+1, b[i])
+		case i >= len(b):
+			return fmt.Errorf("%s: removal dropped line %d: %q", file, i+1, a[i])
+		case a[i] != b[i]:
+			return fmt.Errorf("%s: removal changed line %d from %q to %q", file, i+1, a[i], b[i])
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gellweiler/errgotrace/internal/yaml"
+)
+
+// candidate describes a function that could get instrumented
+type candidate struct {
+	Name         string   `json:"name"`
+	Package      string   `json:"package"`
+	Path         string   `json:"path,omitempty"`
+	Receiver     string   `json:"receiver,omitempty"`
+	Func         string   `json:"func"`
+	File         string   `json:"file"`
+	Line         int      `json:"line"`
+	Lines        int      `json:"lines"`
+	Branches     int      `json:"branches"`
+	Signature    string   `json:"signature"`
+	ParamTypes   []string `json:"param_types"`
+	ResultTypes  []string `json:"result_types"`
+	Results      int      `json:"results"`
+	ReturnsError bool     `json:"returns_error"`
+	Exported     bool     `json:"exported"`
+	Handler      bool     `json:"http_handler"`
+	Mock         bool     `json:"mock"`
+}
+
+// options for the code generated for a single function
+type funcOptions struct {
+	Timing bool     `json:"timing,omitempty"`
+	Args   bool     `json:"args,omitempty"`
+	Stack  bool     `json:"stack,omitempty"`
+	Redact []string `json:"redact,omitempty"`
+
+	// Receiver logs the receiver of methods, limited to Fields if given
+	Receiver bool     `json:"receiver,omitempty"`
+	Fields   []string `json:"fields,omitempty"`
+
+	// Context passes the context.Context parameter to the runtime, see log.WithTracing
+	Context bool `json:"context,omitempty"`
+
+	// HTTP logs the request of HTTP handlers and their panics, also for handlers without results
+	HTTP bool `json:"http,omitempty"`
+
+	// Calls logs entering and leaving the function, also for functions without results
+	Calls bool `json:"calls,omitempty"`
+
+	// Depth tracks the calls of the function without logging them, errors are logged with their caller
+	Depth bool `json:"depth,omitempty"`
+
+	// Closures wraps returned functions with an error result, their errors are logged as Func.funcN
+	Closures bool `json:"closures,omitempty"`
+
+	// Snippets are the names of the snippets of the rules file attached to the function
+	Snippets []string `json:"snippets,omitempty"`
+}
+
+// Set an option by name, used by rules and directives.
+func (o *funcOptions) set(name string, value bool) error {
+	switch name {
+	case "timing":
+		o.Timing = value
+	case "args":
+		o.Args = value
+	case "stack":
+		o.Stack = value
+	case "receiver":
+		o.Receiver = value
+	case "context":
+		o.Context = value
+	case "http":
+		o.HTTP = value
+	case "calls":
+		o.Calls = value
+	case "depth":
+		o.Depth = value
+	case "closures":
+		o.Closures = value
+	default:
+		return fmt.Errorf("unknown option %q", name)
+	}
+	return nil
+}
+
+// Check if the value of the argument with the given name must not be logged.
+func (o *funcOptions) redacted(name string) bool {
+	for _, r := range o.Redact {
+		if r == name {
+			return true
+		}
+	}
+	return redact != nil && redact.MatchString(name)
+}
+
+// Check if the generated code needs anything beyond the plain inspection of the results.
+func (o *funcOptions) extended() bool {
+	return o.Timing || o.Args || o.Stack || o.Receiver
+}
+
+// rule is a single entry of a rules file, all given predicates must match
+type rule struct {
+	name     string
+	allow    bool
+	pkg      *regexp.Regexp
+	path     *regexp.Regexp
+	receiver *regexp.Regexp
+	function *regexp.Regexp
+	file     *regexp.Regexp
+	sig      *regexp.Regexp
+	retErr   *bool
+	minLines int
+	maxLines int
+	options  map[string]bool
+	redact   []string
+	fields   []string
+	snippets []string
+}
+
+// ruleSet decides which functions get instrumented, the first matching rule wins.
+type ruleSet struct {
+	rules    []*rule
+	snippets map[string]*snippet
+}
+
+// Load a rules file, e.g.
+//
+//   rules:
+//     - name: no mocks
+//       action: deny
+//       file: '_mock\.go$'
+//     - action: allow
+//       path: github.com/acme/storage/...
+//       receiver: '^\*Client$'
+//       returns_error: true
+//       min_lines: 5
+//       options:
+//         timing: true
+//         args: true
+//         redact: [password]
+//       snippets: [metrics]
+//
+// The snippets are defined next to the rules, see parseSnippets.
+func loadRules(file string) (*ruleSet, []byte, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: failed to open (%s)", file, err)
+	}
+
+	doc, err := yaml.Parse(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	top, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: expected a mapping with a rules key", file)
+	}
+
+	list, ok := top["rules"].([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: rules must be a sequence", file)
+	}
+
+	rs := &ruleSet{}
+	for i, entry := range list {
+		r, err := parseRule(entry)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: rule %d: %s", file, i+1, err)
+		}
+		rs.rules = append(rs.rules, r)
+	}
+
+	if v, ok := top["snippets"]; ok {
+		if rs.snippets, err = parseSnippets(v); err != nil {
+			return nil, nil, fmt.Errorf("%s: snippets: %s", file, err)
+		}
+	}
+	if err := rs.checkSnippets(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	return rs, src, nil
+}
+
+func parseBool(v interface{}) (bool, error) {
+	s, _ := v.(string)
+	switch s {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected a boolean, got %v", v)
+}
+
+func parseRule(entry interface{}) (*rule, error) {
+	m, ok := entry.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping")
+	}
+
+	r := &rule{}
+	for key, v := range m {
+		var err error
+		switch key {
+		case "name":
+			r.name, _ = v.(string)
+		case "action":
+			switch v {
+			case "allow":
+				r.allow = true
+			case "deny":
+				r.allow = false
+			default:
+				err = fmt.Errorf("action must be allow or deny")
+			}
+		case "package":
+			r.pkg, err = parseRuleRegex(v)
+		case "path":
+			r.path, err = parsePathPattern(v)
+		case "receiver":
+			r.receiver, err = parseRuleRegex(v)
+		case "function":
+			r.function, err = parseRuleRegex(v)
+		case "file":
+			r.file, err = parseRuleRegex(v)
+		case "signature":
+			r.sig, err = parseRuleRegex(v)
+		case "returns_error":
+			var b bool
+			b, err = parseBool(v)
+			r.retErr = &b
+		case "min_lines":
+			r.minLines, err = parseRuleInt(v)
+		case "max_lines":
+			r.maxLines, err = parseRuleInt(v)
+		case "options":
+			r.options, r.redact, r.fields, err = parseRuleOptions(v)
+		case "snippets":
+			r.snippets, err = parseRuleNames(v)
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+	}
+
+	if _, ok := m["action"]; !ok {
+		return nil, fmt.Errorf("action is missing")
+	}
+
+	return r, nil
+}
+
+func parseRuleRegex(v interface{}) (*regexp.Regexp, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a regular expression")
+	}
+	return regexp.Compile(s)
+}
+
+// Turn a package pattern of the go tool into a regular expression matching import paths: ... matches any
+// string, and a pattern ending in /... also matches the path before it, e.g. github.com/x/... matches
+// github.com/x and its subpackages.
+func parsePathPattern(v interface{}) (*regexp.Regexp, error) {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return nil, fmt.Errorf("expected a package pattern")
+	}
+	q := strings.Replace(regexp.QuoteMeta(s), `/\.\.\.`, `(/.*)?`, -1)
+	return regexp.Compile("^" + strings.Replace(q, `\.\.\.`, `.*`, -1) + "$")
+}
+
+func parseRuleInt(v interface{}) (int, error) {
+	s, _ := v.(string)
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a positive number, got %v", v)
+	}
+	return n, nil
+}
+
+func parseRuleNames(v interface{}) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a sequence")
+	}
+
+	var names []string
+	for _, n := range list {
+		s, ok := n.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected names")
+		}
+		names = append(names, s)
+	}
+	return names, nil
+}
+
+func parseRuleOptions(v interface{}) (map[string]bool, []string, []string, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("expected a mapping")
+	}
+
+	options := make(map[string]bool)
+	var redact, fields []string
+	for name, value := range m {
+		var err error
+		switch name {
+		// redact and fields take lists of names
+		case "redact":
+			redact, err = parseRuleNames(value)
+		case "fields":
+			fields, err = parseRuleNames(value)
+		default:
+			var b bool
+			b, err = parseBool(value)
+			if err == nil {
+				err = (&funcOptions{}).set(name, b)
+			}
+			options[name] = b
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return options, redact, fields, nil
+}
+
+func (r *rule) matches(c *candidate) bool {
+	switch {
+	case r.pkg != nil && !r.pkg.MatchString(c.Package):
+	case r.path != nil && !r.path.MatchString(c.Path):
+	case r.receiver != nil && !r.receiver.MatchString(c.Receiver):
+	case r.function != nil && !r.function.MatchString(c.Func):
+	case r.file != nil && !r.file.MatchString(c.File):
+	case r.sig != nil && !r.sig.MatchString(c.Signature):
+	case r.retErr != nil && *r.retErr != c.ReturnsError:
+	case r.minLines > 0 && c.Lines < r.minLines:
+	case r.maxLines > 0 && c.Lines > r.maxLines:
+	default:
+		return true
+	}
+	return false
+}
+
+// Decide if the function should be instrumented, the options of the matching rule are applied to opts.
+// Functions not matched by any rule are instrumented.
+func (rs *ruleSet) decide(c *candidate, opts *funcOptions) bool {
+	for _, r := range rs.rules {
+		if !r.matches(c) {
+			continue
+		}
+
+		for name, value := range r.options {
+			opts.set(name, value)
+		}
+		opts.Redact = append(opts.Redact, r.redact...)
+		opts.Snippets = append(opts.Snippets, r.snippets...)
+		if len(r.fields) > 0 {
+			opts.Receiver = true
+			opts.Fields = r.fields
+		}
+		return r.allow
+	}
+
+	return true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Packages of the same name in different modules are told apart by the path predicate.
+func TestRulePath(t *testing.T) {
+	dir := t.TempDir()
+	src := []byte("package store\n\nimport \"errors\"\n\nfunc Get() error {\n\treturn errors.New(\"not found\")\n}\n")
+	files := make(map[string]string)
+	for _, module := range []string{"github.com/x", "github.com/y"} {
+		root := filepath.Join(dir, filepath.Base(module))
+		if err := os.MkdirAll(filepath.Join(root, "store"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte("module "+module+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files[module] = filepath.Join(root, "store", "store.go")
+		if err := ioutil.WriteFile(files[module], src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		x, y bool
+	}{
+		{"github.com/x/...", true, false},
+		{"github.com/x/store", true, false},
+		{"github.com/.../store", true, true},
+		{"github.com/x", false, false},
+		{"store", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rules := filepath.Join(t.TempDir(), "rules.yaml")
+			content := "rules:\n  - action: allow\n    package: '^store$'\n    path: '" + tt.path + "'\n  - action: deny\n"
+			if err := ioutil.WriteFile(rules, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			annotateOptions(t, "-rules", rules)
+			for module, want := range map[string]bool{"github.com/x": tt.x, "github.com/y": tt.y} {
+				_, stats, err := annotate(files[module], src)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := len(stats.Instrumented) > 0; got != want {
+					t.Errorf("%s: got instrumented %v, expected %v", module, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var serveAddr string
+
+// the code generation uses global state, requests are handled one at a time
+var serveMu sync.Mutex
+
+// serveRequest is the body of every request, a buffer of an editor
+type serveRequest struct {
+	Filename string `json:"filename"`
+	Source   string `json:"source"`
+
+	// Functions limits annotate to the functions with the given names, e.g. pkg.*Type.Func
+	Functions []string `json:"functions,omitempty"`
+}
+
+type serveResponse struct {
+	Source    string           `json:"source,omitempty"`
+	Stats     *fileStats       `json:"stats,omitempty"`
+	Functions []*serveFunction `json:"functions,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// serveFunction is a function of the buffer, positions are 1-based lines and byte columns
+type serveFunction struct {
+	*candidate
+	Traced bool          `json:"traced"`
+	Start  servePosition `json:"start"`
+	End    servePosition `json:"end"`
+}
+
+type servePosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func registerServeFlags(fs *flag.FlagSet) {
+	fs.StringVar(&serveAddr, "addr", "localhost:7878", "address to listen on")
+}
+
+// Add the tracing code to the buffer.
+func serveAnnotate(req *serveRequest) (*serveResponse, error) {
+	onlyFuncs = nil
+	if len(req.Functions) > 0 {
+		onlyFuncs = make(map[string]bool)
+		for _, name := range req.Functions {
+			onlyFuncs[name] = true
+		}
+	}
+	defer func() { onlyFuncs = nil }()
+
+	src, stats, err := annotate(req.Filename, []byte(req.Source))
+	if err != nil {
+		return nil, err
+	}
+	return &serveResponse{Source: string(src), Stats: stats}, nil
+}
+
+// Remove the tracing code from the buffer.
+func serveStrip(req *serveRequest) (*serveResponse, error) {
+	src, err := reverse([]byte(req.Source))
+	if err != nil {
+		return nil, err
+	}
+	return &serveResponse{Source: src}, nil
+}
+
+// List the functions of the buffer that could be instrumented, with their ranges.
+func serveFunctions(req *serveRequest) (*serveResponse, error) {
+	src := []byte(req.Source)
+	fset = token.NewFileSet()
+	f, err := parser.ParseFile(fset, req.Filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	e := editList{filename: req.Filename, packageName: f.Name.Name, orig: src, mocks: mockFile(req.Filename, f)}
+	resp := &serveResponse{Functions: []*serveFunction{}}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil || strings.HasPrefix(fn.Name.Name, "__") {
+			continue
+		}
+
+		start, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+		body := src[fset.Position(fn.Body.Lbrace).Offset+1:]
+		resp.Functions = append(resp.Functions, &serveFunction{
+			candidate: e.describe(fn),
+			Traced:    bytes.HasPrefix(bytes.TrimSpace(body), []byte("/* BEGIN_ERRGOTRACE */")),
+			Start:     servePosition{start.Line, start.Column},
+			End:       servePosition{end.Line, end.Column},
+		})
+	}
+	return resp, nil
+}
+
+// Wrap an action into a handler speaking JSON, errors are returned with status 400.
+func serveHandler(action func(*serveRequest) (*serveResponse, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req serveRequest
+		var resp *serveResponse
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err == nil {
+			if req.Filename == "" {
+				req.Filename = "buffer.go"
+			}
+			serveMu.Lock()
+			resp, err = action(&req)
+			serveMu.Unlock()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			resp = &serveResponse{Error: err.Error()}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func runServe(fs *flag.FlagSet) int {
+	if err := loadOptions(); err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/annotate", serveHandler(serveAnnotate))
+	mux.Handle("/strip", serveHandler(serveStrip))
+	mux.Handle("/functions", serveHandler(serveFunctions))
+
+	log.Printf("listening on %s", serveAddr)
+	if err := http.ListenAndServe(serveAddr, mux); err != nil {
+		log.Printf("%s: failed to listen (%s)", serveAddr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+	"text/template"
+)
+
+// snippet is extra code a rules file attaches to functions with the snippets key of a rule. The prologue
+// runs before the function, the epilogue after its results were inspected. Both are text/templates.
+type snippet struct {
+	prologue *template.Template
+	epilogue *template.Template
+}
+
+// Parse the snippets of a rules file, e.g.
+//
+//   snippets:
+//     metrics:
+//       prologue: '__timer := metrics.NewTimer({{printf "%q" .name}})'
+//       epilogue: '__timer.ObserveDuration()'
+//     lock:
+//       prologue: [debugMu.Lock(), defer debugMu.Unlock()]
+func parseSnippets(v interface{}) (map[string]*snippet, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping of names")
+	}
+
+	snippets := make(map[string]*snippet)
+	for name, def := range m {
+		parts, ok := def.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a mapping with prologue or epilogue", name)
+		}
+
+		s := &snippet{}
+		for part, code := range parts {
+			var err error
+			switch part {
+			case "prologue":
+				s.prologue, err = parseSnippetCode(name+"."+part, code)
+			case "epilogue":
+				s.epilogue, err = parseSnippetCode(name+"."+part, code)
+			default:
+				err = fmt.Errorf("unknown key")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %s", name, part, err)
+			}
+		}
+		snippets[name] = s
+	}
+	return snippets, nil
+}
+
+// The code of a snippet is a string or a sequence of lines.
+func parseSnippetCode(name string, v interface{}) (*template.Template, error) {
+	code, ok := v.(string)
+	if !ok {
+		lines, err := parseRuleNames(v)
+		if err != nil {
+			return nil, fmt.Errorf("expected code or a sequence of lines")
+		}
+		code = strings.Join(lines, "\n")
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Parse(code)
+	if err != nil {
+		return nil, fmt.Errorf("error in template (%s)", err)
+	}
+	return t, nil
+}
+
+// Check that the rules only attach snippets that are defined.
+func (rs *ruleSet) checkSnippets() error {
+	for i, r := range rs.rules {
+		for _, name := range r.snippets {
+			if rs.snippets[name] == nil {
+				return fmt.Errorf("rule %d: snippets: unknown snippet %q", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Generate the code of the snippets for a function. The prologues are in the given order, the epilogues in
+// the reverse one, so the snippets nest like deferred calls. Every part ends with a newline.
+// The variables of the templates:
+//   .name        name used in the trace output, e.g. pkg.*Type.Func
+//   .func        name of the instrumented function
+//   .receiver    receiver type of methods, empty for functions
+//   .resultvars  comma separated variables holding the results, empty without results
+func renderSnippets(names []string, funcName string, f *ast.FuncDecl, resultvars string) (string, string, error) {
+	if len(names) < 1 {
+		return "", "", nil
+	}
+
+	vals := map[string]string{"name": funcName, "func": f.Name.Name, "receiver": "", "resultvars": resultvars}
+	if f.Recv != nil && len(f.Recv.List) > 0 {
+		vals["receiver"] = types.ExprString(f.Recv.List[0].Type)
+	}
+
+	var prologues, epilogues []string
+	for _, name := range names {
+		var s *snippet
+		if rules != nil {
+			s = rules.snippets[name]
+		}
+		if s == nil {
+			return "", "", fmt.Errorf("unknown snippet %q", name)
+		}
+
+		for _, part := range []struct {
+			t    *template.Template
+			code *[]string
+		}{{s.prologue, &prologues}, {s.epilogue, &epilogues}} {
+			if part.t == nil {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := part.t.Execute(&buf, vals); err != nil {
+				return "", "", fmt.Errorf("snippet %s: %s", name, err)
+			}
+			*part.code = append(*part.code, strings.TrimRight(buf.String(), "\n")+"\n")
+		}
+	}
+
+	var epilogue string
+	for i := len(epilogues) - 1; i >= 0; i-- {
+		epilogue += epilogues[i]
+	}
+	return strings.Join(prologues, ""), epilogue, nil
+}
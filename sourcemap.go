@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"strings"
+)
+
+// suffix of the source map written next to an instrumented file
+const sourceMapSuffix = ".errgomap"
+
+// sourceMap maps the lines and functions of an instrumented file to the original file
+type sourceMap struct {
+	Version   int              `json:"version"`
+	File      string           `json:"file"`
+	Lines     []sourceMapRange `json:"lines"`
+	Functions []sourceMapFunc  `json:"functions"`
+}
+
+// sourceMapRange maps the lines Start to End of the instrumented file to the lines starting at Original,
+// generated lines all map to the original line they were inserted after
+type sourceMapRange struct {
+	Start     int  `json:"start"`
+	End       int  `json:"end"`
+	Original  int  `json:"original"`
+	Generated bool `json:"generated,omitempty"`
+}
+
+// sourceMapFunc is an instrumented function whose body was moved into a backend function
+type sourceMapFunc struct {
+	Name     string `json:"name"`
+	Receiver string `json:"receiver,omitempty"`
+	Func     string `json:"func"`
+	Backend  string `json:"backend"`
+	Line     int    `json:"line"`
+}
+
+// Map the instrumented source src back to the source orig.
+func buildSourceMap(file string, orig, src []byte) *sourceMap {
+	m := &sourceMap{Version: 1, File: file, Lines: []sourceMapRange{}, Functions: []sourceMapFunc{}}
+
+	a, b := splitLines(orig), splitLines(src)
+	d := differ{a: a, b: b, delA: make([]bool, len(a)), insB: make([]bool, len(b))}
+	d.compare(0, len(a), 0, len(b))
+
+	var i int
+	for j := 0; j < len(b); {
+		first := i
+		for i < len(a) && d.delA[i] {
+			i++
+		}
+
+		r := sourceMapRange{Start: j + 1, Original: i + 1, Generated: d.insB[j]}
+		if r.Generated {
+			// replacing original lines, or inserted after the previous original line
+			switch {
+			case i > first:
+				r.Original = first + 1
+			case i > 0:
+				r.Original = i
+			}
+			for j < len(b) && d.insB[j] {
+				j++
+			}
+		} else {
+			for j < len(b) && !d.insB[j] && i < len(a) && !d.delA[i] {
+				i++
+				j++
+			}
+		}
+		r.End = j
+		m.Lines = append(m.Lines, r)
+	}
+
+	m.Functions = backendFuncs(file, src, m)
+	return m
+}
+
+// Translate a line of the instrumented file to the original file.
+func (m *sourceMap) original(line int) int {
+	for _, r := range m.Lines {
+		if line >= r.Start && line <= r.End {
+			if r.Generated {
+				return r.Original
+			}
+			return r.Original + line - r.Start
+		}
+	}
+	return line
+}
+
+// Find the functions of the instrumented source whose body was moved into a backend __Func.
+func backendFuncs(file string, src []byte, m *sourceMap) []sourceMapFunc {
+	funcs := []sourceMapFunc{}
+
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, file, src, 0)
+	if err != nil {
+		return funcs
+	}
+
+	receiver := func(fn *ast.FuncDecl) string {
+		if fn.Recv == nil || len(fn.Recv.List) < 1 {
+			return ""
+		}
+		return types.ExprString(fn.Recv.List[0].Type)
+	}
+
+	// the backends of methods with an unnamed receiver are functions named after the mangled receiver
+	shims := make(map[string]*ast.FuncDecl)
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && !strings.HasPrefix(fn.Name.Name, "__") {
+			shims[receiver(fn)+"."+fn.Name.Name] = fn
+			if fn.Recv != nil && len(fn.Recv.List) > 0 && (len(fn.Recv.List[0].Names) < 1 || fn.Recv.List[0].Names[0].Name == "_") {
+				shims["."+mangleReceiver(fn.Recv.List[0].Type)+"_"+fn.Name.Name] = fn
+			}
+		}
+	}
+
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !strings.HasPrefix(fn.Name.Name, "__") {
+			continue
+		}
+		shim, ok := shims[receiver(fn)+"."+strings.TrimPrefix(fn.Name.Name, "__")]
+		if !ok {
+			continue
+		}
+		recv, name := receiver(shim), shim.Name.Name
+
+		full := f.Name.Name + "." + name
+		if recv != "" {
+			full = f.Name.Name + "." + recv + "." + name
+		}
+		funcs = append(funcs, sourceMapFunc{
+			Name:     full,
+			Receiver: recv,
+			Func:     name,
+			Backend:  fn.Name.Name,
+			Line:     m.original(fs.Position(shim.Pos()).Line),
+		})
+	}
+	return funcs
+}
+
+func sourceMapData(file string, orig, src []byte) []byte {
+	data, _ := json.MarshalIndent(buildSourceMap(file, orig, src), "", "  ")
+	return append(data, '\n')
+}
+
+// Stage the source map of a file next to it, or its removal if src is nil.
+func stageSourceMap(file string, orig, src []byte) {
+	path := file + sourceMapSuffix
+	old, err := ioutil.ReadFile(path)
+	if err != nil && src == nil {
+		return
+	} else if err != nil {
+		old = nil
+	}
+
+	var data []byte
+	if src != nil {
+		data = sourceMapData(file, orig, src)
+	}
+	tx.stage(path, old, data)
+}
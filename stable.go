@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefix of the shims generated with -stable-names
+const shimPrefix = "__traced_"
+
+// With -stable-names functions keep their name and body, the tracing code goes into a shim
+// __traced_<name> declared after the function, and the calls in the package are rewritten to it.
+// The name stays stable for code looking up functions by name, e.g. with runtime.FuncForPC.
+// Methods aren't shimmed, calls of them can't be resolved without type information, only
+// -mode defer traces them.
+func stableShim(f *ast.FuncDecl, named []string) bool {
+	return stableNames && f.Recv == nil && named == nil && f.Type.Results != nil && len(f.Type.Results.List) > 0
+}
+
+// Generate the shim of a function, it has the signature of the function and calls it.
+func generateShim(f *ast.FuncDecl, orig []byte, vals map[string]string, defers []string) []byte {
+	// the shim passes all parameters, unnamed ones get a name
+	var params, args []string
+	i := 0
+	for _, field := range f.Type.Params.List {
+		t := string(orig[field.Type.Pos()-1 : field.Type.End()-1])
+		for j := 0; j == 0 || j < len(field.Names); j++ {
+			name := "__p" + strconv.Itoa(i)
+			if j < len(field.Names) && field.Names[j].Name != "_" {
+				name = field.Names[j].Name
+			}
+			i++
+
+			params = append(params, name+" "+t)
+			if strings.HasPrefix(t, "...") {
+				name += "..."
+			}
+			args = append(args, name)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("\n\n/* BEGIN_ERRGOTRACE */\n")
+	fmt.Fprintf(&buf, "func %s%s%s(%s) %s {\n", shimPrefix, f.Name.Name, vals["typeparams"], strings.Join(params, ", "), vals["returns"])
+	buf.WriteString(vals["prologue"])
+	for _, d := range defers {
+		buf.WriteString("defer " + d + "\n")
+	}
+	if vals["timing"] != "" {
+		buf.WriteString("__start := __errgotrace.Now()\n")
+	}
+	fmt.Fprintf(&buf, "%s := %s%s(%s)\n", vals["resultvars"], f.Name.Name, vals["typeargs"], strings.Join(args, ", "))
+	if vals["inspect"] != "" {
+		buf.WriteString(vals["inspect"] + "\n")
+	}
+	buf.WriteString(vals["epilogue"])
+	fmt.Fprintf(&buf, "return %s\n}\n/* END_ERRGOTRACE */", vals["resultvars"])
+	return buf.Bytes()
+}
+
+// Collect the functions that got a shim, by the package directory of the staged files.
+func stagedShims() map[string]map[string]bool {
+	shims := make(map[string]map[string]bool)
+	for _, file := range tx.files {
+		if !strings.HasSuffix(file, ".go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, tx.src[file], 0)
+		if err != nil {
+			continue
+		}
+
+		dir := filepath.Dir(file)
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && strings.HasPrefix(fn.Name.Name, shimPrefix) {
+				if shims[dir] == nil {
+					shims[dir] = make(map[string]bool)
+				}
+				shims[dir][strings.TrimPrefix(fn.Name.Name, shimPrefix)] = true
+			}
+		}
+	}
+	return shims
+}
+
+// Rewrite the calls of all staged files to the functions that got a shim in their package,
+// the original name is kept in a comment for the removal.
+func rewriteShimCalls() error {
+	shims := stagedShims()
+	for _, file := range tx.files {
+		names := shims[filepath.Dir(file)]
+		if len(names) < 1 || !strings.HasSuffix(file, ".go") {
+			continue
+		}
+
+		src, err := rewriteCalls(file, tx.src[file], names)
+		if err != nil {
+			return fileErrorf(file, phaseAnnotate, "%s", err)
+		}
+		tx.src[file] = src
+	}
+	return nil
+}
+
+func rewriteCalls(file string, src []byte, names map[string]bool) ([]byte, error) {
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, file, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	// external test packages only see the exported functions through the package name
+	if strings.HasSuffix(f.Name.Name, "_test") {
+		return src, nil
+	}
+
+	var idents []*ast.Ident
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && strings.HasPrefix(fn.Name.Name, shimPrefix) {
+			continue
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			fun := call.Fun
+			switch x := fun.(type) {
+			case *ast.IndexExpr:
+				fun = x.X
+			case *ast.IndexListExpr:
+				fun = x.X
+			}
+			// identifiers declared in the file resolve to objects, only functions are shimmed
+			if id, ok := fun.(*ast.Ident); ok && names[id.Name] && (id.Obj == nil || id.Obj.Kind == ast.Fun) {
+				idents = append(idents, id)
+			}
+			return true
+		})
+	}
+	if len(idents) < 1 {
+		return src, nil
+	}
+
+	var out []byte
+	pos := 0
+	for _, id := range idents {
+		start, end := fs.Position(id.Pos()).Offset, fs.Position(id.End()).Offset
+		out = append(out, src[pos:start]...)
+		out = append(out, "/* ERRGOTRACE_ORIGINAL "+id.Name+" */ "+inlineCode(shimPrefix+id.Name)...)
+		pos = end
+	}
+	out = append(out, src[pos:]...)
+
+	return format.Source(out)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const stableSource = `package p
+
+import "os"
+
+type File struct{ f *os.File }
+
+func Open(name string) (*File, error) {
+	f, err := os.Open(name)
+	return &File{f}, err
+}
+
+func (f *File) Close() error {
+	return f.f.Close()
+}
+`
+
+// Methods get no shim with -stable-names, they keep their names and are only traced in defer mode.
+func TestStableNamesMethods(t *testing.T) {
+	annotateOptions(t, "-stable-names")
+	out, stats, err := annotate("p.go", []byte(stableSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	if !strings.Contains(s, "func __traced_Open(") || strings.Contains(s, "func __Open(") {
+		t.Errorf("expected a shim for Open\n%s", s)
+	}
+	if !strings.Contains(s, "func (f *File) Close() error {\n\treturn f.f.Close()\n}") || strings.Contains(s, "__Close") || strings.Contains(s, "__traced_Close") {
+		t.Errorf("expected Close to be left alone\n%s", s)
+	}
+	if strings.Join(stats.Skipped, ",") != "p.*File.Close" {
+		t.Errorf("got skipped %v, expected p.*File.Close", stats.Skipped)
+	}
+
+	annotateOptions(t, "-stable-names", "-mode", "defer")
+	out, stats, err = annotate("p.go", []byte(stableSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = string(out)
+	if !strings.Contains(s, "func (f *File) Close() /* ERRGOTRACE_ORIGINAL error */") || !strings.Contains(s, "InspectNamed(") || strings.Contains(s, "__Close") || len(stats.Skipped) != 0 {
+		t.Errorf("expected Close to be traced in its body, skipped %v\n%s", stats.Skipped, s)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+var (
+	// -stat and -max-growth of add and remove
+	showStat  bool
+	maxGrowth int
+)
+
+// number of the largest generated wrappers listed by -stat
+const statWrappers = 5
+
+// fileGrowth is how much a file grew by its tracing code, negative when it was removed
+type fileGrowth struct {
+	file      string
+	lines     int
+	bytes     int
+	origLines int
+}
+
+// The growth in percent of the original lines
+func (g *fileGrowth) percent() int {
+	if g.origLines < 1 {
+		return 0
+	}
+	return g.lines * 100 / g.origLines
+}
+
+// wrapperSize is the number of lines generated for a function
+type wrapperSize struct {
+	name  string
+	file  string
+	lines int
+}
+
+func countLines(src []byte) int {
+	n := bytes.Count(src, []byte("\n"))
+	if len(src) > 0 && src[len(src)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// Find the lines generated for the functions of a file, by comparing their lines with and without tracing code.
+func generatedWrappers(file string, orig, src []byte) []wrapperSize {
+	before, err := sourceFuncs(file, orig)
+	if err != nil {
+		return nil
+	}
+	after, err := sourceFuncs(file, src)
+	if err != nil {
+		return nil
+	}
+
+	lines := make(map[string]int)
+	for _, f := range before {
+		lines[f.name] = f.last - f.first + 1
+	}
+	var sizes []wrapperSize
+	for _, f := range after {
+		if n := f.last - f.first + 1 - lines[f.name]; f.traced && n > 0 {
+			sizes = append(sizes, wrapperSize{name: f.name, file: file, lines: n})
+		}
+	}
+	return sizes
+}
+
+// Print how much the written go files grew for -stat and warn about the ones growing more than -max-growth.
+func sizeImpact(w io.Writer, t *transaction) {
+	var growths []*fileGrowth
+	var wrappers []wrapperSize
+	total := &fileGrowth{}
+	width := 0
+	for _, file := range t.files {
+		orig, src := t.orig[file], t.src[file]
+		if !strings.HasSuffix(file, ".go") || orig == nil || bytes.Equal(orig, src) {
+			continue
+		}
+
+		g := &fileGrowth{file: file, lines: countLines(src) - countLines(orig), bytes: len(src) - len(orig), origLines: countLines(orig)}
+		growths = append(growths, g)
+		total.lines += g.lines
+		total.bytes += g.bytes
+		total.origLines += g.origLines
+		if len(file) > width {
+			width = len(file)
+		}
+
+		if maxGrowth > 0 && g.percent() > maxGrowth {
+			log.Printf("%s: grew by %d%% of its lines, more than -max-growth %d%%", file, g.percent(), maxGrowth)
+		}
+		if showStat && g.lines > 0 {
+			wrappers = append(wrappers, generatedWrappers(file, orig, src)...)
+		}
+	}
+
+	if !showStat || len(growths) < 1 {
+		return
+	}
+	for _, g := range growths {
+		fmt.Fprintf(w, " %-*s | %+d lines (%+d%%), %+d bytes\n", width, g.file, g.lines, g.percent(), g.bytes)
+	}
+	fmt.Fprintf(w, " %d files changed, %+d lines (%+d%%), %+d bytes\n", len(growths), total.lines, total.percent(), total.bytes)
+
+	if len(wrappers) < 1 {
+		return
+	}
+	sort.SliceStable(wrappers, func(i, j int) bool { return wrappers[i].lines > wrappers[j].lines })
+	if len(wrappers) > statWrappers {
+		wrappers = wrappers[:statWrappers]
+	}
+	fmt.Fprintln(w, " largest wrappers:")
+	for _, s := range wrappers {
+		fmt.Fprintf(w, " %5d lines  %s (%s)\n", s.lines, s.name, s.file)
+	}
+}
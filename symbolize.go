@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// the function of a frame, e.g. main.(*Client).__Get(0x1, ...)
+	frameFuncRegex = regexp.MustCompile(`^(\S+?)\.(__[\pL\d_]+)(\[[^\]]*\])?(\(.*\))$`)
+
+	// the position of a frame, e.g. <tab>/src/main.go:42 +0x1d
+	frameFileRegex = regexp.MustCompile(`^(\s+)(\S+\.go):(\d+)(.*)$`)
+)
+
+// Read the source map of an instrumented file.
+func readSourceMap(file string) (*sourceMap, error) {
+	data, err := ioutil.ReadFile(file + sourceMapSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var m sourceMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s%s: invalid source map (%s)", file, sourceMapSuffix, err)
+	}
+	return &m, nil
+}
+
+// symbolizer translates the frames of stack traces with the source maps next to their files
+type symbolizer struct {
+	maps map[string]*sourceMap
+}
+
+func (s *symbolizer) sourceMap(file string) *sourceMap {
+	if m, ok := s.maps[file]; ok {
+		return m
+	}
+
+	m, err := readSourceMap(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Print(err)
+	}
+	s.maps[file] = m
+	return m
+}
+
+// Check if the line is generated code of an instrumented function
+func (m *sourceMap) generated(line int) bool {
+	for _, r := range m.Lines {
+		if line >= r.Start && line <= r.End {
+			return r.Generated
+		}
+	}
+	return false
+}
+
+// Rewrite a frame, given by its function and position line. Frames of generated code are dropped,
+// the function of the original code is the frame of its backend.
+func (s *symbolizer) frame(fn, pos string) []string {
+	p := frameFileRegex.FindStringSubmatch(pos)
+	if p == nil {
+		return []string{fn, pos}
+	}
+	m := s.sourceMap(p[2])
+	if m == nil {
+		return []string{fn, pos}
+	}
+
+	line, _ := strconv.Atoi(p[3])
+	if m.generated(line) && len(m.Functions) > 0 {
+		return nil
+	}
+	pos = p[1] + p[2] + ":" + strconv.Itoa(m.original(line)) + p[4]
+
+	if f := frameFuncRegex.FindStringSubmatch(fn); f != nil {
+		for _, mf := range m.Functions {
+			if mf.Backend != f[2] {
+				continue
+			}
+			// the backend of a method with an unnamed receiver is a function, the frame gets the receiver back
+			name := mf.Func
+			if mf.Receiver != "" && mf.Backend != "__"+mf.Func {
+				name = frameReceiver(mf.Receiver) + "." + name
+			}
+			fn = f[1] + "." + name + f[3] + f[4]
+			break
+		}
+	}
+	return []string{fn, pos}
+}
+
+// Write a receiver type the way the runtime does in stack traces, e.g. (*List[...])
+func frameReceiver(recv string) string {
+	if i := strings.Index(recv, "["); i >= 0 {
+		recv = recv[:i] + "[...]"
+	}
+	if strings.HasPrefix(recv, "*") {
+		return "(" + recv + ")"
+	}
+	return recv
+}
+
+func (s *symbolizer) translate(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	// a function line is only written once the position line after it is known
+	var fn string
+	var pending bool
+	for scanner.Scan() {
+		line := scanner.Text()
+		if pending && frameFileRegex.MatchString(line) {
+			for _, l := range s.frame(fn, line) {
+				fmt.Fprintln(w, l)
+			}
+			pending = false
+			continue
+		}
+
+		if pending {
+			fmt.Fprintln(w, fn)
+		}
+		fn, pending = line, true
+	}
+	if pending {
+		fmt.Fprintln(w, fn)
+	}
+	return scanner.Err()
+}
+
+func runSymbolize(fs *flag.FlagSet) int {
+	s := &symbolizer{maps: make(map[string]*sourceMap)}
+
+	if fs.NArg() < 1 {
+		if err := s.translate(os.Stdin, os.Stdout); err != nil {
+			log.Printf("stdin: failed to read (%s)", err)
+			return 1
+		}
+		return 0
+	}
+
+	var failure bool
+	for _, file := range fs.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("%s: failed to open (%s)", file, err)
+			failure = true
+			continue
+		}
+
+		err = s.translate(f, os.Stdout)
+		f.Close()
+		if err != nil {
+			log.Printf("%s: failed to read (%s)", file, err)
+			failure = true
+		}
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+// Copyright 2022 The Example Authors.
+// SPDX-License-Identifier: MIT
+
+//go:build (linux && amd64) || darwin
+// +build linux,amd64 darwin
+
+// Package store keeps the blobs of the service.
+//
+//	store.Open("blobs")
+package store
+
+import "errors"
+
+func Open(name string) error {
+	if name == "" {
+		return errors.New("no name")
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+// Copyright 2023 The Example Authors. All rights reserved.   
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+
+// Package store keeps the blobs of the service.
+package store
+
+import "errors"
+
+func Open(name string) error {
+	if name == "" {
+		return errors.New("no name")
+	}
+	return nil
+}
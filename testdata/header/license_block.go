@@ -0,0 +1,18 @@
+/*
+   Copyright 2021 Example Corp.
+
+	Permission is hereby granted, free of charge, to any person obtaining a copy   
+	of this software, to deal in the Software without restriction.
+*/
+
+
+package store
+
+import "errors"
+
+func Open(name string) error {
+	if name == "" {
+		return errors.New("no name")
+	}
+	return nil
+}
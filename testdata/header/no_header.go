@@ -0,0 +1,10 @@
+package store
+
+import "errors"
+
+func Open(name string) error {
+	if name == "" {
+		return errors.New("no name")
+	}
+	return nil
+}
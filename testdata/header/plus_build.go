@@ -0,0 +1,13 @@
+// +build linux,amd64 darwin
+// +build !purego
+
+package store
+
+import "errors"
+
+func Open(name string) error {
+	if name == "" {
+		return errors.New("no name")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Package api serves a small JSON API over net/http.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type User struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Repository interface {
+	User(id int) (*User, error)
+	Save(u *User) error
+}
+
+type Server struct {
+	repo Repository
+	mux  *http.ServeMux
+}
+
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
+func NewServer(repo Repository) *Server {
+	s := &Server{repo: repo, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/user", s.handle(s.getUser))
+	s.mux.HandleFunc("/user/save", s.handle(func(w http.ResponseWriter, r *http.Request) error {
+		var u User
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			return &statusError{http.StatusBadRequest, err}
+		}
+		return s.repo.Save(&u)
+	}))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) { s.mux.ServeHTTP(w, r) }
+
+func (s *Server) handle(f func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := f(w, r); err != nil {
+			code := http.StatusInternalServerError
+			var se *statusError
+			if errors.As(err, &se) {
+				code = se.code
+			}
+			http.Error(w, err.Error(), code)
+		}
+	}
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		return &statusError{http.StatusBadRequest, fmt.Errorf("id: %w", err)}
+	}
+	u, err := s.repo.User(id)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(u)
+}
@@ -0,0 +1,77 @@
+// Package config reads key=value files, the way many small tools keep their settings.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrMissing = errors.New("missing key")
+
+type Config struct {
+	values map[string]string
+}
+
+// Load reads the configuration from a file.
+func Load(path string) (c *Config, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return Parse(f)
+}
+
+// Parse reads key=value lines, # starts a comment.
+func Parse(r io.Reader) (*Config, error) {
+	c := &Config{values: make(map[string]string)}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key=value", n)
+		}
+		c.values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return c, s.Err()
+}
+
+func (c *Config) String(key string) (string, error) {
+	v, ok := c.values[key]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", key, ErrMissing)
+	}
+	return v, nil
+}
+
+func (c *Config) Int(key string) (int, error) {
+	v, err := c.String(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(v)
+}
+
+func (c *Config) Bool(key string, def bool) (bool, error) {
+	v, err := c.String(key)
+	switch {
+	case errors.Is(err, ErrMissing):
+		return def, nil
+	case err != nil:
+		return false, err
+	}
+	return strconv.ParseBool(v)
+}
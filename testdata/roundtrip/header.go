@@ -0,0 +1,27 @@
+// Copyright 2024 The Example Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+// Package sys wraps a few calls of the operating system.
+package sys
+
+import "os"
+
+func Hostname() (string, error) { return os.Hostname() }
+
+func Lookup(key string) (value string, ok bool, err error) {
+	value, ok = os.LookupEnv(key)
+	return
+}
+
+func Remove(paths ...string) error {
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
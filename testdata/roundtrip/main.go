@@ -0,0 +1,52 @@
+// A command that fails, to check the events of the instrumented program.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type parseError struct {
+	input string
+}
+
+func (e parseError) Error() string { return "cannot parse " + strconv.Quote(e.input) }
+
+func parse(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, parseError{s}
+	}
+	return n, nil
+}
+
+func sum(inputs ...string) (total int, err error) {
+	for _, s := range inputs {
+		n, err := parse(s)
+		if err != nil {
+			return 0, fmt.Errorf("sum: %w", err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func check(total int) error {
+	if total > 10 {
+		return errors.New("too large")
+	}
+	return nil
+}
+
+func main() {
+	if _, err := sum("1", "2", "three"); err != nil {
+		fmt.Println(err)
+	}
+	total, _ := sum("4", "5", "6")
+	if err := check(total); err != nil {
+		fmt.Println(err)
+		os.Exit(0)
+	}
+}
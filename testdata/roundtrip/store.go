@@ -0,0 +1,73 @@
+// Package store is an in-memory cache with expiry, generic over keys and values.
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+type Cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]entry[V]
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+func New[K comparable, V any](ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{entries: make(map[K]entry[V]), ttl: ttl, now: time.Now}
+}
+
+func (c *Cache[K, V]) Put(k K, v V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[k] = entry[V]{value: v, expires: c.now().Add(c.ttl)}
+}
+
+func (c *Cache[K, V]) Get(k K) (V, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[k]
+	if !ok || c.now().After(e.expires) {
+		var zero V
+		return zero, ErrNotFound
+	}
+	return e.value, nil
+}
+
+// Load returns the cached value or the one of load, which is cached unless it fails.
+func (c *Cache[K, V]) Load(k K, load func(K) (V, error)) (V, error) {
+	if v, err := c.Get(k); err == nil {
+		return v, nil
+	}
+	v, err := load(k)
+	if err != nil {
+		return v, err
+	}
+	c.Put(k, v)
+	return v, nil
+}
+
+func (*Cache[K, V]) Validate(k K) error {
+	var zero K
+	if k == zero {
+		return errors.New("empty key")
+	}
+	return nil
+}
+
+type Keys []string
+
+func (Keys) Check(k string) error {
+	if k == "" {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Package worker runs jobs on a pool of goroutines and collects their errors.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type Job func(ctx context.Context) error
+
+type Pool struct {
+	size int
+}
+
+func NewPool(size int) (*Pool, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("pool size %d", size)
+	}
+	return &Pool{size: size}, nil
+}
+
+// Run runs the jobs and returns the errors of all failed jobs, joined.
+func (p *Pool) Run(ctx context.Context, jobs []Job) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	work := make(chan Job)
+	for i := 0; i < p.size; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range work {
+				if err := job(ctx); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+loop:
+	for _, job := range jobs {
+		select {
+		case work <- job:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(work)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func Retry(n int, job Job) Job {
+	return func(ctx context.Context) (err error) {
+		for i := 0; i < n; i++ {
+			if err = job(ctx); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("after %d attempts: %w", n, err)
+	}
+}
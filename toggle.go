@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+var (
+	// -func and -line of add and remove select single functions, the rest of their files is left alone
+	funcFlag string
+	lineFlag int
+
+	// the number of functions -func and -line matched in all files
+	funcMatches int
+)
+
+func registerFuncFlags(fs *flag.FlagSet) {
+	fs.StringVar(&funcFlag, "func", "", "only add or remove the tracing code of the function with the given `name`, e.g. pkg.Type.Method, the rest of the file is left alone")
+	fs.IntVar(&lineFlag, "line", 0, "only add or remove the tracing code of the function at the given `line` of the file, e.g. the cursor of an editor")
+}
+
+func selectingFuncs() bool {
+	return funcFlag != "" || lineFlag > 0
+}
+
+// Check if remove only takes the tracing code of some functions, selected by -func, -line or the name filters.
+func partialRemoval() bool {
+	return selectingFuncs() || filter.naming()
+}
+
+// sourceFunc is a function declaration of a source that may contain tracing code. It spans the lines of
+// the function with its doc comment and its tracing code, e.g. the wrapped body in wrapper mode.
+type sourceFunc struct {
+	name   string
+	traced bool
+
+	// the offsets of the first line and after the last line, and their line numbers
+	start, end  int
+	first, last int
+}
+
+// Check if the function is selected by -func, -line and the name filters, the * of pointer receivers may
+// be left out of -func.
+func (f *sourceFunc) selected() bool {
+	if funcFlag != "" && f.name != funcFlag && strings.Replace(f.name, "*", "", 1) != funcFlag {
+		return false
+	}
+	if !filter.matchName(f.name) {
+		return false
+	}
+	return lineFlag < 1 || f.first <= lineFlag && lineFlag <= f.last
+}
+
+// Find the function declarations of a source and the tracing code that belongs to them: the regions between
+// markers that begin inside of a function, and the declarations that begin inside of those regions.
+func sourceFuncs(filename string, src []byte) ([]*sourceFunc, error) {
+	fset = token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	offset := func(p token.Pos) int { return fset.Position(p).Offset }
+
+	var offsets []int
+	for off := range markerComments(src) {
+		offsets = append(offsets, off)
+	}
+	sort.Ints(offsets)
+
+	// the regions of tracing code, each from its begin to behind its end marker
+	var regions [][2]int
+	begin := -1
+	for _, off := range offsets {
+		switch {
+		case bytes.HasPrefix(src[off:], []byte(beginMarker)) && begin < 0:
+			begin = off
+		case bytes.HasPrefix(src[off:], []byte(endMarker)) && begin >= 0:
+			regions = append(regions, [2]int{begin, off + len(endMarker)})
+			begin = -1
+		}
+	}
+
+	e := editList{filename: filename, packageName: f.Name.Name, orig: src}
+	var funcs []*sourceFunc
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil || strings.HasPrefix(fn.Name.Name, "__") {
+			continue
+		}
+
+		pos, end := offset(fn.Pos()), offset(fn.End())
+		sf := &sourceFunc{name: e.describe(fn).Name}
+		for changed := true; changed; {
+			changed = false
+			for _, r := range regions {
+				if r[0] >= pos && r[0] < end {
+					sf.traced = true
+					if r[1] > end {
+						end, changed = r[1], true
+					}
+				}
+			}
+			for _, d := range f.Decls {
+				if p := offset(d.Pos()); p > pos && p < end && offset(d.End()) > end {
+					end, changed = offset(d.End()), true
+				}
+			}
+		}
+
+		if fn.Doc != nil {
+			pos = offset(fn.Doc.Pos())
+		}
+		sf.start = bytes.LastIndexByte(src[:pos], '\n') + 1
+		sf.end = len(src)
+		if i := bytes.IndexByte(src[end:], '\n'); i >= 0 {
+			sf.end = end + i + 1
+		}
+		sf.first = bytes.Count(src[:sf.start], []byte("\n")) + 1
+		sf.last = sf.first + bytes.Count(src[sf.start:sf.end-1], []byte("\n"))
+		funcs = append(funcs, sf)
+	}
+	return funcs, nil
+}
+
+// Add the tracing code of the functions selected by -func and -line. Files that already contain tracing
+// code keep it, the selected functions are annotated in the original source and spliced into the file.
+func annotateSelected(filename string, orig []byte) ([]byte, *fileStats, error) {
+	stats := &fileStats{File: filename}
+	funcs, err := sourceFuncs(filename, orig)
+	if err != nil {
+		return nil, stats, fileErrorf(filename, phaseParse, "%s", err)
+	}
+
+	onlyFuncs = make(map[string]bool)
+	defer func() { onlyFuncs = nil }()
+	var selected []*sourceFunc
+	for _, f := range funcs {
+		if f.selected() {
+			funcMatches++
+			if !f.traced {
+				onlyFuncs[f.name] = true
+				selected = append(selected, f)
+			}
+		}
+	}
+	if len(selected) < 1 {
+		return orig, stats, nil
+	}
+
+	processed := containsTracing(orig)
+	input := orig
+	if processed {
+		src, err := reverse(orig)
+		if err != nil {
+			return nil, stats, fileErrorf(filename, phaseRemove, "failed to read (%s)", err)
+		}
+		input = []byte(src)
+	}
+
+	src, stats, err := annotate(filename, input)
+	if err != nil {
+		return nil, stats, err
+	}
+	for _, f := range selected {
+		if !contains(stats.Instrumented, f.name) {
+			return nil, stats, fileErrorf(filename, phaseAnnotate, "%s can't be traced, it has no results or is excluded by a filter, rule or directive", f.name)
+		}
+	}
+	if !processed {
+		return src, stats, nil
+	}
+
+	annotated, err := sourceFuncs(filename, src)
+	if err != nil {
+		return nil, stats, fileErrorf(filename, phaseAnnotate, "%s", err)
+	}
+	code := make(map[string][]byte)
+	for _, f := range annotated {
+		code[f.name] = src[f.start:f.end]
+	}
+
+	// from the end, so the offsets of the functions before stay valid
+	out := orig
+	for i := len(selected) - 1; i >= 0; i-- {
+		f := selected[i]
+		out = append(append(append([]byte(nil), out[:f.start]...), code[f.name]...), out[f.end:]...)
+	}
+	stats.BytesAdded = len(out) - len(orig)
+	return out, stats, nil
+}
+
+// Remove the tracing code of the functions selected by -func, -line and the name filters. Once no function of the file
+// has tracing code anymore, the import and the setup of the runtime are removed, too.
+func reverseSelected(filename string, orig []byte) (string, error) {
+	funcs, err := sourceFuncs(filename, orig)
+	if err != nil {
+		return "", err
+	}
+
+	out := string(orig)
+	removed := false
+	for i := len(funcs) - 1; i >= 0; i-- {
+		f := funcs[i]
+		if !f.selected() {
+			continue
+		}
+		funcMatches++
+		if !f.traced {
+			continue
+		}
+
+		code := orig[f.start:f.end]
+		if bytes.Contains(code, []byte(shimPrefix)) {
+			return "", fmt.Errorf("%s was added with -stable-names, the calls in the package refer to it, remove the tracing code of the whole package instead", f.name)
+		}
+		stripped, err := reverse(code)
+		if err != nil {
+			return "", err
+		}
+		out = out[:f.start] + stripped + out[f.end:]
+		removed = true
+	}
+	if !removed {
+		return out, nil
+	}
+
+	rest, err := sourceFuncs(filename, []byte(out))
+	if err != nil {
+		return "", err
+	}
+	for _, f := range rest {
+		if f.traced {
+			return out, nil
+		}
+	}
+	return reverse([]byte(out))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// transaction collects the new contents of all files of a -w run, nothing is written
+// unless every file was processed, and a failed write restores the files written before.
+// Files without original contents are new, files without new contents get removed.
+type transaction struct {
+	files []string
+	orig  map[string][]byte
+	src   map[string][]byte
+}
+
+func newTransaction() *transaction {
+	return &transaction{orig: make(map[string][]byte), src: make(map[string][]byte)}
+}
+
+// Stage the new contents of a file.
+func (t *transaction) stage(file string, orig, src []byte) {
+	if _, ok := t.src[file]; !ok {
+		t.files = append(t.files, file)
+		t.orig[file] = orig
+	}
+	t.src[file] = src
+}
+
+// Check that every staged go file still parses.
+func (t *transaction) check() error {
+	for _, file := range t.files {
+		if !strings.HasSuffix(file, ".go") {
+			continue
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), file, t.src[file], parser.ParseComments); err != nil {
+			return fileErrorf(file, phaseCheck, "result doesn't parse (%s)", err)
+		}
+	}
+	return nil
+}
+
+// Write all staged files, if one fails the files written so far are restored.
+func (t *transaction) commit() error {
+	for i, file := range t.files {
+		if err := writeOrRemove(file, t.src[file]); err != nil {
+			err = fileErrorf(file, phaseWrite, "failed to write (%s)", err)
+			if rerr := t.restore(t.files[:i]); rerr != nil {
+				return fileErrorf(file, phaseWrite, "failed to write (%s), %s", err.(*fileError).Message, rerr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the original contents of the given files.
+func (t *transaction) restore(files []string) error {
+	var failed error
+	for _, file := range files {
+		if err := writeOrRemove(file, t.orig[file]); err != nil && failed == nil {
+			failed = fmt.Errorf("%s: failed to restore (%s)", file, err)
+		}
+	}
+	return failed
+}
+
+func writeOrRemove(file string, data []byte) error {
+	if data == nil {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gellweiler/errgotrace/internal/seal"
+)
+
+var (
+	unsealKey    string
+	unsealVerify string
+	unsealGenKey string
+)
+
+func registerUnsealFlags(fs *flag.FlagSet) {
+	fs.StringVar(&unsealKey, "key", "", "file with the base64 X25519 private key decrypting the batches of an encrypted sink")
+	fs.StringVar(&unsealVerify, "verify", "", "file with the base64 Ed25519 public key checking the batches of a signed sink")
+	fs.StringVar(&unsealGenKey, "genkey", "", "print a new key pair in base64, the private key first: x25519 for encrypting, ed25519 for signing")
+}
+
+// Read a base64 key from a file
+func readKey(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+}
+
+func generateKeys(kind string) int {
+	var private, public []byte
+	var err error
+	switch kind {
+	case "x25519":
+		private, public, err = seal.GenerateKey()
+	case "ed25519":
+		public, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		log.Printf("unknown key type %q, expected x25519 or ed25519", kind)
+		return 2
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(private))
+	fmt.Println(base64.StdEncoding.EncodeToString(public))
+	return 0
+}
+
+func runUnseal(fs *flag.FlagSet) int {
+	if unsealGenKey != "" {
+		return generateKeys(unsealGenKey)
+	}
+	if (unsealKey == "") == (unsealVerify == "") {
+		log.Print("either -key or -verify is required")
+		return 2
+	}
+
+	prefix := seal.SealedPrefix
+	var open func(data string) ([]byte, error)
+	var err error
+	if unsealKey != "" {
+		var key []byte
+		if key, err = readKey(unsealKey); err == nil {
+			open, err = seal.Decrypter(key)
+		}
+	} else {
+		prefix = seal.SignedPrefix
+		var key []byte
+		if key, err = readKey(unsealVerify); err == nil {
+			open, err = seal.Verifier(ed25519.PublicKey(key))
+		}
+	}
+	if err != nil {
+		log.Printf("invalid key (%s)", err)
+		return 1
+	}
+
+	read := func(name string, r io.Reader) bool {
+		if err := seal.Read(r, os.Stdout, prefix, open); err != nil {
+			log.Printf("%s: %s", name, err)
+			return false
+		}
+		return true
+	}
+
+	if fs.NArg() < 1 {
+		if !read("stdin", os.Stdin) {
+			return 1
+		}
+		return 0
+	}
+
+	var failure bool
+	for _, file := range fs.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("%s: failed to open (%s)", file, err)
+			failure = true
+			continue
+		}
+		if !read(file, f) {
+			failure = true
+		}
+		f.Close()
+	}
+
+	if failure {
+		return 1
+	}
+	return 0
+}
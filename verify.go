@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a compiler error of go build, the file is relative to the directory of the package
+var buildErrorRegex = regexp.MustCompile(`^(.+\.go):(\d+)(?::\d+)?: (.*)$`)
+
+type buildError struct {
+	file string
+	line int
+	msg  string
+}
+
+// Build the package in dir, the errors are nil if it compiles.
+func buildPackage(dir string) ([]buildError, string, error) {
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); !ok && err != nil {
+		return nil, "", fmt.Errorf("%s: failed to run go build (%s)", dir, err)
+	} else if err == nil {
+		return nil, "", nil
+	}
+
+	output := strings.TrimSpace(string(out))
+	errs := []buildError{}
+	for _, line := range strings.Split(output, "\n") {
+		m := buildErrorRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[2])
+		file := m[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		errs = append(errs, buildError{file: file, line: n, msg: m[3]})
+	}
+	return errs, output, nil
+}
+
+// typeChecker type-checks packages with go/types, the imported packages are checked from their sources
+// once per run. Nothing is compiled or linked.
+type typeChecker struct {
+	fset     *token.FileSet
+	importer types.Importer
+}
+
+func newTypeChecker() *typeChecker {
+	fset := token.NewFileSet()
+	return &typeChecker{fset: fset, importer: importer.ForCompiler(fset, "source", nil)}
+}
+
+// Type-check the package in dir like buildPackage builds it, the errors are nil if it has none.
+func (t *typeChecker) check(dir string) ([]buildError, string, error) {
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: failed to load the package (%s)", dir, err)
+	}
+
+	var files []*ast.File
+	for _, name := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		f, err := parser.ParseFile(t.fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: failed to parse (%s)", filepath.Join(dir, name), err)
+		}
+		files = append(files, f)
+	}
+
+	var errs []buildError
+	var output []string
+	conf := types.Config{
+		Importer:    t.importer,
+		FakeImportC: true,
+		Error: func(err error) {
+			e, ok := err.(types.Error)
+			if !ok {
+				output = append(output, err.Error())
+				return
+			}
+			pos := e.Fset.Position(e.Pos)
+			errs = append(errs, buildError{file: pos.Filename, line: pos.Line, msg: e.Msg})
+			output = append(output, err.Error())
+		},
+	}
+	conf.Check(pkg.ImportPath, t.fset, files, nil)
+
+	if len(output) < 1 {
+		return nil, "", nil
+	}
+	if errs == nil {
+		errs = []buildError{}
+	}
+	return errs, strings.Join(output, "\n"), nil
+}
+
+// Name the function around a line of a file, generated functions are named after the function they belong to.
+func enclosingFunc(file string, line int) string {
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, file, nil, 0)
+	if err != nil {
+		return ""
+	}
+
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fs.Position(fn.Pos()).Line > line || fs.Position(fn.End()).Line < line {
+			continue
+		}
+		name := strings.TrimPrefix(fn.Name.Name, "__")
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			name = types.ExprString(fn.Recv.List[0].Type) + "." + name
+		}
+		return name
+	}
+	return ""
+}
+
+// Check the packages of all written files, by building or type-checking them, and restore the files that
+// break their package. Files are blamed by the errors, if none point to a written file all written files
+// of the package are restored, written maps them to their original contents.
+// Returns false if a file was restored or a package still doesn't compile.
+func verifyPackages(written map[string][]byte, report *runReport, check func(dir string) ([]buildError, string, error)) bool {
+	pending := make(map[string][]string)
+	for file := range written {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			abs = file
+		}
+		pending[filepath.Dir(abs)] = append(pending[filepath.Dir(abs)], file)
+	}
+
+	var dirs []string
+	for dir := range pending {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	ok := true
+	for _, dir := range dirs {
+		files := pending[dir]
+		for {
+			errs, output, err := check(dir)
+			if err != nil {
+				log.Print(err)
+				return false
+			}
+			if errs == nil {
+				break
+			}
+			if len(files) < 1 {
+				log.Printf("%s: package doesn't compile without the instrumented code either (%s)", dir, output)
+				ok = false
+				break
+			}
+
+			blamed := make(map[string]string)
+			for _, e := range errs {
+				for _, file := range files {
+					if abs, _ := filepath.Abs(file); abs == e.file {
+						reportFailure(file, phaseVerify, fmt.Errorf("line %d: %s: %s", e.line, enclosingFunc(file, e.line), e.msg))
+						if _, seen := blamed[file]; !seen {
+							blamed[file] = e.msg
+						}
+					}
+				}
+			}
+			if len(blamed) < 1 {
+				for _, file := range files {
+					blamed[file] = output
+				}
+			}
+
+			var rest []string
+			for _, file := range files {
+				reason, isBlamed := blamed[file]
+				if !isBlamed {
+					rest = append(rest, file)
+					continue
+				}
+				if err := ioutil.WriteFile(file, written[file], 0); err != nil {
+					reportFailure(file, phaseWrite, fmt.Errorf("failed to restore (%s)", err))
+					return false
+				}
+				reportFailure(file, phaseVerify, fmt.Errorf("restored, the package doesn't compile with it"))
+				report.rollback(file, reason)
+				ok = false
+			}
+			files = rest
+		}
+	}
+
+	return ok
+}
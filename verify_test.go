@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Run main in a child process, for the tests of the exit code.
+func TestErrgotraceMain(t *testing.T) {
+	if os.Getenv("ERRGOTRACE_TEST_MAIN") != "1" {
+		t.Skip("only run by the tests of the exit code")
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	os.Args = append([]string{"errgotrace"}, args...)
+	main()
+}
+
+// A file that doesn't compile once instrumented is restored, and the run fails.
+func TestVerifyRollbackFails(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+
+	src := []byte("package a\n\nimport \"errors\"\n\nfunc F() error { return errors.New(\"failed\") }\n")
+	for _, flag := range []string{"-verify", "-typecheck"} {
+		t.Run(flag, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "errgotrace")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			// the runtime can't be imported, the module doesn't require it
+			if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/a\n\ngo 1.21\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join(dir, "a.go")
+			if err := ioutil.WriteFile(file, src, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestErrgotraceMain$", "--", "add", "-w", "-q", flag, file)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "ERRGOTRACE_TEST_MAIN=1", "GO111MODULE=on", "GOPROXY=off", "GOFLAGS=")
+			out, err := cmd.CombinedOutput()
+			exit, ok := err.(*exec.ExitError)
+			if !ok || exit.ExitCode() != 1 {
+				t.Fatalf("expected exit code 1, got %v\n%s", err, out)
+			}
+
+			restored, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(restored) != string(src) {
+				t.Errorf("expected the file to be restored, got\n%s", restored)
+			}
+		})
+	}
+}